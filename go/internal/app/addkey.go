@@ -0,0 +1,104 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/BigCactusLabs/codex-multipass/internal/ui"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var addKeyCmd = &cobra.Command{
+	Use:   "add-key <name>",
+	Short: "Save an OpenAI API key as a profile",
+	Long: "Save an API-key login as a profile without running codex login. The key is read from " +
+		"--from-env, from stdin when it is piped, or else prompted for without echo. It is never " +
+		"accepted as an argument, where it would end up in shell history and process listings, " +
+		"and it is masked in all output.\n\n" +
+		"An existing profile is only replaced with --force. With --dry-run the key is still read and " +
+		"checked, and the planned writes are shown.",
+	Example: "  codex-mp add-key ci-bot\n" +
+		"  pass show openai/ci | codex-mp add-key ci-bot\n" +
+		"  codex-mp add-key ci-bot --from-env OPENAI_API_KEY",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			fail("add-key takes no key argument; pipe the key on stdin or use --from-env")
+		}
+		if len(args) != 1 {
+			fail("Usage: codex-mp add-key <name> [--from-env VAR] [--force] [--dry-run]")
+		}
+		paths := resolvePaths()
+		name := args[0]
+		fromEnv, _ := cmd.Flags().GetString("from-env")
+		force, _ := cmd.Flags().GetBool("force")
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		key := readAPIKey(fromEnv)
+		plan, err := profile.AddKey(name, key, force, paths, dryRun)
+		if err != nil {
+			fail(err.Error())
+		}
+		if dryRun {
+			reportPlan(cmd, "add-key "+name, plan)
+			return
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":      true,
+				"action":  "add-key",
+				"profile": name,
+				"key":     model.MaskKey(key),
+			})
+			return
+		}
+		ui.Success("Saved API key %s as profile: %s", model.MaskKey(key), name)
+	},
+}
+
+// readAPIKey returns the key from the environment variable fromEnv if set, or else
+// from stdin, prompting without echo when it is a terminal.
+func readAPIKey(fromEnv string) string {
+	if fromEnv != "" {
+		key := strings.TrimSpace(os.Getenv(fromEnv))
+		if key == "" {
+			fail("%s is not set", fromEnv)
+		}
+		return key
+	}
+
+	if isTerminal(stdin) {
+		fmt.Fprint(os.Stderr, "OpenAI API key: ")
+		raw, err := term.ReadPassword(int(stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			fail("failed to read API key: %v", err)
+		}
+		return strings.TrimSpace(string(raw))
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(stdin, 1<<16))
+	if err != nil {
+		fail("failed to read API key from stdin: %v", err)
+	}
+	key := strings.TrimSpace(string(raw))
+	if key == "" {
+		fail("no API key on stdin")
+	}
+	return key
+}
+
+func init() {
+	addKeyCmd.Flags().String("from-env", "", "Read the key from this environment variable")
+	addKeyCmd.Flags().Bool("force", false, "Replace an existing profile")
+	dryRunFlag(addKeyCmd)
+	rootCmd.AddCommand(addKeyCmd)
+}
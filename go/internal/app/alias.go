@@ -0,0 +1,131 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias [alias name]",
+	Short: "List, set or remove profile aliases",
+	Long:  "Aliases are short names accepted wherever a profile name is. Without arguments, list them.",
+	Example: "  codex-mp alias w work\n" +
+		"  codex-mp use w\n" +
+		"  codex-mp alias --remove w",
+	Run: func(cmd *cobra.Command, args []string) {
+		paths := resolvePaths()
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		remove, _ := cmd.Flags().GetBool("remove")
+
+		switch {
+		case remove:
+			if len(args) != 1 {
+				fail("Usage: codex-mp alias --remove <alias>")
+			}
+			if showPlan(cmd, paths, profile.Operation{Op: profile.OpUnalias, Name: args[0]}) {
+				return
+			}
+			if err := profile.RemoveAlias(args[0], paths); err != nil {
+				fail(err.Error())
+			}
+			if jsonOutput {
+				fmt.Printf(`{"ok":true,"action":"alias-remove","alias":"%s"}`+"\n", args[0])
+			} else {
+				fmt.Printf("✗ Removed alias: %s\n", args[0])
+			}
+
+		case len(args) == 2:
+			if showPlan(cmd, paths, profile.Operation{Op: profile.OpAlias, Name: args[0], To: args[1]}) {
+				return
+			}
+			if err := profile.SetAlias(args[0], args[1], paths); err != nil {
+				fail(err.Error())
+			}
+			if jsonOutput {
+				fmt.Printf(`{"ok":true,"action":"alias","alias":"%s","profile":"%s"}`+"\n", args[0], args[1])
+			} else {
+				fmt.Printf("✓ Alias %s -> %s\n", args[0], args[1])
+			}
+
+		case len(args) == 0:
+			aliases, err := profile.Aliases(paths)
+			if err != nil {
+				fail(err.Error())
+			}
+			if jsonOutput {
+				json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "aliases": aliases})
+				return
+			}
+			names := make([]string, 0, len(aliases))
+			for alias := range aliases {
+				names = append(names, alias)
+			}
+			sort.Strings(names)
+			for _, alias := range names {
+				fmt.Printf("  %s -> %s\n", alias, aliases[alias])
+			}
+
+		default:
+			fail("Usage: codex-mp alias [<alias> <name>]")
+		}
+	},
+}
+
+var defaultCmd = &cobra.Command{
+	Use:   "default [name]",
+	Short: "Show or set the default profile",
+	Long:  "The default profile is what codex-mp use switches to when given no name.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			fail("Usage: codex-mp default [name]")
+		}
+		paths := resolvePaths()
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		clearDefault, _ := cmd.Flags().GetBool("clear")
+
+		if clearDefault || len(args) == 1 {
+			name := ""
+			if !clearDefault {
+				name = profileArg(args[0], paths)
+			}
+			if showPlan(cmd, paths, profile.Operation{Op: profile.OpDefault, Name: name}) {
+				return
+			}
+			if err := profile.SetDefaultProfile(name, paths); err != nil {
+				fail(err.Error())
+			}
+			if jsonOutput {
+				fmt.Printf(`{"ok":true,"action":"default","profile":"%s"}`+"\n", name)
+			} else if name == "" {
+				fmt.Println("✓ Cleared default profile")
+			} else {
+				fmt.Printf("✓ Default profile: %s\n", name)
+			}
+			return
+		}
+
+		name, err := profile.DefaultProfile(paths)
+		if err != nil {
+			fail(err.Error())
+		}
+		if jsonOutput {
+			fmt.Printf(`{"ok":true,"profile":"%s"}`+"\n", name)
+		} else if name != "" {
+			fmt.Println(name)
+		}
+	},
+}
+
+func init() {
+	aliasCmd.Flags().Bool("remove", false, "Remove the named alias")
+	defaultCmd.Flags().Bool("clear", false, "Clear the default profile")
+	dryRunFlag(aliasCmd)
+	dryRunFlag(defaultCmd)
+	rootCmd.AddCommand(aliasCmd)
+	rootCmd.AddCommand(defaultCmd)
+}
@@ -1,6 +1,9 @@
 package app
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -52,3 +55,238 @@ func TestSaveWithoutAuthExits(t *testing.T) {
 		t.Fatalf("expected exit code 1, got %d", code)
 	}
 }
+
+func TestUseReadsNameFromStdin(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_MP_CONFIG", filepath.Join(home, "config.json"))
+
+	if err := os.MkdirAll(filepath.Join(home, "profiles"), 0700); err != nil {
+		t.Fatalf("failed to create profiles dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "profiles", "work.json"), []byte(`{"token":"w"}`), 0600); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+
+	input := filepath.Join(home, "stdin")
+	if err := os.WriteFile(input, []byte("\nwork\n"), 0600); err != nil {
+		t.Fatalf("failed to write stdin: %v", err)
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		t.Fatalf("failed to open stdin: %v", err)
+	}
+	defer f.Close()
+
+	originalStdin := stdin
+	stdin = f
+	defer func() { stdin = originalStdin }()
+
+	rootCmd.SetArgs([]string{"use", "--stdin"})
+	defer useCmd.Flags().Set("stdin", "false")
+	code := runAndCaptureExit(t, func() {
+		_ = rootCmd.Execute()
+	})
+	if code != -1 {
+		t.Fatalf("expected use to succeed, got exit code %d", code)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(home, "auth.json"))
+	if err != nil || string(raw) != `{"token":"w"}` {
+		t.Fatalf("expected work auth installed, got %q (%v)", raw, err)
+	}
+}
+
+func TestUseWithEmptyStdinExits(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_MP_CONFIG", filepath.Join(home, "config.json"))
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", os.DevNull, err)
+	}
+	defer f.Close()
+
+	originalStdin := stdin
+	stdin = f
+	defer func() { stdin = originalStdin }()
+
+	rootCmd.SetArgs([]string{"use", "--stdin"})
+	defer useCmd.Flags().Set("stdin", "false")
+	code := runAndCaptureExit(t, func() {
+		_ = rootCmd.Execute()
+	})
+	if code != 1 {
+		t.Fatalf("expected exit code 1, got %d", code)
+	}
+}
+
+func TestUseDashSwitchesBackWithoutTerminal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_MP_CONFIG", filepath.Join(home, "config.json"))
+	os.MkdirAll(filepath.Join(home, "profiles"), 0700)
+	os.WriteFile(filepath.Join(home, "profiles", "work.json"), []byte(`{"token":"w"}`), 0600)
+	os.WriteFile(filepath.Join(home, "profiles", "home.json"), []byte(`{"token":"h"}`), 0600)
+
+	// As from cron: stdin is not a terminal, and - still means the previous profile.
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", os.DevNull, err)
+	}
+	defer f.Close()
+	originalStdin := stdin
+	stdin = f
+	defer func() { stdin = originalStdin }()
+
+	for _, args := range [][]string{{"use", "work"}, {"use", "home"}, {"use", "-"}} {
+		rootCmd.SetArgs(args)
+		if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != -1 {
+			t.Fatalf("%v: expected success, got exit code %d", args, code)
+		}
+	}
+	raw, _ := os.ReadFile(filepath.Join(home, "auth.json"))
+	if string(raw) != `{"token":"w"}` {
+		t.Fatalf("expected use - to switch back to work, got %q", raw)
+	}
+}
+
+func TestAddKeyReadsKeyFromStdin(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_MP_CONFIG", filepath.Join(home, "config.json"))
+
+	input := filepath.Join(home, "stdin")
+	if err := os.WriteFile(input, []byte("sk-test-abcdef123456\n"), 0600); err != nil {
+		t.Fatalf("failed to write stdin: %v", err)
+	}
+	f, err := os.Open(input)
+	if err != nil {
+		t.Fatalf("failed to open stdin: %v", err)
+	}
+	defer f.Close()
+
+	originalStdin := stdin
+	stdin = f
+	defer func() { stdin = originalStdin }()
+
+	rootCmd.SetArgs([]string{"add-key", "ci", "sk-on-argv"})
+	if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != 1 {
+		t.Fatalf("expected a key argument to be refused, got exit code %d", code)
+	}
+
+	rootCmd.SetArgs([]string{"add-key", "ci"})
+	if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != -1 {
+		t.Fatalf("expected add-key to succeed, got exit code %d", code)
+	}
+	raw, err := os.ReadFile(filepath.Join(home, "profiles", "ci.json"))
+	if err != nil || !strings.Contains(string(raw), `"OPENAI_API_KEY": "sk-test-abcdef123456"`) {
+		t.Fatalf("expected key saved, got %q (%v)", raw, err)
+	}
+}
+
+func TestEnvAndExecRequireReveal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_MP_CONFIG", filepath.Join(home, "config.json"))
+	os.MkdirAll(filepath.Join(home, "profiles"), 0700)
+	os.WriteFile(filepath.Join(home, "profiles", "ci.json"), []byte(`{"OPENAI_API_KEY":"sk-it's"}`), 0600)
+
+	for _, args := range [][]string{
+		{"env", "ci"},
+		{"exec", "ci", "--", "true"},
+	} {
+		rootCmd.SetArgs(args)
+		if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != 1 {
+			t.Fatalf("%v: expected refusal without --reveal, got exit code %d", args, code)
+		}
+	}
+
+	rootCmd.SetArgs([]string{"exec", "ci", "--reveal", "--", "sh", "-c", `test "$OPENAI_API_KEY" = "sk-it's" || exit 3`})
+	if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != -1 {
+		t.Fatalf("expected the key in the command's environment, got exit code %d", code)
+	}
+	rootCmd.SetArgs([]string{"exec", "ci", "--reveal", "--", "sh", "-c", "exit 7"})
+	if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != 7 {
+		t.Fatalf("expected the command's exit code, got %d", code)
+	}
+
+	env := map[string]string{"OPENAI_API_KEY": "sk-it's"}
+	for shell, want := range map[string]string{
+		"bash":   `export OPENAI_API_KEY='sk-it'\''s'` + "\n",
+		"fish":   `set -gx OPENAI_API_KEY 'sk-it\'s'` + "\n",
+		"dotenv": `OPENAI_API_KEY="sk-it's"` + "\n",
+		"json":   `{"OPENAI_API_KEY":"sk-it's"}` + "\n",
+	} {
+		if got := formatEnv(env, shell); got != want {
+			t.Fatalf("%s: expected %q, got %q", shell, want, got)
+		}
+	}
+}
+
+func TestAutoSwitchesOnlyWhenScheduleDiffers(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_MP_CONFIG", filepath.Join(home, "config.json"))
+	os.MkdirAll(filepath.Join(home, "profiles"), 0700)
+	os.WriteFile(filepath.Join(home, "profiles", "acme.json"), []byte(`{"token":"a"}`), 0600)
+	os.WriteFile(filepath.Join(home, "config.json"), []byte(`{"schedule":[{"profile":"acme","days":["mon-fri"]}]}`), 0600)
+
+	rootCmd.SetArgs([]string{"auto", "--at", "2026-03-07T12:00:00Z"}) // Saturday
+	if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != -1 {
+		t.Fatalf("expected auto without a matching rule to succeed, got exit code %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(home, "auth.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected no switch without a matching rule, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rootCmd.SetArgs([]string{"auto", "--at", "2026-03-06T12:00:00Z"})
+		if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != -1 {
+			t.Fatalf("run %d: expected auto to succeed, got exit code %d", i+1, code)
+		}
+	}
+	raw, err := os.ReadFile(filepath.Join(home, "auth.json"))
+	if err != nil || string(raw) != `{"token":"a"}` {
+		t.Fatalf("expected acme installed, got %q (%v)", raw, err)
+	}
+	// The second run found acme active and left the store alone.
+	events, _ := os.ReadFile(filepath.Join(home, ".codex-mp-events.jsonl"))
+	if n := strings.Count(string(events), `"type":"switched"`); n != 1 {
+		t.Fatalf("expected exactly one switch, got %d in %s", n, events)
+	}
+}
+
+func TestDeletePatternRunsAsOneBatch(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CODEX_HOME", home)
+	t.Setenv("CODEX_MP_CONFIG", filepath.Join(home, "config.json"))
+	profiles := filepath.Join(home, "profiles")
+	os.MkdirAll(filepath.Join(profiles, "old"), 0700)
+	for _, name := range []string{"old/a", "old/b", "keep"} {
+		os.WriteFile(filepath.Join(profiles, name+".json"), []byte(`{"token":"x"}`), 0600)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(profiles, name+".json"))
+		return err == nil
+	}
+
+	rootCmd.SetArgs([]string{"delete", "old/*", "--dry-run"})
+	defer deleteCmd.Flags().Set("dry-run", "false")
+	if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != -1 || !exists("old/a") || !exists("old/b") {
+		t.Fatalf("expected the dry run to succeed without deleting, got exit code %d", code)
+	}
+	deleteCmd.Flags().Set("dry-run", "false")
+
+	rootCmd.SetArgs([]string{"delete", "old/*"})
+	if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != -1 || exists("old/a") || exists("old/b") || !exists("keep") {
+		t.Fatalf("expected both matches deleted, got exit code %d", code)
+	}
+
+	// One batch is one undo entry.
+	rootCmd.SetArgs([]string{"undo"})
+	if code := runAndCaptureExit(t, func() { _ = rootCmd.Execute() }); code != -1 || !exists("old/a") || !exists("old/b") {
+		t.Fatalf("expected a single undo to restore both, got exit code %d", code)
+	}
+}
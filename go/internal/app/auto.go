@@ -0,0 +1,94 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var autoCmd = &cobra.Command{
+	Use:   "auto",
+	Short: "Switch to the profile the schedule selects",
+	Long: "Switch to the profile selected by the schedule rules in the config file, the first matching " +
+		"one winning, but only if it is not already active. Running auto again changes nothing, so it is " +
+		"safe to run every few minutes from cron or a systemd timer:\n\n" +
+		"  \"schedule\": [\n" +
+		"    {\"profile\": \"acme\", \"days\": [\"mon-fri\"], \"from\": \"09:00\", \"to\": \"17:30\"},\n" +
+		"    {\"profile\": \"night-batch\", \"cron\": \"* 0-5 * * *\"},\n" +
+		"    {\"profile\": \"personal\"}\n" +
+		"  ]\n\n" +
+		"A window whose to is before its from spans midnight; a rule without days, times or cron always " +
+		"matches. auto does not switch while auth.json has drifted from the active profile, e.g. after " +
+		"a codex login, since that would save the other login into it.",
+	Example: "  */5 * * * * codex-mp auto   # crontab\n" +
+		"  codex-mp auto --at 2026-03-02T18:00:00+01:00 --dry-run",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			fail("Usage: codex-mp auto [--at time] [--dry-run]")
+		}
+		paths := resolvePaths()
+		now := time.Now()
+		if at, _ := cmd.Flags().GetString("at"); at != "" {
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				fail("invalid --at: %s (use RFC 3339, e.g. 2026-03-02T18:00:00+01:00)", at)
+			}
+			now = t
+		}
+
+		if err := profile.ValidateSchedule(paths); err != nil {
+			fail(err.Error())
+		}
+		name, rule, err := profile.Scheduled(paths, now)
+		if err != nil {
+			fail(err.Error())
+		}
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		report := func(switched bool, msg string) {
+			if jsonOutput {
+				json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "action": "auto", "profile": name, "rule": rule, "switched": switched})
+				return
+			}
+			fmt.Println(msg)
+		}
+		if name == "" {
+			report(false, "No schedule rule matches; nothing to do.")
+			return
+		}
+		if name, err = profile.ResolveAlias(name, paths); err != nil {
+			fail(err.Error())
+		}
+
+		cur, err := profile.CurrentProfile(paths)
+		if err != nil {
+			fail(err.Error())
+		}
+		if cur.Drift {
+			fail("auth.json no longer belongs to the active profile %s; not switching automatically (save or use a profile first)", cur.Name)
+		}
+		if cur.Name == name && cur.LoggedIn {
+			report(false, fmt.Sprintf("Already on %s (schedule rule %d).", name, rule))
+			return
+		}
+
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpUse, Name: name}) {
+			return
+		}
+		plan, err := profile.Apply(profile.Operation{Op: profile.OpUse, Name: name}, paths, false)
+		if err != nil {
+			fail(err.Error())
+		}
+		warnPolicy(plan.Policy)
+		report(true, fmt.Sprintf("⚡ Switched -> %s%s (schedule rule %d)", name, targetSuffix(paths), rule))
+	},
+}
+
+func init() {
+	autoCmd.Flags().String("at", "", "Evaluate the schedule at this time instead of now")
+	dryRunFlag(autoCmd)
+	rootCmd.AddCommand(autoCmd)
+}
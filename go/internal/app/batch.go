@@ -0,0 +1,121 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch [-f ops.jsonl]",
+	Short: "Apply a list of operations as one transaction",
+	Long: "Read operations, one JSON object per line, from a file or stdin and apply them under a single lock. " +
+		"If any operation fails, the ones before it are rolled back and the rest are skipped.\n\n" +
+		"Operations:\n" +
+		`  {"op":"save","name":"work"}` + "\n" +
+		`  {"op":"use","name":"work"}` + "\n" +
+		`  {"op":"rename","from":"old","to":"new"}` + "\n" +
+		`  {"op":"copy","from":"work","to":"work-scratch"}` + "\n" +
+		`  {"op":"delete","name":"old"}` + "\n" +
+		`  {"op":"delete","name":"leaked","purge":true}` + "\n" +
+		`  {"op":"restore","name":"old","to":"old-2"}` + "\n" +
+		`  {"op":"tag","name":"work","tags":["prod"]}` + "\n" +
+		`  {"op":"alias","name":"w","to":"work"}` + "\n" +
+		`  {"op":"unalias","name":"w"}` + "\n" +
+		`  {"op":"default","name":"work"}` + "\n" +
+		`  {"op":"catalog-add","name":"platform","dir":"/mnt/platform/profiles"}` + "\n" +
+		`  {"op":"catalog-remove","name":"platform"}` + "\n" +
+		`  {"op":"target-add","name":"ci","dir":"/srv/ci/.codex"}` + "\n" +
+		`  {"op":"target-remove","name":"ci"}` + "\n\n" +
+		"add-key and login are not available in a batch: they need a key or a login command.",
+	Example: "  codex-mp batch -f onboarding.jsonl --dry-run\n" +
+		"  codex-mp batch --json < onboarding.jsonl",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			fail("Usage: codex-mp batch [-f ops.jsonl] [--dry-run]")
+		}
+
+		var in io.Reader = stdin
+		if file, _ := cmd.Flags().GetString("file"); file != "" && file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				fail("failed to open %s: %v", file, err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		ops, err := profile.ParseBatch(in)
+		if err != nil {
+			fail(err.Error())
+		}
+		if len(ops) == 0 {
+			fail("no operations to apply")
+		}
+
+		paths := resolvePaths()
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		results, batchErr := profile.Batch(ops, paths, dryRun)
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			out := map[string]any{
+				"ok":      batchErr == nil,
+				"action":  "batch",
+				"dry_run": dryRun,
+				"results": results,
+			}
+			if batchErr != nil {
+				out["error"] = batchErr.Error()
+			}
+			json.NewEncoder(os.Stdout).Encode(out)
+		} else {
+			for _, r := range results {
+				fmt.Printf("  %s %s\n", batchMark(r.Status), describeOp(r))
+			}
+		}
+
+		if batchErr != nil {
+			if jsonOutput {
+				exitFunc(1)
+				return
+			}
+			fail(batchErr.Error())
+		}
+	},
+}
+
+func batchMark(status string) string {
+	switch status {
+	case profile.BatchApplied:
+		return "✓"
+	case profile.BatchPlanned:
+		return "·"
+	case profile.BatchFailed:
+		return "✗"
+	case profile.BatchRolledBack:
+		return "↺"
+	}
+	return "-"
+}
+
+func describeOp(r profile.BatchResult) string {
+	desc := r.Operation.String()
+	if r.Status != profile.BatchApplied && r.Status != profile.BatchPlanned {
+		desc += "  (" + r.Status + ")"
+	}
+	if r.Error != "" {
+		desc += ": " + r.Error
+	}
+	return desc
+}
+
+func init() {
+	batchCmd.Flags().StringP("file", "f", "", "Read operations from this file instead of stdin")
+	batchCmd.Flags().Bool("dry-run", false, "Show what would happen without changing anything")
+	rootCmd.AddCommand(batchCmd)
+}
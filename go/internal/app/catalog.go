@@ -0,0 +1,116 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Subscribe to shared, read-only profile directories",
+	Long: "A catalog is a directory of profiles provisioned by someone else, e.g. a mounted share with API-key " +
+		"profiles for service accounts. Its profiles are listed as managed entries under the catalog name " +
+		"(platform/ci-bot) and can be used, but not saved over, renamed or deleted. " +
+		"Switching away from one never copies auth.json back into the catalog.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var catalogListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List catalogs",
+	Run: func(cmd *cobra.Command, args []string) {
+		catalogs, err := profile.Catalogs(resolvePaths())
+		if err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			if catalogs == nil {
+				catalogs = []profile.Catalog{}
+			}
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "catalogs": catalogs})
+			return
+		}
+
+		if len(catalogs) == 0 {
+			fmt.Println("No catalogs.")
+			return
+		}
+		for _, c := range catalogs {
+			missing := ""
+			if !c.Exists {
+				missing = "  (missing)"
+			}
+			fmt.Printf("  %s  %s%s\n", c.Name, c.Dir, missing)
+		}
+	},
+}
+
+var catalogAddCmd = &cobra.Command{
+	Use:     "add <name> <dir>",
+	Short:   "Subscribe to a catalog directory",
+	Example: "  codex-mp catalog add platform /mnt/platform/codex-profiles",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			fail("Usage: codex-mp catalog add <name> <dir>")
+		}
+		name := args[0]
+		dir, err := filepath.Abs(args[1])
+		if err != nil {
+			fail("invalid directory: %v", err)
+		}
+		paths := resolvePaths()
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpCatalogAdd, Name: name, Dir: dir}) {
+			return
+		}
+		if err := profile.AddCatalog(name, dir, paths); err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "action": "catalog-add", "catalog": name, "dir": dir})
+		} else {
+			fmt.Printf("✓ Catalog %s -> %s\n", name, dir)
+		}
+	},
+}
+
+var catalogRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Unsubscribe from a catalog",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fail("Usage: codex-mp catalog remove <name>")
+		}
+		paths := resolvePaths()
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpCatalogRemove, Name: args[0]}) {
+			return
+		}
+		if err := profile.RemoveCatalog(args[0], paths); err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "action": "catalog-remove", "catalog": args[0]})
+		} else {
+			fmt.Printf("✗ Removed catalog: %s\n", args[0])
+		}
+	},
+}
+
+func init() {
+	dryRunFlag(catalogAddCmd)
+	dryRunFlag(catalogRemoveCmd)
+	catalogCmd.AddCommand(catalogListCmd, catalogAddCmd, catalogRemoveCmd)
+	rootCmd.AddCommand(catalogCmd)
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var copyCmd = &cobra.Command{
+	Use:     "copy <src> <dst>",
+	Aliases: []string{"cp"},
+	Short:   "Copy a profile under a new name",
+	Long:    "Save a copy of a profile, e.g. as a scratch copy before experimenting. Tags are copied too.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			fail("Usage: codex-mp copy <src> <dst>")
+		}
+		paths := resolvePaths()
+		src := profileArg(args[0], paths)
+		dst := args[1]
+
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpCopy, From: src, To: dst}) {
+			return
+		}
+		if err := profile.Copy(src, dst, paths); err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			fmt.Printf(`{"ok":true,"action":"copy","src":"%s","dst":"%s"}`+"\n", src, dst)
+		} else {
+			fmt.Printf("✓ Copied: %s → %s\n", src, dst)
+		}
+	},
+}
+
+func init() {
+	dryRunFlag(copyCmd)
+	rootCmd.AddCommand(copyCmd)
+}
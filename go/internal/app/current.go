@@ -0,0 +1,55 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+const defaultCurrentFormat = `{{.Name}}{{if .Drift}}*{{end}}`
+
+var currentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Print the active profile (fast, for prompts)",
+	Long: "Print the active profile without scanning profiles. It only takes a shared lock, so it never waits " +
+		"for other readers, only briefly for a command that is changing profiles.\n\n" +
+		"A trailing * (or .Drift in --format) means auth.json now belongs to a different account than the active marker says. " +
+		"Template fields: .Name .Target .Fingerprint .LoggedIn .Drift",
+	Example: "  codex-mp current\n  codex-mp current --format '{{.Name}}@{{.Target}}'",
+	Run: func(cmd *cobra.Command, args []string) {
+		paths := resolvePaths()
+
+		cur, err := profile.CurrentProfile(paths)
+		if err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":      true,
+				"current": cur,
+			})
+			return
+		}
+
+		format, _ := cmd.Flags().GetString("format")
+		tmpl, err := template.New("current").Parse(format)
+		if err != nil {
+			fail("invalid --format: %v", err)
+		}
+		if err := tmpl.Execute(os.Stdout, cur); err != nil {
+			fail("failed to render --format: %v", err)
+		}
+		fmt.Println()
+	},
+}
+
+func init() {
+	currentCmd.Flags().String("format", defaultCurrentFormat, "Go template for the output")
+	rootCmd.AddCommand(currentCmd)
+}
@@ -1,37 +1,98 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
-	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/BigCactusLabs/codex-multipass/internal/profile"
 	"github.com/spf13/cobra"
 )
 
 var deleteCmd = &cobra.Command{
-	Use:   "delete <name>",
+	Use:   "delete <name|pattern>",
 	Short: "Delete a profile",
+	Long: "Deleted profiles go to the trash (see codex-mp trash); --purge overwrites and removes them for good instead.\n\n" +
+		"Pass - to read the profile name from stdin. A glob pattern deletes every matching profile as one " +
+		"batch: if any delete fails, none happen, and undo reverts them together. Quote the pattern so the " +
+		"shell doesn't expand it.",
+	Example: "  codex-mp delete old-work\n" +
+		"  codex-mp delete 'old/*'\n" +
+		"  codex-mp delete leaked --purge",
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) != 1 {
-			fail("Usage: codex-mp delete <name>")
+			fail("Usage: codex-mp delete <name|pattern>")
+		}
+		paths := resolvePaths()
+		name := nameArg(args[0])
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		purge, _ := cmd.Flags().GetBool("purge")
+		remove, verb := profile.Delete, "Deleted"
+		if purge {
+			remove, verb = profile.Purge, "Purged"
+		}
+
+		if profile.IsPattern(name) {
+			names, err := profile.Match(name, paths)
+			if err != nil {
+				fail(err.Error())
+			}
+			if len(names) == 0 {
+				fail("no profiles match %s", name)
+			}
+			ops := make([]profile.Operation, len(names))
+			for i, n := range names {
+				ops[i] = profile.Operation{Op: profile.OpDelete, Name: n, Purge: purge}
+			}
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			results, err := profile.Batch(ops, paths, dryRun)
+			if err != nil {
+				fail(err.Error())
+			}
+			switch {
+			case jsonOutput:
+				json.NewEncoder(os.Stdout).Encode(map[string]any{
+					"ok":       true,
+					"action":   "delete",
+					"profiles": names,
+					"purged":   purge,
+					"dry_run":  dryRun,
+					"results":  results,
+				})
+			case dryRun:
+				fmt.Printf("Plan: delete %s (dry run)\n", name)
+				for _, r := range results {
+					fmt.Printf("  %s %s\n", batchMark(r.Status), describeOp(r))
+				}
+			default:
+				for _, n := range names {
+					fmt.Printf("✗ %s profile: %s\n", verb, n)
+				}
+			}
+			return
 		}
-		name := args[0]
 
-		paths := config.ResolvePaths()
-		err := profile.Delete(name, paths)
+		name, err := profile.ResolveAlias(name, paths)
 		if err != nil {
 			fail(err.Error())
 		}
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpDelete, Name: name, Purge: purge}) {
+			return
+		}
+		if err := remove(name, paths); err != nil {
+			fail(err.Error())
+		}
 
-		jsonOutput, _ := cmd.Flags().GetBool("json")
 		if jsonOutput {
-			fmt.Printf(`{"ok":true,"action":"delete","profile":"%s"}`+"\n", name)
+			fmt.Printf(`{"ok":true,"action":"delete","profile":"%s","purged":%t}`+"\n", name, purge)
 		} else {
-			fmt.Printf("✗ Deleted profile: %s\n", name)
+			fmt.Printf("✗ %s profile: %s\n", verb, name)
 		}
 	},
 }
 
 func init() {
+	deleteCmd.Flags().Bool("purge", false, "Overwrite and remove the profile instead of moving it to the trash")
+	dryRunFlag(deleteCmd)
 	rootCmd.AddCommand(deleteCmd)
 }
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <a> [b]",
+	Short: "Compare two profiles without showing secrets",
+	Long: "Compare two profiles, or a profile and the live auth.json when b is omitted. " +
+		"Shows decoded identities, which keys differ (never their values) and a verdict: " +
+		"identical, same-generation (same account and refresh token), same-account, or unrelated.",
+	Example: "  codex-mp diff work work-scratch\n" +
+		"  codex-mp diff work",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 || len(args) > 2 {
+			fail("Usage: codex-mp diff <a> [b]")
+		}
+		paths := resolvePaths()
+		a := profileArg(args[0], paths)
+		b := ""
+		if len(args) == 2 {
+			b = profileArg(args[1], paths)
+		}
+
+		cmp, err := profile.Diff(a, b, paths)
+		if err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":   true,
+				"diff": cmp,
+			})
+			return
+		}
+
+		fmt.Println("")
+		fmt.Printf("  %-10s %-28s %s\n", "", cmp.A, cmp.B)
+		fmt.Println("  ----------------------------")
+		row := func(label, a, b string) {
+			if a == "" && b == "" {
+				return
+			}
+			fmt.Printf("  %-10s %-28s %s\n", label, orDash(a), orDash(b))
+		}
+		ia, ib := cmp.IdentityA, cmp.IdentityB
+		row("Mode", ia.Mode, ib.Mode)
+		row("Email", ia.Email, ib.Email)
+		row("Account", ia.AccountID, ib.AccountID)
+		row("Plan", ia.Plan, ib.Plan)
+		row("Refreshed", formatTime(ia.LastRefresh), formatTime(ib.LastRefresh))
+		row("Expires", formatTime(ia.ExpiresAt), formatTime(ib.ExpiresAt))
+
+		fmt.Println("")
+		marks := map[string]string{
+			profile.KeyEqual:   "=",
+			profile.KeyChanged: "~",
+			profile.KeyOnlyA:   "-",
+			profile.KeyOnlyB:   "+",
+		}
+		for _, k := range cmp.Keys {
+			switch k.Change {
+			case profile.KeyOnlyA:
+				fmt.Printf("  %s %s  (only in %s)\n", marks[k.Change], k.Key, cmp.A)
+			case profile.KeyOnlyB:
+				fmt.Printf("  %s %s  (only in %s)\n", marks[k.Change], k.Key, cmp.B)
+			default:
+				fmt.Printf("  %s %s\n", marks[k.Change], k.Key)
+			}
+		}
+
+		fmt.Println("")
+		fmt.Printf("  Verdict: %s", cmp.Verdict)
+		if cmp.Newer != "" {
+			fmt.Printf(" (%s is newer)", cmp.Newer)
+		}
+		fmt.Println("")
+		fmt.Println("")
+	},
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
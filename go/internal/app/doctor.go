@@ -0,0 +1,60 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check storage, permissions and symlinks",
+	Long: "Inspect the profile store without changing it. Reports directory and file permissions, " +
+		"what the configured symlink_policy will do to a symlinked auth.json or profile, and a stale active marker.\n\n" +
+		"Exits 1 if any check fails.",
+	Run: func(cmd *cobra.Command, args []string) {
+		paths := resolvePaths()
+
+		checks, err := profile.Doctor(paths)
+		if err != nil {
+			fail(err.Error())
+		}
+
+		healthy := true
+		for _, c := range checks {
+			if c.Status == profile.CheckFail {
+				healthy = false
+			}
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":     healthy,
+				"checks": checks,
+			})
+		} else {
+			for _, c := range checks {
+				mark := "✓"
+				switch c.Status {
+				case profile.CheckWarn:
+					mark = "!"
+				case profile.CheckFail:
+					mark = "✗"
+				}
+				fmt.Printf("%s %s: %s\n", mark, c.Name, c.Detail)
+			}
+		}
+
+		if !healthy {
+			exitFunc(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env <name> --reveal",
+	Short: "Print a profile's API key as environment variables",
+	Long: "Print export statements for tools that read OPENAI_API_KEY rather than auth.json. " +
+		"Only API-key profiles can be exported. Since this prints a secret, --reveal is required, " +
+		"and a warning is shown when stdout is a terminal. To pass the key to one command without " +
+		"printing it, use codex-mp exec.",
+	Example: "  eval \"$(codex-mp env ci-bot --reveal)\"\n" +
+		"  codex-mp env ci-bot --reveal --shell fish | source\n" +
+		"  codex-mp env ci-bot --reveal --shell dotenv > .env",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fail("Usage: codex-mp env <name> --reveal [--shell bash|fish|dotenv|json]")
+		}
+		shell, _ := cmd.Flags().GetString("shell")
+		if _, ok := envFormats[shell]; !ok {
+			fail("unknown --shell %s (allowed: bash, fish, dotenv, json)", shell)
+		}
+		requireReveal(cmd)
+		paths := resolvePaths()
+		name := profileArg(args[0], paths)
+
+		env, err := profile.Env(name, paths)
+		if err != nil {
+			fail(err.Error())
+		}
+		if isTerminal(os.Stdout) {
+			fmt.Fprintln(os.Stderr, "Warning: printing a secret to the terminal; it may end up in scrollback or logs.")
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "action": "env", "profile": name, "env": env})
+			return
+		}
+		fmt.Print(formatEnv(env, shell))
+	},
+}
+
+// requireReveal fails unless --reveal was passed to a command that exposes a secret.
+func requireReveal(cmd *cobra.Command) {
+	if reveal, _ := cmd.Flags().GetBool("reveal"); !reveal {
+		fail("%s exposes the profile's API key; pass --reveal to confirm", cmd.Name())
+	}
+}
+
+// envFormats renders one variable per shell, with the value quoted for it.
+var envFormats = map[string]func(k, v string) string{
+	"bash": func(k, v string) string {
+		return fmt.Sprintf("export %s='%s'\n", k, strings.ReplaceAll(v, "'", `'\''`))
+	},
+	"fish": func(k, v string) string {
+		v = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+		return fmt.Sprintf("set -gx %s '%s'\n", k, v)
+	},
+	"dotenv": func(k, v string) string {
+		v = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`).Replace(v)
+		return fmt.Sprintf("%s=\"%s\"\n", k, v)
+	},
+	"json": nil,
+}
+
+// formatEnv renders env for shell, sorted by name.
+func formatEnv(env map[string]string, shell string) string {
+	if shell == "json" {
+		data, _ := json.Marshal(env)
+		return string(data) + "\n"
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(envFormats[shell](k, env[k]))
+	}
+	return b.String()
+}
+
+func init() {
+	envCmd.Flags().String("shell", "bash", "Output format: bash, fish, dotenv or json")
+	envCmd.Flags().Bool("reveal", false, "Confirm printing the API key")
+	rootCmd.AddCommand(envCmd)
+}
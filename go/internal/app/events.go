@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Stream profile changes as JSON lines",
+	Long: "Print one JSON object per line for every change to the target's profiles as it happens, until interrupted.\n\n" +
+		"Changes made by codex-mp (switched, saved, deleted, renamed, copied, tagged, restored, synced, undone) " +
+		"are read from the event journal, which every mutating command appends to while it holds the lock. " +
+		"Any other change to auth.json or the active profile, such as a `codex login`, is reported as " +
+		"external-change-detected, with drift set when auth.json no longer belongs to the active profile's account.",
+	Example: "  codex-mp events\n" +
+		"  codex-mp events --replay | jq -r 'select(.type == \"switched\") | .profile'",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			fail("Usage: codex-mp events [--replay]")
+		}
+		paths := resolvePaths()
+		replay, _ := cmd.Flags().GetBool("replay")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		watcher, err := profile.WatchEvents(ctx, paths, replay)
+		if err != nil {
+			fail(err.Error())
+		}
+		enc := json.NewEncoder(os.Stdout)
+		err = watcher.Run(func(ev profile.Event) error {
+			return enc.Encode(ev)
+		})
+		if err != nil {
+			fail(err.Error())
+		}
+	},
+}
+
+func init() {
+	eventsCmd.Flags().Bool("replay", false, "Print the events still in the journal first")
+	rootCmd.AddCommand(eventsCmd)
+}
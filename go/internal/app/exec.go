@@ -0,0 +1,53 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec <name> --reveal -- <command> [args...]",
+	Short: "Run a command with a profile's API key in its environment",
+	Long: "Run a command with the environment variables of codex-mp env set, without printing them " +
+		"or switching the active profile. Since the command can read the API key, --reveal is required. " +
+		"The exit code of the command is passed through.",
+	Example: "  codex-mp exec ci-bot --reveal -- python eval.py",
+	Run: func(cmd *cobra.Command, args []string) {
+		if cmd.ArgsLenAtDash() != 1 || len(args) < 2 {
+			fail("Usage: codex-mp exec <name> --reveal -- <command> [args...]")
+		}
+		requireReveal(cmd)
+		paths := resolvePaths()
+		name := profileArg(args[0], paths)
+		enforcePolicy(name, "exec", paths)
+
+		env, err := profile.Env(name, paths)
+		if err != nil {
+			fail(err.Error())
+		}
+
+		child := exec.Command(args[1], args[2:]...)
+		child.Env = os.Environ()
+		for k, v := range env {
+			child.Env = append(child.Env, k+"="+v)
+		}
+		child.Stdin, child.Stdout, child.Stderr = stdin, os.Stdout, os.Stderr
+		if err := child.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+				exitFunc(exitErr.ExitCode())
+				panic(exitSignal{Code: exitErr.ExitCode()})
+			}
+			fail("failed to run %s: %v", args[1], err)
+		}
+	},
+}
+
+func init() {
+	execCmd.Flags().Bool("reveal", false, "Confirm passing the API key to the command")
+	rootCmd.AddCommand(execCmd)
+}
@@ -3,7 +3,6 @@ package app
 import (
 	"fmt"
 
-	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/BigCactusLabs/codex-multipass/internal/profile"
 	"github.com/spf13/cobra"
 )
@@ -12,11 +11,17 @@ var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Set up profiles directory",
 	Run: func(cmd *cobra.Command, args []string) {
-		paths := config.ResolvePaths()
+		paths := resolvePaths()
 
-		if err := profile.EnsureInitialized(paths); err != nil {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		plan, err := profile.Initialize(paths, dryRun)
+		if err != nil {
 			fail("%v", err)
 		}
+		if dryRun {
+			reportPlan(cmd, "initialize "+paths.ProfilesDir, plan)
+			return
+		}
 
 		jsonOutput, _ := cmd.Flags().GetBool("json")
 		if jsonOutput {
@@ -28,5 +33,6 @@ var initCmd = &cobra.Command{
 }
 
 func init() {
+	dryRunFlag(initCmd)
 	rootCmd.AddCommand(initCmd)
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"strings"
 
 	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/BigCactusLabs/codex-multipass/internal/profile"
@@ -11,17 +13,52 @@ import (
 )
 
 var listCmd = &cobra.Command{
-	Use:   "list",
+	Use:   "list [pattern]",
 	Short: "List saved profiles",
+	Long:  "List saved profiles as a tree of groups. An optional glob pattern filters by name; * does not cross /.",
+	Example: "  codex-mp list\n" +
+		"  codex-mp list 'acme/*'",
 	Run: func(cmd *cobra.Command, args []string) {
-		paths := config.ResolvePaths()
+		if len(args) > 1 {
+			fail("Usage: codex-mp list [pattern]")
+		}
+		paths := resolvePaths()
 
 		profiles, err := profile.List(paths)
 		if err != nil {
 			fail(err.Error())
 		}
+		if len(args) == 1 {
+			profiles = filterProfiles(profiles, args[0])
+		}
+
+		targets, err := config.ResolveTargets()
+		if err != nil {
+			fail(err.Error())
+		}
+		if len(targets) > 1 {
+			active, err := profile.ActiveTargets(targets)
+			if err != nil {
+				fail(err.Error())
+			}
+			for i := range profiles {
+				for _, t := range targets {
+					if active[t.Target] == profiles[i].Name {
+						profiles[i].Targets = append(profiles[i].Targets, t.Target)
+					}
+				}
+			}
+		}
 
 		jsonOutput, _ := cmd.Flags().GetBool("json")
+		namesOnly, _ := cmd.Flags().GetBool("names")
+		if namesOnly && !jsonOutput {
+			for _, p := range profiles {
+				fmt.Println(p.Name)
+			}
+			return
+		}
+
 		if jsonOutput {
 			out := map[string]any{
 				"ok":       true,
@@ -32,23 +69,66 @@ var listCmd = &cobra.Command{
 			fmt.Println("")
 			fmt.Println("  Profiles")
 			fmt.Println("  ----------------------------")
-			for _, p := range profiles {
-				short := ""
-				if len(p.Fingerprint) >= 12 {
-					short = p.Fingerprint[:12]
-				}
-
-				if p.Active {
-					fmt.Printf("  ▸ %s  %s  active\n", p.Name, short)
-				} else {
-					fmt.Printf("    %s  %s\n", p.Name, short)
-				}
-			}
+			printTree(profiles)
 			fmt.Println("")
 		}
 	},
 }
 
+// filterProfiles keeps the profiles whose names match a glob pattern.
+func filterProfiles(profiles []profile.ProfileStatus, pattern string) []profile.ProfileStatus {
+	if _, err := path.Match(pattern, ""); err != nil {
+		fail("invalid pattern: %s", pattern)
+	}
+	var matched []profile.ProfileStatus
+	for _, p := range profiles {
+		if ok, _ := path.Match(pattern, p.Name); ok {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+// printTree prints profiles under a header line per group, indenting one level per "/".
+// Profiles arrive sorted, so the members of a group are contiguous.
+func printTree(profiles []profile.ProfileStatus) {
+	var prev []string
+	for _, p := range profiles {
+		parts := strings.Split(p.Name, "/")
+		groups, leaf := parts[:len(parts)-1], parts[len(parts)-1]
+
+		common := 0
+		for common < len(groups) && common < len(prev) && groups[common] == prev[common] {
+			common++
+		}
+		for i := common; i < len(groups); i++ {
+			fmt.Printf("    %s%s/\n", strings.Repeat("  ", i), groups[i])
+		}
+		prev = groups
+		indent := strings.Repeat("  ", len(groups))
+
+		short := ""
+		if len(p.Fingerprint) >= 12 {
+			short = p.Fingerprint[:12]
+		}
+
+		where := ""
+		if len(p.Targets) > 0 {
+			where = fmt.Sprintf("  [%s]", strings.Join(p.Targets, ", "))
+		}
+		if p.Managed {
+			where += "  (managed)"
+		}
+
+		if p.Active {
+			fmt.Printf("  %s▸ %s  %s  active%s\n", indent, leaf, short, where)
+		} else {
+			fmt.Printf("    %s%s  %s%s\n", indent, leaf, short, where)
+		}
+	}
+}
+
 func init() {
+	listCmd.Flags().Bool("names", false, "Print only profile names, one per line")
 	rootCmd.AddCommand(listCmd)
 }
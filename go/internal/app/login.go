@@ -0,0 +1,60 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/BigCactusLabs/codex-multipass/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login <name> [--force] [--dry-run] [-- login-args...]",
+	Short: "Log in to a new account and save it as a profile",
+	Long: "Run codex login in an isolated, temporary CODEX_HOME and save the login as a profile. " +
+		"The active profile is synced first and auth.json is left as it was, so logging in to " +
+		"another account never clobbers the one in use. Arguments after -- are passed to the " +
+		"login command. An existing profile is only replaced with --force. --dry-run shows the sync-back " +
+		"and the save without running the login command.\n\n" +
+		"The command can be changed with login_command in the config file, e.g. " +
+		`["codex", "login", "--device-auth"].`,
+	Example: "  codex-mp login personal\n" +
+		"  codex-mp login work -- --device-auth",
+	Run: func(cmd *cobra.Command, args []string) {
+		if dash := cmd.ArgsLenAtDash(); len(args) == 0 || dash > 1 || (dash < 0 && len(args) > 1) {
+			fail("Usage: codex-mp login <name> [--force] [--dry-run] [-- login-args...]")
+		}
+		paths := resolvePaths()
+		name := args[0]
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		force, _ := cmd.Flags().GetBool("force")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		opts := profile.LoginOptions{Args: args[1:], Overwrite: force, DryRun: dryRun, Stdin: stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+		if jsonOutput {
+			// Keep stdout a single JSON document.
+			opts.Stdout = os.Stderr
+		}
+		plan, err := profile.Login(name, opts, paths)
+		if err != nil {
+			fail(err.Error())
+		}
+		if dryRun {
+			reportPlan(cmd, "login "+name, plan)
+			return
+		}
+
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "action": "login", "profile": name})
+			return
+		}
+		ui.Success("Saved login as profile: %s", name)
+	},
+}
+
+func init() {
+	loginCmd.Flags().Bool("force", false, "Replace an existing profile")
+	dryRunFlag(loginCmd)
+	rootCmd.AddCommand(loginCmd)
+}
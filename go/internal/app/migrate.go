@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var migrateStorageCmd = &cobra.Command{
+	Use:   "migrate-storage",
+	Short: "Move profile storage to another layout",
+	Long:  "Move saved profiles, the lock and the active marker between the Codex directory (codex) and XDG base directories (xdg).",
+	Run: func(cmd *cobra.Command, args []string) {
+		if os.Getenv("CODEX_MP_STORAGE") != "" {
+			fail("CODEX_MP_STORAGE is set; unset it before migrating so the new layout is read from the config file")
+		}
+
+		to, _ := cmd.Flags().GetString("to")
+		from := resolvePaths()
+		dest, err := config.ResolveStorage(to)
+		if err != nil {
+			fail(err.Error())
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		moved, plan, err := profile.MigrateStorage(from, dest, dryRun)
+		if err != nil {
+			fail(err.Error())
+		}
+		if dryRun {
+			reportPlan(cmd, fmt.Sprintf("migrate %d profile(s) to %s storage", moved, dest.Storage), plan)
+			return
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			fmt.Printf(`{"ok":true,"action":"migrate-storage","storage":"%s","profiles_dir":"%s","profiles":%d}`+"\n", dest.Storage, dest.ProfilesDir, moved)
+		} else {
+			fmt.Printf("✓ Migrated %d profile(s) to %s storage: %s\n", moved, dest.Storage, dest.ProfilesDir)
+		}
+	},
+}
+
+func init() {
+	migrateStorageCmd.Flags().String("to", config.StorageXDG, "Target storage layout (codex or xdg)")
+	dryRunFlag(migrateStorageCmd)
+	rootCmd.AddCommand(migrateStorageCmd)
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/spf13/cobra"
 )
 
@@ -14,7 +13,7 @@ var pathCmd = &cobra.Command{
 	Short: "Show resolved paths",
 	Run: func(cmd *cobra.Command, args []string) {
 		jsonOutput, _ := cmd.Flags().GetBool("json")
-		paths := config.ResolvePaths()
+		paths := resolvePaths()
 
 		if jsonOutput {
 			enc := json.NewEncoder(os.Stdout)
@@ -25,11 +24,7 @@ var pathCmd = &cobra.Command{
 			return
 		}
 
-		// Check if stdout is a TTY
-		stat, _ := os.Stdout.Stat()
-		isTerminal := (stat.Mode() & os.ModeCharDevice) != 0
-
-		if !isTerminal {
+		if !isTerminal(os.Stdout) {
 			// Plain output for scripts
 			// echo "CODEX_HOME=${CODEX_HOME:-}"
 			// echo "CODEX_DIR=$CODEX_DIR"
@@ -43,7 +38,21 @@ var pathCmd = &cobra.Command{
 			fmt.Printf("CODEX_HOME=%s\n", valHome)
 			fmt.Printf("CODEX_DIR=%s\n", paths.CodexDir)
 			fmt.Printf("AUTH=%s\n", paths.AuthFile)
+			fmt.Printf("STORAGE=%s\n", paths.Storage)
+			fmt.Printf("DATA_DIR=%s\n", paths.DataDir)
 			fmt.Printf("PROFILES_DIR=%s\n", paths.ProfilesDir)
+			fmt.Printf("META=%s\n", paths.MetaFile)
+			fmt.Printf("STATE_DIR=%s\n", paths.StateDir)
+			fmt.Printf("ACTIVE=%s\n", paths.ActiveFile)
+			fmt.Printf("PREVIOUS=%s\n", paths.PreviousFile)
+			fmt.Printf("CACHE=%s\n", paths.CacheFile)
+			fmt.Printf("LOCK=%s\n", paths.LockFile)
+			fmt.Printf("UNDO=%s\n", paths.UndoDir)
+			fmt.Printf("TRASH=%s\n", paths.TrashDir)
+			fmt.Printf("EVENTS=%s\n", paths.EventsFile)
+			fmt.Printf("SYNC=%s\n", paths.SyncDir)
+			fmt.Printf("CONFIG=%s\n", paths.ConfigFile)
+			fmt.Printf("POLICY=%s\n", paths.PolicyFile)
 			return
 		}
 
@@ -56,7 +65,21 @@ var pathCmd = &cobra.Command{
 		}
 		fmt.Printf("  CODEX_DIR      = %s\n", paths.CodexDir)
 		fmt.Printf("  AUTH           = %s\n", paths.AuthFile)
+		fmt.Printf("  STORAGE        = %s\n", paths.Storage)
+		fmt.Printf("  DATA_DIR       = %s\n", paths.DataDir)
 		fmt.Printf("  PROFILES_DIR   = %s\n", paths.ProfilesDir)
+		fmt.Printf("  META           = %s\n", paths.MetaFile)
+		fmt.Printf("  STATE_DIR      = %s\n", paths.StateDir)
+		fmt.Printf("  ACTIVE         = %s\n", paths.ActiveFile)
+		fmt.Printf("  PREVIOUS       = %s\n", paths.PreviousFile)
+		fmt.Printf("  CACHE          = %s\n", paths.CacheFile)
+		fmt.Printf("  LOCK           = %s\n", paths.LockFile)
+		fmt.Printf("  UNDO           = %s\n", paths.UndoDir)
+		fmt.Printf("  TRASH          = %s\n", paths.TrashDir)
+		fmt.Printf("  EVENTS         = %s\n", paths.EventsFile)
+		fmt.Printf("  SYNC           = %s\n", paths.SyncDir)
+		fmt.Printf("  CONFIG         = %s\n", paths.ConfigFile)
+		fmt.Printf("  POLICY         = %s\n", paths.PolicyFile)
 	},
 }
 
@@ -4,78 +4,56 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/BigCactusLabs/codex-multipass/internal/config"
-	"github.com/BigCactusLabs/codex-multipass/internal/profile"
-	"github.com/BigCactusLabs/codex-multipass/internal/ui"
-	"github.com/charmbracelet/bubbles/key"
-	"github.com/charmbracelet/huh"
+	"github.com/BigCactusLabs/codex-multipass/internal/tui"
 	"github.com/spf13/cobra"
 )
 
 var pickCmd = &cobra.Command{
 	Use:     "pick",
 	Aliases: []string{"ui"},
-	Short:   "Interactive profile selector",
+	Short:   "Interactive profile manager",
+	Long: "Browse profiles with fuzzy search and a details pane; switch, rename, delete or save the current auth from one screen.\n\n" +
+		"When stdin or stdout is not a terminal the UI is drawn on /dev/tty. With --print the chosen name is written to stdout instead of switching.",
+	Example: "  codex-mp pick\n  name=$(codex-mp pick --print)\n  codex-mp list --names | fzf | codex-mp use --stdin",
 	Run: func(cmd *cobra.Command, args []string) {
 		if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
 			fail("pick/ui does not support --json output")
 			return // unreachable due to fail/exit but good practice
 		}
-		paths := config.ResolvePaths()
-
-		// List profiles
-		profiles, err := profile.List(paths)
-		if err != nil {
-			fail(err.Error())
-		}
-
-		if len(profiles) == 0 {
-			fail("No profiles found.")
-		}
-
-		var options []huh.Option[string]
-
-		for _, p := range profiles {
-			label := p.Name
-			if p.Active {
-				label = fmt.Sprintf("%s (active)", p.Name)
+		printOnly, _ := cmd.Flags().GetBool("print")
+		paths := resolvePaths()
+
+		opts := tui.Options{Print: printOnly}
+		if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+			tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+			if err != nil {
+				fail("pick needs a terminal; in scripts use `codex-mp list --names` and `codex-mp use --stdin`")
 			}
-			options = append(options, huh.NewOption(label, p.Name))
+			defer tty.Close()
+			opts.Input, opts.Output = tty, tty
 		}
 
-		var selectedProfile string
-
-		form := huh.NewForm(
-			huh.NewGroup(
-				huh.NewSelect[string]().
-					Title("Pick a profile").
-					Options(options...).
-					Value(&selectedProfile),
-			),
-		).WithTheme(ui.CustomTheme())
-
-		form.WithKeyMap(func() *huh.KeyMap {
-			km := huh.NewDefaultKeyMap()
-			km.Quit = key.NewBinding(key.WithKeys("ctrl+c", "esc"))
-			return km
-		}())
-
-		if err := form.Run(); err != nil {
-			if err == huh.ErrUserAborted {
-				os.Exit(0)
-			}
+		result, err := tui.Run(paths, opts)
+		if err != nil {
 			fail("Error: %v", err)
 		}
 
-		if selectedProfile != "" {
-			if err := profile.Use(selectedProfile, paths); err != nil {
-				fail(err.Error())
+		if result.Selected == "" {
+			if printOnly {
+				exitFunc(1) // Nothing chosen: let `$(codex-mp pick --print)` callers detect it
 			}
-			fmt.Printf("⚡ Switched -> %s\n", selectedProfile)
+			return
+		}
+		if printOnly {
+			fmt.Println(result.Selected)
+			return
 		}
+		warnPolicy(result.Policy)
+		fmt.Printf("⚡ Switched -> %s%s\n", result.Selected, targetSuffix(paths))
 	},
 }
 
 func init() {
+	pickCmd.Flags().Bool("print", false, "Print the chosen profile name instead of switching")
 	rootCmd.AddCommand(pickCmd)
 }
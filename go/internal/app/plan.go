@@ -0,0 +1,92 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+// dryRunFlag adds --dry-run to a mutating command.
+func dryRunFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("dry-run", false, "Show the planned changes without making them")
+}
+
+// showPlan handles --dry-run: it plans ops without applying them, prints the plans
+// and reports true. Without --dry-run it does nothing and reports false.
+func showPlan(cmd *cobra.Command, paths config.Paths, ops ...profile.Operation) bool {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if !dryRun {
+		return false
+	}
+
+	plans := make([]*profile.Plan, 0, len(ops))
+	for _, op := range ops {
+		plan, err := profile.Apply(op, paths, true)
+		if err != nil {
+			fail(err.Error())
+		}
+		plans = append(plans, plan)
+	}
+
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	if jsonOutput {
+		out := map[string]any{
+			"ok":      true,
+			"action":  ops[0].Op,
+			"dry_run": true,
+		}
+		if len(plans) == 1 {
+			out["plan"] = plans[0]
+		} else {
+			out["plans"] = plans
+		}
+		json.NewEncoder(os.Stdout).Encode(out)
+		return true
+	}
+
+	for i, plan := range plans {
+		printPlan(ops[i].String(), plan)
+	}
+	return true
+}
+
+// reportPlan prints the plan of a dry run that was not built from a plain operation,
+// e.g. one carrying a key, as showPlan does.
+func reportPlan(cmd *cobra.Command, title string, plan *profile.Plan) {
+	if jsonOutput, _ := cmd.Flags().GetBool("json"); jsonOutput {
+		json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "action": plan.Op, "dry_run": true, "plan": plan})
+		return
+	}
+	printPlan(title, plan)
+}
+
+func printPlan(title string, plan *profile.Plan) {
+	fmt.Printf("Plan: %s (dry run)\n", title)
+	if len(plan.Steps) == 0 {
+		fmt.Println("  (no changes)")
+	}
+	for _, step := range plan.Steps {
+		fmt.Printf("  %-6s %s\n", step.Action, describeStep(step))
+	}
+}
+
+func describeStep(step profile.Step) string {
+	desc := step.Path
+	if step.Source != "" {
+		desc = step.Source + " → " + step.Path
+	}
+	switch {
+	case step.FromMode != "":
+		desc += fmt.Sprintf(" [%s → %s]", step.FromMode, step.Mode)
+	case step.Mode != "":
+		desc += " [" + step.Mode + "]"
+	}
+	if step.Detail != "" {
+		desc += "  # " + step.Detail
+	}
+	return desc
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Check profiles against the account policy",
+	Long: "The policy file (see codex-mp path, POLICY) maps directories and hostnames to the accounts " +
+		"allowed there, by account id, email pattern or tag:\n\n" +
+		"  {\"rules\": [\n" +
+		"    {\"dir\": \"~/src/acme\", \"emails\": [\"*@acme.com\"]},\n" +
+		"    {\"host\": \"build-*\", \"tags\": [\"ci\"], \"mode\": \"warn\"}\n" +
+		"  ]}\n\n" +
+		"Every switch (use, auto, the picker, batch, undo and the serve API) and exec refuse a profile that a blocking " +
+		"rule for the working directory or host does not allow, and warn for rules with mode warn. Every decision " +
+		"they make is recorded in the event journal as a policy-decision event. The prompt snippets mark the active profile with ! when it violates the policy.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var policyCheckCmd = &cobra.Command{
+	Use:   "check [name]",
+	Short: "Check a profile against the policy",
+	Long: "Check a profile, by default the active one, against the policy for the working directory " +
+		"(or --dir) and this host. Exits 1 if a blocking rule is violated, and with --strict on warnings too.",
+	Example: "  codex-mp policy check\n" +
+		"  codex-mp policy check ci-bot --dir . --strict   # in CI",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			fail("Usage: codex-mp policy check [name] [--dir path] [--strict] [--quiet]")
+		}
+		paths := resolvePaths()
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		strict, _ := cmd.Flags().GetBool("strict")
+		dir, _ := cmd.Flags().GetString("dir")
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+
+		var name string
+		if len(args) == 1 {
+			name = profileArg(args[0], paths)
+		} else {
+			cur, err := profile.CurrentProfile(paths)
+			if err != nil {
+				fail(err.Error())
+			}
+			if cur.Name == "" {
+				fail("no active profile; pass a profile name")
+			}
+			name = cur.Name
+		}
+
+		decision, err := profile.CheckPolicy(name, dir, paths)
+		if err != nil {
+			fail(err.Error())
+		}
+		violated := decision.Decision == profile.PolicyBlock || (strict && decision.Decision == profile.PolicyWarn)
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		switch {
+		case quiet:
+		case jsonOutput:
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": !violated, "action": "policy-check", "policy": decision})
+		case decision.Decision == profile.PolicyNone:
+			fmt.Printf("No policy rule applies to %s.\n", dir)
+		case decision.Decision == profile.PolicyAllow:
+			fmt.Printf("✓ %s\n", decision)
+		default:
+			fmt.Printf("✗ %s\n", decision)
+		}
+		if violated {
+			exitFunc(1)
+			panic(exitSignal{Code: 1})
+		}
+	},
+}
+
+// enforcePolicy checks name against the policy for the working directory before
+// action uses it without switching to it, and records the decision. Switches are
+// checked by the profile package itself. A blocking violation fails.
+func enforcePolicy(name, action string, paths config.Paths) {
+	dir, _ := os.Getwd()
+	decision, err := profile.CheckPolicy(name, dir, paths)
+	if err != nil {
+		fail(err.Error())
+	}
+	if err := profile.RecordPolicyDecision(decision, action, paths); err != nil {
+		fail(err.Error())
+	}
+	if decision.Decision == profile.PolicyBlock {
+		fail("%v: %s", profile.ErrPolicyBlocked, decision)
+	}
+	warnPolicy(&decision)
+}
+
+// warnPolicy prints a policy warning to stderr, keeping stdout clean for --json and exec.
+func warnPolicy(decision *profile.PolicyDecision) {
+	if decision != nil && decision.Decision == profile.PolicyWarn {
+		fmt.Fprintf(os.Stderr, "Warning: policy: %s\n", decision)
+	}
+}
+
+func init() {
+	policyCheckCmd.Flags().String("dir", "", "Directory to check for (default: the working directory)")
+	policyCheckCmd.Flags().Bool("strict", false, "Fail on warnings too")
+	policyCheckCmd.Flags().BoolP("quiet", "q", false, "Print nothing; only set the exit code")
+	policyCmd.AddCommand(policyCheckCmd)
+	rootCmd.AddCommand(policyCmd)
+}
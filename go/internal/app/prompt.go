@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var promptSnippets = map[string]string{
+	"bash": `# codex-mp prompt integration for bash. Add to ~/.bashrc:
+#   eval "$(codex-mp prompt bash)"
+__codex_mp_prompt() {
+  local name
+  name="$(command codex-mp current --lock-timeout 250ms 2>/dev/null)" || return 0
+  [ -n "$name" ] || return 0
+  command codex-mp policy check --quiet --strict --lock-timeout 250ms 2>/dev/null || name="$name!"
+  printf '(%s) ' "$name"
+}
+case "$PS1" in
+  *__codex_mp_prompt*) ;;
+  *) PS1='$(__codex_mp_prompt)'"$PS1" ;;
+esac
+`,
+	"zsh": `# codex-mp prompt integration for zsh. Add to ~/.zshrc:
+#   eval "$(codex-mp prompt zsh)"
+setopt prompt_subst
+__codex_mp_prompt() {
+  local name
+  name="$(command codex-mp current --lock-timeout 250ms 2>/dev/null)" || return 0
+  [[ -n "$name" ]] || return 0
+  command codex-mp policy check --quiet --strict --lock-timeout 250ms 2>/dev/null || name="$name!"
+  printf '(%s) ' "$name"
+}
+[[ "$PROMPT" == *__codex_mp_prompt* ]] || PROMPT='$(__codex_mp_prompt)'"$PROMPT"
+`,
+	"fish": `# codex-mp prompt integration for fish. Add to ~/.config/fish/config.fish:
+#   codex-mp prompt fish | source
+function __codex_mp_prompt
+    set -l name (command codex-mp current --lock-timeout 250ms 2>/dev/null); or return 0
+    test -n "$name"; or return 0
+    command codex-mp policy check --quiet --strict --lock-timeout 250ms 2>/dev/null; or set name "$name!"
+    printf '(%s) ' $name
+end
+if not functions -q __codex_mp_orig_prompt
+    functions -c fish_prompt __codex_mp_orig_prompt
+    function fish_prompt
+        __codex_mp_prompt
+        __codex_mp_orig_prompt
+    end
+end
+`,
+	"starship": `# codex-mp module for starship. Append to ~/.config/starship.toml:
+#   codex-mp prompt starship >> ~/.config/starship.toml
+[custom.codex_mp]
+command = "codex-mp current --lock-timeout 250ms"
+when = "test -n \"$(codex-mp current --lock-timeout 250ms)\""
+format = "[codex:$output]($style) "
+style = "bold purple"
+shell = ["sh"]
+`,
+}
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt <shell>",
+	Short: "Print a shell prompt snippet",
+	Long: "Print a snippet that shows the active profile in your prompt, marked with ! when it violates " +
+		"the policy for the working directory (see codex-mp policy). Shells: " + strings.Join(promptShells(), ", ") + ".",
+	Example: "  eval \"$(codex-mp prompt bash)\"\n" +
+		"  codex-mp prompt fish | source",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fail("Usage: codex-mp prompt <%s>", strings.Join(promptShells(), "|"))
+		}
+		snippet, ok := promptSnippets[args[0]]
+		if !ok {
+			fail("unsupported shell: %s (supported: %s)", args[0], strings.Join(promptShells(), ", "))
+		}
+		fmt.Print(snippet)
+	},
+}
+
+func promptShells() []string {
+	shells := make([]string, 0, len(promptSnippets))
+	for shell := range promptSnippets {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	return shells
+}
+
+func init() {
+	rootCmd.AddCommand(promptCmd)
+}
@@ -3,7 +3,6 @@ package app
 import (
 	"fmt"
 
-	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/BigCactusLabs/codex-multipass/internal/profile"
 	"github.com/spf13/cobra"
 )
@@ -11,14 +10,21 @@ import (
 var renameCmd = &cobra.Command{
 	Use:   "rename <old> <new>",
 	Short: "Rename a profile",
+	Long:  "Pass - for either name to read it from stdin.",
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) != 2 {
 			fail("Usage: codex-mp rename <old> <new>")
 		}
-		oldName := args[0]
-		newName := args[1]
+		if args[0] == "-" && args[1] == "-" {
+			fail("only one of <old> and <new> can be read from stdin")
+		}
+		paths := resolvePaths()
+		oldName := profileArg(args[0], paths)
+		newName := nameArg(args[1])
 
-		paths := config.ResolvePaths()
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpRename, From: oldName, To: newName}) {
+			return
+		}
 		err := profile.Rename(oldName, newName, paths)
 		if err != nil {
 			fail(err.Error())
@@ -34,5 +40,6 @@ var renameCmd = &cobra.Command{
 }
 
 func init() {
+	dryRunFlag(renameCmd)
 	rootCmd.AddCommand(renameCmd)
 }
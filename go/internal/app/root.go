@@ -1,9 +1,14 @@
 package app
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
 	"github.com/spf13/cobra"
 )
 
@@ -11,6 +16,9 @@ var rootCmd = &cobra.Command{
 	Use:   "codex-mp",
 	Short: "Codex Profile Manager",
 	Long:  `A robust CLI for managing and switching Codex authentication profiles.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		profile.LockTimeout, _ = cmd.Flags().GetDuration("lock-timeout")
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		cmd.Help()
 	},
@@ -22,6 +30,8 @@ func Execute() error {
 
 func init() {
 	rootCmd.PersistentFlags().Bool("json", false, "Output in JSON format")
+	rootCmd.PersistentFlags().String("target", "", "Codex directory to act on, by configured target name")
+	rootCmd.PersistentFlags().Duration("lock-timeout", 30*time.Second, "How long to wait for the profile lock (0 waits forever, negative fails at once)")
 	rootCmd.SetHelpFunc(helpFunc)
 }
 
@@ -36,3 +46,55 @@ func fail(msg string, args ...any) {
 	exitFunc(1)
 	panic(exitSignal{Code: 1})
 }
+
+// resolvePaths resolves the runtime paths for the selected target, exiting on an invalid config.
+func resolvePaths() config.Paths {
+	target, _ := rootCmd.PersistentFlags().GetString("target")
+	paths, err := config.ResolveTarget(target)
+	if err != nil {
+		fail(err.Error())
+	}
+	return paths
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) != 0
+}
+
+// stdin is where "-" name arguments are read from; tests replace it.
+var stdin = os.Stdin
+
+// nameArg returns arg, or the first line of stdin when arg is "-".
+// This lets pipelines such as `codex-mp list --names | fzf | codex-mp delete -` pass a name through.
+func nameArg(arg string) string {
+	if arg != "-" {
+		return arg
+	}
+
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			return name
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fail("failed to read profile name from stdin: %v", err)
+	}
+	fail("no profile name on stdin")
+	return ""
+}
+
+// profileArg resolves an argument naming an existing profile: "-" is read as by nameArg,
+// and an alias is replaced by the profile it points to.
+func profileArg(arg string, paths config.Paths) string {
+	name, err := profile.ResolveAlias(nameArg(arg), paths)
+	if err != nil {
+		fail(err.Error())
+	}
+	return name
+}
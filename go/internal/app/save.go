@@ -3,7 +3,6 @@ package app
 import (
 	"fmt"
 
-	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/BigCactusLabs/codex-multipass/internal/profile"
 	"github.com/BigCactusLabs/codex-multipass/internal/ui"
 	"github.com/spf13/cobra"
@@ -16,9 +15,15 @@ var saveCmd = &cobra.Command{
 		if len(args) != 1 {
 			fail("Usage: codex-mp save <name>")
 		}
-		name := args[0]
+		paths := resolvePaths()
+		name, err := profile.ResolveAlias(args[0], paths)
+		if err != nil {
+			fail(err.Error())
+		}
 
-		paths := config.ResolvePaths()
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpSave, Name: name}) {
+			return
+		}
 		profilePath, err := profile.Save(name, paths)
 		if err != nil {
 			fail(err.Error())
@@ -34,5 +39,6 @@ var saveCmd = &cobra.Command{
 }
 
 func init() {
+	dryRunFlag(saveCmd)
 	rootCmd.AddCommand(saveCmd)
 }
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve --socket <path>",
+	Short: "Serve a JSON API on a Unix socket",
+	Long: "Serve the profile store to editor extensions and other tools over a Unix socket that only you can connect to (mode 0600). " +
+		"Requests take the same locks as the CLI.\n\n" +
+		"Endpoints:\n" +
+		"  GET  /v1/profiles   saved profiles with identity, tags and last use\n" +
+		"  GET  /v1/current    the active profile\n" +
+		`  POST /v1/use        {"name":"work","dry_run":false}` + "\n" +
+		`  POST /v1/save       {"name":"work","dry_run":false}` + "\n" +
+		"  GET  /v1/events     server-sent events, as printed by `codex-mp events`",
+	Example: "  codex-mp serve --socket ~/.codex-mp.sock\n" +
+		"  curl --unix-socket ~/.codex-mp.sock http://codex-mp/v1/current",
+	Run: func(cmd *cobra.Command, args []string) {
+		socket, _ := cmd.Flags().GetString("socket")
+		if len(args) != 0 || socket == "" {
+			fail("Usage: codex-mp serve --socket <path>")
+		}
+		paths := resolvePaths()
+
+		ln, err := server.Listen(socket)
+		if err != nil {
+			fail(err.Error())
+		}
+		defer os.Remove(socket)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Fprintf(os.Stderr, "Serving %s on %s\n", paths.Target, socket)
+		if err := server.New(paths).Serve(ctx, ln); err != nil {
+			fail(err.Error())
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("socket", "", "Unix socket to listen on")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Share profiles between machines through an encrypted git store",
+	Long: "Keep the same profiles on several machines through a git repository, e.g. a bare repository on a " +
+		"shared drive or a private remote. Every profile is encrypted with AES-256-GCM before it is committed, " +
+		"under a file name that does not reveal the profile name; the key never leaves this machine unless you copy it.\n\n" +
+		"When both sides changed a profile, the version with the newest last_refresh wins. " +
+		"Profiles deleted on one machine are moved to the trash on the others.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var syncInitCmd = &cobra.Command{
+	Use:   "init <repo>",
+	Short: "Set up sync with a git repository",
+	Long: "Clone the git repository at <repo> as the sync store. An empty repository becomes a new store " +
+		"encrypted with a freshly generated key. To join a store another machine set up, copy its key file " +
+		"(see codex-mp path, SYNC/key) and pass it with --key-file.",
+	Example: "  git init --bare /mnt/share/codex-mp.git\n" +
+		"  codex-mp sync init /mnt/share/codex-mp.git\n" +
+		"  codex-mp sync init /mnt/share/codex-mp.git --key-file ./key   # on the second machine",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fail("Usage: codex-mp sync init <repo> [--key-file path]")
+		}
+		paths := resolvePaths()
+		keyFile, _ := cmd.Flags().GetString("key-file")
+
+		if err := profile.SyncInit(args[0], keyFile, paths); err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":       true,
+				"action":   "sync-init",
+				"remote":   args[0],
+				"key_file": profile.SyncKeyFile(paths),
+			})
+			return
+		}
+		fmt.Printf("✓ Sync set up with %s\n", args[0])
+		if keyFile == "" {
+			fmt.Printf("  Key: %s (copy it to your other machines; anyone with it can read your profiles)\n", profile.SyncKeyFile(paths))
+		}
+	},
+}
+
+var syncPushCmd = &cobra.Command{
+	Use:   "push",
+	Short: "Upload local profiles to the sync store",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			fail("Usage: codex-mp sync push")
+		}
+		report, err := profile.SyncPush(resolvePaths())
+		if err != nil {
+			fail(err.Error())
+		}
+		printSyncReport(cmd, "sync-push", report)
+	},
+}
+
+var syncPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Install newer profiles from the sync store",
+	Long: "Install every profile the sync store holds a newer version of, including into auth.json " +
+		"if it is the active profile. The pull can be reverted with codex-mp undo.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			fail("Usage: codex-mp sync pull")
+		}
+		report, err := profile.SyncPull(resolvePaths())
+		if err != nil {
+			fail(err.Error())
+		}
+		printSyncReport(cmd, "sync-pull", report)
+	},
+}
+
+func printSyncReport(cmd *cobra.Command, action string, report profile.SyncReport) {
+	jsonOutput, _ := cmd.Flags().GetBool("json")
+	if jsonOutput {
+		json.NewEncoder(os.Stdout).Encode(map[string]any{
+			"ok":      true,
+			"action":  action,
+			"remote":  report.Remote,
+			"pushed":  nonNil(report.Pushed),
+			"pulled":  nonNil(report.Pulled),
+			"deleted": nonNil(report.Deleted),
+		})
+		return
+	}
+
+	if len(report.Pushed)+len(report.Pulled)+len(report.Deleted) == 0 {
+		fmt.Println("Already in sync.")
+		return
+	}
+	if len(report.Pushed) > 0 {
+		fmt.Printf("↑ Pushed: %s\n", strings.Join(report.Pushed, ", "))
+	}
+	if len(report.Pulled) > 0 {
+		fmt.Printf("↓ Pulled: %s\n", strings.Join(report.Pulled, ", "))
+	}
+	if len(report.Deleted) > 0 {
+		fmt.Printf("✗ Deleted: %s\n", strings.Join(report.Deleted, ", "))
+	}
+}
+
+func nonNil(names []string) []string {
+	if names == nil {
+		return []string{}
+	}
+	return names
+}
+
+func init() {
+	syncInitCmd.Flags().String("key-file", "", "Key file of an existing store, or the key to encrypt a new one with")
+	syncCmd.AddCommand(syncInitCmd, syncPushCmd, syncPullCmd)
+	rootCmd.AddCommand(syncCmd)
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag <name> [tag...]",
+	Short: "Set or clear profile tags",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fail("Usage: codex-mp tag <name> [tag...]")
+		}
+		paths := resolvePaths()
+		name, tags := profileArg(args[0], paths), args[1:]
+
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpTag, Name: name, Tags: tags}) {
+			return
+		}
+		if err := profile.SetTags(name, tags, paths); err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":      true,
+				"action":  "tag",
+				"profile": name,
+				"tags":    tags,
+			})
+		} else if len(tags) == 0 {
+			fmt.Printf("✓ Cleared tags: %s\n", name)
+		} else {
+			fmt.Printf("✓ Tagged %s: %s\n", name, strings.Join(tags, ", "))
+		}
+	},
+}
+
+func init() {
+	dryRunFlag(tagCmd)
+	rootCmd.AddCommand(tagCmd)
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var targetCmd = &cobra.Command{
+	Use:   "target",
+	Short: "Manage named Codex directories",
+	Long:  "Targets are extra Codex directories that share one profile store. Select one with --target.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var targetListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List targets",
+	Run: func(cmd *cobra.Command, args []string) {
+		targets, err := config.ResolveTargets()
+		if err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			type entry struct {
+				Name     string `json:"name"`
+				CodexDir string `json:"codex_dir"`
+			}
+			var out []entry
+			for _, t := range targets {
+				out = append(out, entry{Name: t.Target, CodexDir: t.CodexDir})
+			}
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "targets": out})
+			return
+		}
+
+		for _, t := range targets {
+			fmt.Printf("  %s  %s\n", t.Target, t.CodexDir)
+		}
+	},
+}
+
+var targetAddCmd = &cobra.Command{
+	Use:   "add <name> <codex-dir>",
+	Short: "Add or update a target",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			fail("Usage: codex-mp target add <name> <codex-dir>")
+		}
+		name := args[0]
+		dir, err := filepath.Abs(args[1])
+		if err != nil {
+			fail("invalid directory: %v", err)
+		}
+
+		paths := resolvePaths()
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpTargetAdd, Name: name, Dir: dir}) {
+			return
+		}
+		if err := profile.AddTarget(name, dir, paths); err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			fmt.Printf(`{"ok":true,"action":"target-add","target":"%s","codex_dir":"%s"}`+"\n", name, dir)
+		} else {
+			fmt.Printf("✓ Target %s -> %s\n", name, dir)
+		}
+	},
+}
+
+var targetRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a target",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fail("Usage: codex-mp target remove <name>")
+		}
+		name := args[0]
+
+		paths := resolvePaths()
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpTargetRemove, Name: name}) {
+			return
+		}
+		if err := profile.RemoveTarget(name, paths); err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			fmt.Printf(`{"ok":true,"action":"target-remove","target":"%s"}`+"\n", name)
+		} else {
+			fmt.Printf("✗ Removed target: %s\n", name)
+		}
+	},
+}
+
+// targetSuffix labels output for commands run against a non-default target.
+func targetSuffix(paths config.Paths) string {
+	if paths.Target == "" || paths.Target == config.DefaultTarget {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", paths.Target)
+}
+
+func init() {
+	dryRunFlag(targetAddCmd)
+	dryRunFlag(targetRemoveCmd)
+	targetCmd.AddCommand(targetListCmd, targetAddCmd, targetRemoveCmd)
+	rootCmd.AddCommand(targetCmd)
+}
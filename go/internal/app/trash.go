@@ -0,0 +1,141 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore or empty deleted profiles",
+	Long: "delete moves profiles to a trash next to the store (mode 0700). Items expire after trash_retention " +
+		"in the config file (default 30d; 0 keeps them) and are shredded the next time a profile is deleted or restored.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var trashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List deleted profiles, newest first",
+	Run: func(cmd *cobra.Command, args []string) {
+		items, err := profile.ListTrash(resolvePaths())
+		if err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			if items == nil {
+				items = []profile.TrashItem{}
+			}
+			json.NewEncoder(os.Stdout).Encode(map[string]any{"ok": true, "trash": items})
+			return
+		}
+
+		if len(items) == 0 {
+			fmt.Println("Trash is empty.")
+			return
+		}
+		for _, item := range items {
+			expires := "never expires"
+			if item.ExpiresAt != nil {
+				expires = "expires " + formatTime(item.ExpiresAt)
+				if time.Now().After(*item.ExpiresAt) {
+					expires = "expired"
+				}
+			}
+			line := fmt.Sprintf("  %3d  %-20s  deleted %s, %s", item.ID, item.Name, formatTime(&item.DeletedAt), expires)
+			if len(item.Tags) > 0 {
+				line += "  [" + strings.Join(item.Tags, ", ") + "]"
+			}
+			fmt.Println(line)
+		}
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <id|name>",
+	Short: "Restore a deleted profile",
+	Long:  "Restore a trash item by id, or the most recently deleted profile of that name. Its tags come back too.",
+	Example: "  codex-mp trash restore work\n" +
+		"  codex-mp trash restore 3 --as work-old",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fail("Usage: codex-mp trash restore <id|name> [--as name]")
+		}
+		paths := resolvePaths()
+		as, _ := cmd.Flags().GetString("as")
+		op := profile.Operation{Op: profile.OpRestore, Name: args[0], To: as}
+
+		if showPlan(cmd, paths, op) {
+			return
+		}
+		if _, err := profile.Apply(op, paths, false); err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":     true,
+				"action": "restore",
+				"item":   args[0],
+				"as":     as,
+			})
+		} else if as != "" {
+			fmt.Printf("↺ Restored from trash: %s as %s\n", args[0], as)
+		} else {
+			fmt.Printf("↺ Restored from trash: %s\n", args[0])
+		}
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty [id|name...]",
+	Short: "Shred deleted profiles for good",
+	Long: "Overwrite and remove the given trash items, or all of them. " +
+		"With --expired, only items past trash_retention. This cannot be undone.",
+	Run: func(cmd *cobra.Command, args []string) {
+		paths := resolvePaths()
+		expired, _ := cmd.Flags().GetBool("expired")
+		if expired && len(args) > 0 {
+			fail("Usage: codex-mp trash empty [id|name...] | --expired")
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		plan, err := profile.EmptyTrash(args, expired, paths, dryRun)
+		if err != nil {
+			fail(err.Error())
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":      true,
+				"action":  "empty-trash",
+				"dry_run": dryRun,
+				"plan":    plan,
+			})
+		} else if dryRun {
+			printPlan("empty trash", plan)
+		} else {
+			fmt.Printf("✗ Shredded %d trash item(s)\n", len(plan.Steps))
+		}
+	},
+}
+
+func init() {
+	trashRestoreCmd.Flags().String("as", "", "Restore under another name")
+	dryRunFlag(trashRestoreCmd)
+	trashEmptyCmd.Flags().Bool("expired", false, "Only shred items past the retention period")
+	dryRunFlag(trashEmptyCmd)
+	trashCmd.AddCommand(trashListCmd, trashRestoreCmd, trashEmptyCmd)
+	rootCmd.AddCommand(trashCmd)
+}
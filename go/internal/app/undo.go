@@ -0,0 +1,79 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Revert the most recent change",
+	Long: "Restore every file the most recent mutating command (save, use, delete, rename, copy, tag or batch) " +
+		"changed, including the sync-back into the previously active profile, from the pre-images kept with it. " +
+		fmt.Sprintf("The last %d changes can be undone, newest first.", profile.UndoDepth),
+	Example: "  codex-mp undo --list\n" +
+		"  codex-mp undo --dry-run\n" +
+		"  codex-mp undo",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			fail("Usage: codex-mp undo [--list] [--dry-run]")
+		}
+		paths := resolvePaths()
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+
+		if list, _ := cmd.Flags().GetBool("list"); list {
+			history, err := profile.UndoHistory(paths)
+			if err != nil {
+				fail(err.Error())
+			}
+			if jsonOutput {
+				if history == nil {
+					history = []profile.UndoEntry{}
+				}
+				json.NewEncoder(os.Stdout).Encode(history)
+				return
+			}
+			if len(history) == 0 {
+				fmt.Println("Nothing to undo.")
+				return
+			}
+			for _, entry := range history {
+				fmt.Printf("  %3d  %s  %s\n", entry.ID, formatTime(&entry.Time), strings.Join(entry.Ops, "; "))
+			}
+			return
+		}
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		entry, plan, err := profile.Undo(paths, dryRun)
+		if err != nil {
+			fail(err.Error())
+		}
+		warnPolicy(plan.Policy)
+
+		desc := strings.Join(entry.Ops, "; ")
+		if jsonOutput {
+			json.NewEncoder(os.Stdout).Encode(map[string]any{
+				"ok":      true,
+				"action":  "undo",
+				"dry_run": dryRun,
+				"undone":  entry,
+				"plan":    plan,
+			})
+		} else if dryRun {
+			printPlan("undo "+desc, plan)
+		} else {
+			fmt.Printf("↺ Undid: %s\n", desc)
+		}
+	},
+}
+
+func init() {
+	undoCmd.Flags().Bool("list", false, "List the changes that can be undone, newest first")
+	dryRunFlag(undoCmd)
+	rootCmd.AddCommand(undoCmd)
+}
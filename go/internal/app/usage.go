@@ -0,0 +1,158 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report Codex usage per profile",
+	Long: "Scan the session logs Codex keeps under CODEX_DIR/sessions and attribute each session to the " +
+		"profile that was active when it started, from the switches in the event journal. Reports session " +
+		"counts, durations and token totals where the logs record them. Sessions from while the journal " +
+		"did not know the active profile are reported as " + profile.UnknownProfile + ". The journal keeps " +
+		"only recent history, so usage warns when sessions started before its oldest event.\n\n" +
+		"--since takes a date (2026-01-02), an RFC 3339 time, or a period back from now (7d, 12h).",
+	Example: "  codex-mp usage --since 30d\n" +
+		"  codex-mp usage --profile 'acme/*' --sessions --csv > acme.csv",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			fail("Usage: codex-mp usage [--since date|period] [--profile name|pattern] [--sessions] [--csv]")
+		}
+		paths := resolvePaths()
+		sinceFlag, _ := cmd.Flags().GetString("since")
+		pattern, _ := cmd.Flags().GetString("profile")
+		perSession, _ := cmd.Flags().GetBool("sessions")
+		csvOutput, _ := cmd.Flags().GetBool("csv")
+
+		var since time.Time
+		if sinceFlag != "" {
+			var err error
+			if since, err = parseSince(sinceFlag, time.Now()); err != nil {
+				fail(err.Error())
+			}
+		}
+		report, err := profile.Usage(paths, since, pattern)
+		if err != nil {
+			fail(err.Error())
+		}
+		totals, sessions := report.Profiles, report.Sessions
+		switch {
+		case report.BeforeJournal == 0:
+		case report.JournalStart.IsZero():
+			fmt.Fprintf(os.Stderr, "Warning: the event journal is empty, so the profile of %d session(s) is %s.\n",
+				report.BeforeJournal, profile.UnknownProfile)
+		default:
+			fmt.Fprintf(os.Stderr, "Warning: %d session(s) started before the event journal begins (%s), so their profile is %s.\n",
+				report.BeforeJournal, report.JournalStart.Local().Format("2006-01-02 15:04"), profile.UnknownProfile)
+		}
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+		switch {
+		case jsonOutput:
+			if totals == nil {
+				totals = []profile.ProfileUsage{}
+			}
+			out := map[string]any{"ok": true, "action": "usage", "profiles": totals, "sessions_before_journal": report.BeforeJournal}
+			if !report.JournalStart.IsZero() {
+				out["journal_start"] = report.JournalStart
+			}
+			if !since.IsZero() {
+				out["since"] = since
+			}
+			if perSession {
+				if sessions == nil {
+					sessions = []profile.SessionUsage{}
+				}
+				out["sessions"] = sessions
+			}
+			json.NewEncoder(os.Stdout).Encode(out)
+		case csvOutput:
+			if err := writeUsageCSV(totals, sessions, perSession); err != nil {
+				fail("failed to write CSV: %v", err)
+			}
+		case len(totals) == 0:
+			fmt.Println("No sessions found.")
+		case perSession:
+			for _, s := range sessions {
+				fmt.Printf("  %s  %-20s  %8s  %10s tokens\n", s.Start.Local().Format("2006-01-02 15:04"), s.Profile,
+					time.Duration(s.Seconds)*time.Second, tokensOrDash(s.HasTokens, s.Tokens.Total))
+			}
+		default:
+			fmt.Printf("  %-20s  %8s  %10s  %12s\n", "PROFILE", "SESSIONS", "DURATION", "TOKENS")
+			for _, u := range totals {
+				fmt.Printf("  %-20s  %8d  %10s  %12d\n", u.Profile, u.Sessions, time.Duration(u.Seconds)*time.Second, u.Tokens.Total)
+			}
+		}
+	},
+}
+
+// parseSince parses --since: a date, an RFC 3339 time, or a period before now
+// such as 7d or 12h.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if d, err := profile.ParseRetention(s); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since: %s (e.g. 2026-01-02, 7d or 12h)", s)
+}
+
+func tokensOrDash(has bool, n int64) string {
+	if !has {
+		return "-"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// writeUsageCSV writes the totals, or the sessions with perSession, as CSV with a header row.
+func writeUsageCSV(totals []profile.ProfileUsage, sessions []profile.SessionUsage, perSession bool) error {
+	w := csv.NewWriter(os.Stdout)
+	tokenHeader := []string{"input_tokens", "cached_input_tokens", "output_tokens", "reasoning_output_tokens", "total_tokens"}
+	tokenFields := func(t profile.TokenUsage) []string {
+		return []string{
+			strconv.FormatInt(t.Input, 10),
+			strconv.FormatInt(t.CachedInput, 10),
+			strconv.FormatInt(t.Output, 10),
+			strconv.FormatInt(t.ReasoningOutput, 10),
+			strconv.FormatInt(t.Total, 10),
+		}
+	}
+
+	if perSession {
+		w.Write(append([]string{"profile", "session", "start", "end", "duration_seconds", "has_tokens"}, tokenHeader...))
+		for _, s := range sessions {
+			w.Write(append([]string{
+				s.Profile, s.ID, s.Start.Format(time.RFC3339), s.End.Format(time.RFC3339),
+				strconv.FormatInt(s.Seconds, 10), strconv.FormatBool(s.HasTokens),
+			}, tokenFields(s.Tokens)...))
+		}
+	} else {
+		w.Write(append([]string{"profile", "sessions", "duration_seconds"}, tokenHeader...))
+		for _, u := range totals {
+			w.Write(append([]string{u.Profile, strconv.Itoa(u.Sessions), strconv.FormatInt(u.Seconds, 10)}, tokenFields(u.Tokens)...))
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func init() {
+	usageCmd.Flags().String("since", "", "Only sessions started after this date or period, e.g. 2026-01-02 or 7d")
+	usageCmd.Flags().String("profile", "", "Only sessions of this profile or glob pattern")
+	usageCmd.Flags().Bool("sessions", false, "List sessions instead of totals per profile")
+	usageCmd.Flags().Bool("csv", false, "Output CSV")
+	rootCmd.AddCommand(usageCmd)
+}
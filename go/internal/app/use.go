@@ -3,35 +3,69 @@ package app
 import (
 	"fmt"
 
-	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/BigCactusLabs/codex-multipass/internal/profile"
 	"github.com/spf13/cobra"
 )
 
 var useCmd = &cobra.Command{
-	Use:   "use <name>",
+	Use:   "use [name|alias|-]",
 	Short: "Switch to a saved profile",
+	Long: "Without a name, switch to the default profile (see codex-mp default).\n\n" +
+		"Pass - to switch back to the previously active profile, like cd -, also in scripts. " +
+		"With --stdin the profile name is read from stdin instead.",
+	Example: "  codex-mp use work\n" +
+		"  codex-mp use -\n" +
+		"  codex-mp list --names | fzf | codex-mp use --stdin",
 	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) != 1 {
-			fail("Usage: codex-mp use <name>")
+		fromStdin, _ := cmd.Flags().GetBool("stdin")
+		if len(args) > 1 || (fromStdin && len(args) > 0) {
+			fail("Usage: codex-mp use [name|alias|-] or codex-mp use --stdin")
 		}
-		name := args[0]
 
-		paths := config.ResolvePaths()
-		err := profile.Use(name, paths)
+		paths := resolvePaths()
+		var name string
+		var err error
+		switch {
+		case fromStdin:
+			name = profileArg("-", paths)
+		case len(args) == 0:
+			if name, err = profile.DefaultProfile(paths); err != nil {
+				fail(err.Error())
+			}
+			if name == "" {
+				fail("Usage: codex-mp use <name> (no default profile set; see codex-mp default)")
+			}
+		case args[0] == "-":
+			if name, err = profile.PreviousProfile(paths); err != nil {
+				fail(err.Error())
+			}
+			if name == "" {
+				fail("no previous profile")
+			}
+		default:
+			name = profileArg(args[0], paths)
+		}
+
+		if showPlan(cmd, paths, profile.Operation{Op: profile.OpUse, Name: name}) {
+			return
+		}
+		plan, err := profile.Apply(profile.Operation{Op: profile.OpUse, Name: name}, paths, false)
 		if err != nil {
 			fail(err.Error())
 		}
+		warnPolicy(plan.Policy)
 
 		jsonOutput, _ := cmd.Flags().GetBool("json")
 		if jsonOutput {
 			fmt.Printf(`{"ok":true,"action":"use","profile":"%s","auth":"%s"}`+"\n", name, paths.AuthFile)
 		} else {
-			fmt.Printf("⚡ Switched -> %s\n", name)
+			fmt.Printf("⚡ Switched -> %s%s\n", name, targetSuffix(paths))
 		}
 	},
 }
 
 func init() {
+	useCmd.Flags().Bool("stdin", false, "Read the profile name from stdin")
+	dryRunFlag(useCmd)
 	rootCmd.AddCommand(useCmd)
 }
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/BigCactusLabs/codex-multipass/internal/profile"
 	"github.com/spf13/cobra"
 )
@@ -14,11 +13,13 @@ var whoCmd = &cobra.Command{
 	Use:   "who",
 	Short: "Show current auth fingerprint",
 	Run: func(cmd *cobra.Command, args []string) {
-		paths := config.ResolvePaths()
+		paths := resolvePaths()
 
-		fingerprint, err := profile.GetFingerprint(paths.AuthFile)
-		if err != nil {
+		fingerprint, err := profile.Who(paths)
+		if os.IsNotExist(err) {
 			fail("Not logged in (missing %s)", paths.AuthFile)
+		} else if err != nil {
+			fail(err.Error())
 		}
 
 		jsonOutput, _ := cmd.Flags().GetBool("json")
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+)
+
+// Config holds user settings read from the codex-mp config file.
+type Config struct {
+	Storage string            `json:"storage,omitempty"`
+	Targets map[string]string `json:"targets,omitempty"` // target name -> Codex directory
+	// SymlinkPolicy controls writes to a symlinked auth.json or profile: replace, write-through or refuse.
+	SymlinkPolicy string `json:"symlink_policy,omitempty"`
+	// Aliases maps short names to profile names; they are accepted wherever a profile name is.
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// DefaultProfile is what `use` without arguments switches to.
+	DefaultProfile string `json:"default_profile,omitempty"`
+	// TrashRetention is how long deleted profiles stay in the trash, e.g. "30d" or "72h"; "0" keeps them.
+	TrashRetention string `json:"trash_retention,omitempty"`
+	// Catalogs maps catalog names to directories of shared, read-only profiles.
+	Catalogs map[string]string `json:"catalogs,omitempty"`
+	// LoginCommand is what `login` runs in an isolated CODEX_HOME; codex login by default.
+	LoginCommand []string `json:"login_command,omitempty"`
+	// Schedule picks the profile `auto` switches to; the first matching rule wins.
+	Schedule []ScheduleRule `json:"schedule,omitempty"`
+}
+
+// ScheduleRule selects Profile either by a five-field cron expression matched against
+// the current minute, or by a window of Days (e.g. "mon-fri", "sat") and times From
+// and To ("09:00", "17:30"; To before From spans midnight). A rule with neither
+// always matches, as a fallback.
+type ScheduleRule struct {
+	Profile string   `json:"profile"`
+	Cron    string   `json:"cron,omitempty"`
+	Days    []string `json:"days,omitempty"`
+	From    string   `json:"from,omitempty"`
+	To      string   `json:"to,omitempty"`
+}
+
+// ConfigFile returns the location of the codex-mp config file.
+// CODEX_MP_CONFIG overrides the default of $XDG_CONFIG_HOME/codex-mp/config.json.
+func ConfigFile() string {
+	if env := os.Getenv("CODEX_MP_CONFIG"); env != "" {
+		return env
+	}
+	return filepath.Join(xdgDir("XDG_CONFIG_HOME", ".config"), "codex-mp", "config.json")
+}
+
+// PolicyFile returns the location of the account policy file.
+// CODEX_MP_POLICY overrides the default of policy.json next to the config file.
+func PolicyFile() string {
+	if env := os.Getenv("CODEX_MP_POLICY"); env != "" {
+		return env
+	}
+	return filepath.Join(filepath.Dir(ConfigFile()), "policy.json")
+}
+
+// Load reads the config file at path. A missing file yields the zero Config.
+func Load(path string) (Config, error) {
+	var cfg Config
+	if path == "" {
+		return cfg, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Update applies fn to the config stored at path and writes it back atomically.
+func Update(path string, fn func(cfg *Config) error) error {
+	cfg, err := Load(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(&cfg); err != nil {
+		return err
+	}
+	if err := fs.AtomicWriteJSON(path, cfg, 0600); err != nil {
+		return fmt.Errorf("failed to write config %s: %w", path, err)
+	}
+	return nil
+}
+
+// xdgDir returns the directory named by env, falling back to ~/<fallback>.
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); dir != "" {
+		return dir
+	}
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, fallback)
+}
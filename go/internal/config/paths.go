@@ -1,21 +1,69 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 )
 
-// Paths holds the resolved paths for the application
+// Storage layouts for profile data.
+const (
+	// StorageCodex keeps profiles, lock and marker inside the Codex directory.
+	StorageCodex = "codex"
+	// StorageXDG keeps profiles under $XDG_DATA_HOME and lock/marker under $XDG_STATE_HOME.
+	StorageXDG = "xdg"
+)
+
+// DefaultTarget names the Codex directory resolved from CODEX_HOME or ~/.codex.
+const DefaultTarget = "default"
+
+var targetRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Paths holds the resolved paths for the application.
+// The target fields (CodexDir, AuthFile, ActiveFile, PreviousFile, CacheFile) say where a profile is installed;
+// the store fields say where profiles are kept. Several targets can share one store.
 type Paths struct {
-	CodexHome   string `json:"codex_home,omitempty"` // The env var value, if set
-	CodexDir    string `json:"codex_dir"`
-	AuthFile    string `json:"auth"`
-	ProfilesDir string `json:"profiles_dir"`
-	ActiveFile  string `json:"-"`
+	Target       string `json:"target"`
+	CodexHome    string `json:"codex_home,omitempty"` // The env var value, if set
+	CodexDir     string `json:"codex_dir"`
+	AuthFile     string `json:"auth"`
+	ActiveFile   string `json:"active_file"`
+	PreviousFile string `json:"previous_file"`
+	CacheFile    string `json:"cache_file"`
+	Storage      string `json:"storage"`
+	ConfigFile   string `json:"config_file"`
+	PolicyFile   string `json:"policy_file"`
+	DataDir      string `json:"data_dir"`
+	StateDir     string `json:"state_dir"`
+	ProfilesDir  string `json:"profiles_dir"`
+	MetaFile     string `json:"meta_file"`
+	LockFile     string `json:"lock_file"`
+	UndoDir      string `json:"undo_dir"`
+	TrashDir     string `json:"trash_dir"`
+	EventsFile   string `json:"events_file"`
+	SyncDir      string `json:"sync_dir"`
+}
+
+// ResolvePaths determines the runtime paths based on environment variables, the config file and defaults.
+// CODEX_MP_STORAGE overrides the storage layout selected in the config file.
+func ResolvePaths() (Paths, error) {
+	cfg, err := Load(ConfigFile())
+	if err != nil {
+		return Paths{}, err
+	}
+
+	storage := cfg.Storage
+	if env := os.Getenv("CODEX_MP_STORAGE"); env != "" {
+		storage = env
+	}
+
+	return ResolveStorage(storage)
 }
 
-// ResolvePaths determines the runtime paths based on environment variables and defaults.
-func ResolvePaths() Paths {
+// ResolveStorage resolves paths for the given storage layout, ignoring the configured one.
+func ResolveStorage(storage string) (Paths, error) {
 	homeDir, _ := os.UserHomeDir()
 
 	// Default: ~/.codex
@@ -27,11 +75,120 @@ func ResolvePaths() Paths {
 		codexDir = envHome
 	}
 
-	return Paths{
-		CodexHome:   envHome,
-		CodexDir:    codexDir,
-		AuthFile:    filepath.Join(codexDir, "auth.json"),
-		ProfilesDir: filepath.Join(codexDir, "profiles"),
-		ActiveFile:  filepath.Join(codexDir, ".codex-mp-active"),
+	paths := Paths{
+		Target:     DefaultTarget,
+		CodexHome:  envHome,
+		CodexDir:   codexDir,
+		AuthFile:   filepath.Join(codexDir, "auth.json"),
+		ConfigFile: ConfigFile(),
+		PolicyFile: PolicyFile(),
+	}
+
+	switch storage {
+	case "", StorageCodex:
+		paths.Storage = StorageCodex
+		paths.DataDir = codexDir
+		paths.StateDir = codexDir
+		paths.ProfilesDir = filepath.Join(codexDir, "profiles")
+		paths.MetaFile = filepath.Join(codexDir, ".codex-mp-meta.json")
+		paths.ActiveFile = filepath.Join(codexDir, ".codex-mp-active")
+		paths.PreviousFile = filepath.Join(codexDir, ".codex-mp-previous")
+		paths.CacheFile = filepath.Join(codexDir, ".codex-mp-cache.json")
+		paths.LockFile = filepath.Join(codexDir, ".codex-mp.lock")
+		paths.UndoDir = filepath.Join(codexDir, ".codex-mp-undo")
+		paths.TrashDir = filepath.Join(codexDir, ".codex-mp-trash")
+		paths.EventsFile = filepath.Join(codexDir, ".codex-mp-events.jsonl")
+		paths.SyncDir = filepath.Join(codexDir, ".codex-mp-sync")
+	case StorageXDG:
+		paths.Storage = StorageXDG
+		paths.DataDir = filepath.Join(xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share")), "codex-mp")
+		paths.StateDir = filepath.Join(xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state")), "codex-mp")
+		paths.ProfilesDir = filepath.Join(paths.DataDir, "profiles")
+		paths.MetaFile = filepath.Join(paths.DataDir, "meta.json")
+		paths.ActiveFile = filepath.Join(paths.StateDir, "active")
+		paths.PreviousFile = filepath.Join(paths.StateDir, "previous")
+		paths.CacheFile = filepath.Join(paths.StateDir, "cache.json")
+		paths.LockFile = filepath.Join(paths.StateDir, "lock")
+		paths.UndoDir = filepath.Join(paths.StateDir, "undo")
+		paths.TrashDir = filepath.Join(paths.DataDir, "trash")
+		paths.EventsFile = filepath.Join(paths.StateDir, "events.jsonl")
+		paths.SyncDir = filepath.Join(paths.DataDir, "sync")
+	default:
+		return Paths{}, fmt.Errorf("unknown storage layout: %s (allowed: %s, %s)", storage, StorageCodex, StorageXDG)
+	}
+
+	return paths, nil
+}
+
+// ResolveTarget resolves paths for a named target from the config file.
+// An empty name or DefaultTarget resolves the default Codex directory.
+func ResolveTarget(name string) (Paths, error) {
+	paths, err := ResolvePaths()
+	if err != nil || name == "" || name == DefaultTarget {
+		return paths, err
+	}
+
+	cfg, err := Load(paths.ConfigFile)
+	if err != nil {
+		return Paths{}, err
+	}
+	dir, ok := cfg.Targets[name]
+	if !ok {
+		return Paths{}, fmt.Errorf("unknown target: %s", name)
+	}
+	return paths.WithTarget(name, dir), nil
+}
+
+// ResolveTargets returns the default target followed by every configured target, sorted by name.
+func ResolveTargets() ([]Paths, error) {
+	paths, err := ResolvePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := Load(paths.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(cfg.Targets))
+	for name := range cfg.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	targets := []Paths{paths}
+	for _, name := range names {
+		targets = append(targets, paths.WithTarget(name, cfg.Targets[name]))
+	}
+	return targets, nil
+}
+
+// WithTarget returns paths that keep the same profile store but install into dir.
+func (p Paths) WithTarget(name, dir string) Paths {
+	p.Target = name
+	p.CodexHome = dir
+	p.CodexDir = dir
+	p.AuthFile = filepath.Join(dir, "auth.json")
+
+	// The active and previous markers and the cache are tracked per target: next to
+	// auth.json in the codex layout, and keyed by target name in the XDG state directory.
+	if p.Storage == StorageXDG {
+		p.ActiveFile = filepath.Join(p.StateDir, "active-"+name)
+		p.PreviousFile = filepath.Join(p.StateDir, "previous-"+name)
+		p.CacheFile = filepath.Join(p.StateDir, "cache-"+name+".json")
+	} else {
+		p.ActiveFile = filepath.Join(dir, ".codex-mp-active")
+		p.PreviousFile = filepath.Join(dir, ".codex-mp-previous")
+		p.CacheFile = filepath.Join(dir, ".codex-mp-cache.json")
+	}
+	return p
+}
+
+// ValidateTargetName checks if the target name is valid
+func ValidateTargetName(name string) error {
+	if !targetRegex.MatchString(name) || name == DefaultTarget {
+		return fmt.Errorf("invalid target name: %s (allowed: A-Z a-z 0-9 . _ -, not %q)", name, DefaultTarget)
 	}
+	return nil
 }
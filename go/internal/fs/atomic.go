@@ -1,7 +1,9 @@
 package fs
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -9,54 +11,98 @@ import (
 	"syscall"
 )
 
-// AtomicWriteJSON writes the given data to a file atomically.
-// It creates a temporary file in the same directory, writes to it,
-// sets permissions, and then renames it to the target file.
-func AtomicWriteJSON(path string, data any, perm os.FileMode) error {
-	dir := filepath.Dir(path)
+// SymlinkPolicy decides what an atomic write does when its destination is a symlink.
+type SymlinkPolicy string
 
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create target directory: %w", err)
-	}
+const (
+	// SymlinkReplace replaces the link itself with a regular file. The link target is left alone.
+	SymlinkReplace SymlinkPolicy = "replace"
+	// SymlinkWriteThrough keeps the link and replaces its target atomically in the target's own directory.
+	SymlinkWriteThrough SymlinkPolicy = "write-through"
+	// SymlinkRefuse fails the write and leaves both the link and its target untouched.
+	SymlinkRefuse SymlinkPolicy = "refuse"
+)
 
-	tmpFile, err := os.CreateTemp(dir, ".tmp-*")
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+// ErrSymlinkRefused is returned when a write hits a symlink under SymlinkRefuse.
+var ErrSymlinkRefused = errors.New("destination is a symlink")
+
+// ParseSymlinkPolicy validates a policy name. The empty string selects SymlinkReplace.
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case "":
+		return SymlinkReplace, nil
+	case SymlinkReplace, SymlinkWriteThrough, SymlinkRefuse:
+		return p, nil
 	}
-	defer os.Remove(tmpFile.Name()) // Clean up if something goes wrong before rename
-	defer tmpFile.Close()
+	return "", fmt.Errorf("invalid symlink policy: %s (allowed: replace, write-through, refuse)", s)
+}
+
+// WriteOptions tunes the atomic write helpers. The zero value is the default.
+type WriteOptions struct {
+	// Symlinks is the policy for a symlinked destination. Empty means SymlinkReplace.
+	Symlinks SymlinkPolicy
+}
 
-	enc := json.NewEncoder(tmpFile)
+// crashPoint is called after each step of an atomic write. Tests use it to
+// inject failures; returning an error aborts the write at that step.
+var crashPoint = func(step string) error { return nil }
+
+// AtomicWriteJSON writes the given data to a file atomically.
+// It creates a temporary file in the same directory, writes to it,
+// sets permissions, and then renames it to the target file.
+func AtomicWriteJSON(path string, data any, perm os.FileMode, opts ...WriteOptions) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
 	enc.SetIndent("", "  ")
 	if err := enc.Encode(data); err != nil {
 		return fmt.Errorf("failed to encode json: %w", err)
 	}
 
-	if err := tmpFile.Chmod(perm); err != nil {
-		return fmt.Errorf("failed to set permissions: %w", err)
-	}
-
-	// Close before rename to ensure flush
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("failed to close temp file: %w", err)
-	}
-
-	if err := os.Rename(tmpFile.Name(), path); err != nil {
-		return fmt.Errorf("failed to rename temp file: %w", err)
-	}
+	return AtomicWriteFile(path, buf.Bytes(), perm, opts...)
+}
 
-	return nil
+// AtomicWriteFile writes raw bytes to a file atomically.
+func AtomicWriteFile(path string, data []byte, perm os.FileMode, opts ...WriteOptions) error {
+	return atomicWrite(path, perm, writeOptions(opts), func(tmp *os.File) error {
+		if _, err := tmp.Write(data); err != nil {
+			return fmt.Errorf("failed to write content: %w", err)
+		}
+		return nil
+	})
 }
 
 // AtomicCopy copies a file atomically to a target path with specified permissions.
-func AtomicCopy(src, dst string, perm os.FileMode) error {
+func AtomicCopy(src, dst string, perm os.FileMode, opts ...WriteOptions) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open source file: %w", err)
 	}
 	defer sourceFile.Close()
 
-	dir := filepath.Dir(dst)
+	return atomicWrite(dst, perm, writeOptions(opts), func(tmp *os.File) error {
+		if _, err := io.Copy(tmp, sourceFile); err != nil {
+			return fmt.Errorf("failed to copy content: %w", err)
+		}
+		return nil
+	})
+}
+
+func writeOptions(opts []WriteOptions) WriteOptions {
+	if len(opts) > 0 {
+		return opts[0]
+	}
+	return WriteOptions{}
+}
+
+// atomicWrite fills a temporary file next to the destination and renames it into place.
+// The data is fsynced before the rename and the directory after it, so a crash or power
+// loss leaves either the old or the new file, never a torn or empty one.
+func atomicWrite(path string, perm os.FileMode, opts WriteOptions, fill func(tmp *os.File) error) error {
+	path, err := resolveDestination(path, opts)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
 
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return fmt.Errorf("failed to create target directory: %w", err)
@@ -66,49 +112,109 @@ func AtomicCopy(src, dst string, perm os.FileMode) error {
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
-	defer os.Remove(tmpFile.Name())
+	defer os.Remove(tmpFile.Name()) // Clean up if something goes wrong before rename
 	defer tmpFile.Close()
 
-	if _, err := io.Copy(tmpFile, sourceFile); err != nil {
-		return fmt.Errorf("failed to copy content: %w", err)
+	if err := fill(tmpFile); err != nil {
+		return err
+	}
+	if err := crashPoint("written"); err != nil {
+		return err
 	}
 
 	if err := tmpFile.Chmod(perm); err != nil {
 		return fmt.Errorf("failed to set permissions: %w", err)
 	}
+	if err := preserveOwner(tmpFile, path); err != nil {
+		return err
+	}
+
+	if err := tmpFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := crashPoint("synced"); err != nil {
+		return err
+	}
 
+	// Close before rename to ensure flush
 	if err := tmpFile.Close(); err != nil {
 		return fmt.Errorf("failed to close temp file: %w", err)
 	}
 
-	if err := os.Rename(tmpFile.Name(), dst); err != nil {
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
 		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
+	if err := crashPoint("renamed"); err != nil {
+		return err
+	}
 
-	return nil
+	if err := SyncDir(dir); err != nil {
+		return err
+	}
+	return crashPoint("dirsynced")
 }
 
-// LockFile acquires a shared lock on a file path.
-// It returns a release function that must be called to unlock.
-func Lock(path string) (func(), error) {
-	// Ensure directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+// resolveDestination returns the file an atomic write should replace, applying the
+// symlink policy when the destination is a link.
+func resolveDestination(path string, opts WriteOptions) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return path, nil
+	}
+
+	switch opts.Symlinks {
+	case SymlinkRefuse:
+		return "", fmt.Errorf("refusing to write %s: %w (symlink policy: refuse)", path, ErrSymlinkRefused)
+	case SymlinkWriteThrough:
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve symlink %s: %w", path, err)
+		}
+		return target, nil
+	}
+	return path, nil
+}
+
+// preserveOwner gives tmp the owner of the file it is about to replace, if that file exists.
+// The existing file is inspected with Lstat, so a symlink is never followed here.
+func preserveOwner(tmp *os.File, path string) error {
+	existing, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	want, ok := existing.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
 	}
 
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	current, err := tmp.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open lock file: %w", err)
+		return fmt.Errorf("failed to stat temp file: %w", err)
 	}
+	have, ok := current.Sys().(*syscall.Stat_t)
+	if !ok || (have.Uid == want.Uid && have.Gid == want.Gid) {
+		return nil
+	}
+
+	if err := tmp.Chown(int(want.Uid), int(want.Gid)); err != nil {
+		return fmt.Errorf("failed to preserve ownership of %s: %w", path, err)
+	}
+	return nil
+}
 
-	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
-		f.Close()
-		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+// SyncDir fsyncs a directory so a rename inside it survives power loss.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory for sync: %w", err)
 	}
+	defer d.Close()
 
-	return func() {
-		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
-		f.Close()
-	}, nil
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
 }
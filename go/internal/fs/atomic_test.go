@@ -0,0 +1,290 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var errCrash = errors.New("simulated crash")
+
+// injectCrash makes atomic writes fail at step and returns a restore function.
+func injectCrash(step string) func() {
+	original := crashPoint
+	crashPoint = func(s string) error {
+		if s == step {
+			return errCrash
+		}
+		return nil
+	}
+	return func() { crashPoint = original }
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".tmp-") {
+			t.Fatalf("temp file left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestAtomicWritesNeverTearAcrossCrashPoints(t *testing.T) {
+	writers := map[string]func(dst string) error{
+		"AtomicWriteFile": func(dst string) error {
+			return AtomicWriteFile(dst, []byte(`{"token":"new"}`), 0600)
+		},
+		"AtomicCopy": func(dst string) error {
+			src := filepath.Join(filepath.Dir(dst), "src")
+			if err := os.WriteFile(src, []byte(`{"token":"new"}`), 0600); err != nil {
+				return err
+			}
+			return AtomicCopy(src, dst, 0600)
+		},
+	}
+
+	for name, write := range writers {
+		for _, step := range []string{"written", "synced", "renamed", "dirsynced"} {
+			t.Run(name+"/"+step, func(t *testing.T) {
+				dir := t.TempDir()
+				dst := filepath.Join(dir, "auth.json")
+				if err := os.WriteFile(dst, []byte(`{"token":"old"}`), 0600); err != nil {
+					t.Fatalf("failed to write old file: %v", err)
+				}
+
+				restore := injectCrash(step)
+				err := write(dst)
+				restore()
+				if !errors.Is(err, errCrash) {
+					t.Fatalf("expected simulated crash, got %v", err)
+				}
+
+				raw, err := os.ReadFile(dst)
+				if err != nil {
+					t.Fatalf("destination missing after crash at %s: %v", step, err)
+				}
+				got := string(raw)
+				beforeRename := step == "written" || step == "synced"
+				if beforeRename && got != `{"token":"old"}` {
+					t.Fatalf("crash at %s before rename changed the file: %q", step, got)
+				}
+				if !beforeRename && got != `{"token":"new"}` {
+					t.Fatalf("crash at %s after rename left a torn file: %q", step, got)
+				}
+				assertNoTempFiles(t, dir)
+			})
+		}
+	}
+}
+
+func TestAtomicWriteSyncsBeforeRename(t *testing.T) {
+	var steps []string
+	original := crashPoint
+	crashPoint = func(s string) error {
+		steps = append(steps, s)
+		return nil
+	}
+	defer func() { crashPoint = original }()
+
+	dst := filepath.Join(t.TempDir(), "auth.json")
+	if err := AtomicWriteJSON(dst, map[string]string{"token": "x"}, 0600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	want := "written,synced,renamed,dirsynced"
+	if got := strings.Join(steps, ","); got != want {
+		t.Fatalf("expected steps %s, got %s", want, got)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %o", info.Mode().Perm())
+	}
+}
+
+func TestAtomicWriteSymlinkedDestination(t *testing.T) {
+	dir := t.TempDir()
+	realDir := filepath.Join(dir, "vault")
+	if err := os.MkdirAll(realDir, 0700); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	target := filepath.Join(realDir, "auth.json")
+	link := filepath.Join(dir, "auth.json")
+
+	reset := func() {
+		os.Remove(link)
+		os.WriteFile(target, []byte("old"), 0600)
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("failed to create symlink: %v", err)
+		}
+	}
+
+	// Default (replace): the link itself is replaced and the target is left alone.
+	reset()
+	if err := AtomicWriteFile(link, []byte("new"), 0600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink != 0 {
+		t.Fatalf("expected link to be replaced by a regular file")
+	}
+	if raw, _ := os.ReadFile(target); string(raw) != "old" {
+		t.Fatalf("expected link target untouched, got %q", raw)
+	}
+
+	// Write-through: the target is replaced atomically in its own directory.
+	reset()
+	if err := AtomicWriteFile(link, []byte("new"), 0600, WriteOptions{Symlinks: SymlinkWriteThrough}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected link to be kept")
+	}
+	if raw, _ := os.ReadFile(target); string(raw) != "new" {
+		t.Fatalf("expected link target updated, got %q", raw)
+	}
+	assertNoTempFiles(t, realDir)
+
+	// Refuse: nothing is written, through either writer.
+	reset()
+	src := filepath.Join(dir, "src")
+	os.WriteFile(src, []byte("new"), 0600)
+	refuse := WriteOptions{Symlinks: SymlinkRefuse}
+	if err := AtomicWriteFile(link, []byte("new"), 0600, refuse); !errors.Is(err, ErrSymlinkRefused) {
+		t.Fatalf("expected ErrSymlinkRefused, got %v", err)
+	}
+	if err := AtomicCopy(src, link, 0600, refuse); !errors.Is(err, ErrSymlinkRefused) {
+		t.Fatalf("expected ErrSymlinkRefused from AtomicCopy, got %v", err)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected link to be kept")
+	}
+	if raw, _ := os.ReadFile(target); string(raw) != "old" {
+		t.Fatalf("expected link target untouched, got %q", raw)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+func TestParseSymlinkPolicy(t *testing.T) {
+	if p, err := ParseSymlinkPolicy(""); err != nil || p != SymlinkReplace {
+		t.Fatalf("expected empty policy to default to replace, got %q, %v", p, err)
+	}
+	if _, err := ParseSymlinkPolicy("follow"); err == nil {
+		t.Fatalf("expected unknown policy to be rejected")
+	}
+}
+
+func TestAtomicWritePreservesOwnership(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing ownership requires root")
+	}
+
+	dst := filepath.Join(t.TempDir(), "auth.json")
+	if err := os.WriteFile(dst, []byte("old"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Chown(dst, 1234, 5678); err != nil {
+		t.Fatalf("failed to chown: %v", err)
+	}
+
+	if err := AtomicWriteFile(dst, []byte("new"), 0600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	if st.Uid != 1234 || st.Gid != 5678 {
+		t.Fatalf("expected owner 1234:5678, got %d:%d", st.Uid, st.Gid)
+	}
+}
+
+func TestShredOverwritesFileAndSparesLinkTargets(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret.json")
+	if err := os.WriteFile(secret, []byte(`{"token":"secret"}`), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	// A second hard link shows what happened to the blocks behind the shredded name.
+	witness := filepath.Join(dir, "witness")
+	if err := os.Link(secret, witness); err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+
+	if err := Shred(secret); err != nil {
+		t.Fatalf("shred failed: %v", err)
+	}
+	if _, err := os.Lstat(secret); !os.IsNotExist(err) {
+		t.Fatalf("expected file removed, got %v", err)
+	}
+	if raw, _ := os.ReadFile(witness); len(raw) != len(`{"token":"secret"}`) || strings.Contains(string(raw), "secret") {
+		t.Fatalf("expected contents overwritten, got %q", raw)
+	}
+
+	target := filepath.Join(dir, "vault.json")
+	os.WriteFile(target, []byte(`{"token":"vault"}`), 0600)
+	link := filepath.Join(dir, "link.json")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := Shred(link); err != nil {
+		t.Fatalf("shred failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(target); string(raw) != `{"token":"vault"}` {
+		t.Fatalf("expected link target untouched, got %q", raw)
+	}
+	if err := Shred(link); err != nil {
+		t.Fatalf("expected shredding a missing file to succeed, got %v", err)
+	}
+}
+
+func TestWatchSignalsReplacedFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "auth.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := Watch(ctx, []string{file})
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+
+	expect := func(want bool, what string) {
+		t.Helper()
+		wait := 2 * time.Second
+		if !want {
+			wait = 3 * watchPollInterval / 2
+		}
+		select {
+		case <-changes:
+			if !want {
+				t.Fatalf("unexpected signal after %s", what)
+			}
+		case <-time.After(wait):
+			if want {
+				t.Fatalf("expected a signal after %s", what)
+			}
+		}
+	}
+
+	if err := AtomicWriteFile(file, []byte(`{"token":"a"}`), 0600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	expect(true, "an atomic write")
+	os.WriteFile(filepath.Join(dir, "other.json"), []byte("{}"), 0600)
+	expect(false, "writing another file")
+	os.Remove(file)
+	expect(true, "a removal")
+}
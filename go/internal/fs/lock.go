@@ -0,0 +1,152 @@
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// LockOptions configures LockContext.
+type LockOptions struct {
+	// Shared takes a shared (reader) lock instead of an exclusive one.
+	Shared bool
+	// Try fails immediately with a *LockedError instead of waiting.
+	Try bool
+	// Holder describes the exclusive holder for diagnostics; defaults to the command line.
+	Holder string
+}
+
+// LockHolder is the diagnostic record an exclusive holder writes into the lock file.
+type LockHolder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+// LockedError reports that a lock could not be acquired in time.
+type LockedError struct {
+	Path   string
+	Holder *LockHolder // nil when held by readers or an older codex-mp
+}
+
+func (e *LockedError) Error() string {
+	if e.Holder == nil {
+		return "locked by another process"
+	}
+	return fmt.Sprintf("locked by pid %d (%s) for %s", e.Holder.PID, e.Holder.Command, time.Since(e.Holder.Since).Round(time.Second))
+}
+
+// Lock acquires an exclusive lock on a file path, waiting as long as needed.
+// It returns a release function that must be called to unlock.
+func Lock(path string) (func(), error) {
+	return LockContext(context.Background(), path, LockOptions{})
+}
+
+// LockContext acquires a lock on a file path, giving up with a *LockedError when ctx
+// is done or, in try mode, when the lock is already held.
+// It returns a release function that must be called to unlock.
+func LockContext(ctx context.Context, path string, opts LockOptions) (func(), error) {
+	// Ensure directory exists
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	how := syscall.LOCK_EX
+	if opts.Shared {
+		how = syscall.LOCK_SH
+	}
+
+	if ctx.Done() == nil && !opts.Try {
+		if err := syscall.Flock(int(f.Fd()), how); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to acquire lock: %w", err)
+		}
+	} else {
+		delay := 10 * time.Millisecond
+		for {
+			err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, syscall.EWOULDBLOCK) {
+				f.Close()
+				return nil, fmt.Errorf("failed to acquire lock: %w", err)
+			}
+			if opts.Try {
+				f.Close()
+				return nil, lockedError(path)
+			}
+
+			select {
+			case <-ctx.Done():
+				f.Close()
+				return nil, lockedError(path)
+			case <-time.After(delay):
+			}
+			if delay < 200*time.Millisecond {
+				delay *= 2
+			}
+		}
+	}
+
+	if !opts.Shared {
+		writeHolder(f, opts.Holder)
+	}
+
+	return func() {
+		if !opts.Shared {
+			f.Truncate(0)
+		}
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// ReadLockHolder returns the holder recorded in a lock file, if any.
+func ReadLockHolder(path string) (*LockHolder, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var holder LockHolder
+	if err := json.Unmarshal(raw, &holder); err != nil || holder.PID == 0 {
+		return nil, nil
+	}
+	return &holder, nil
+}
+
+func lockedError(path string) error {
+	holder, _ := ReadLockHolder(path)
+	return &LockedError{Path: path, Holder: holder}
+}
+
+// writeHolder records the current process in the lock file. Diagnostics are best effort.
+func writeHolder(f *os.File, command string) {
+	if command == "" {
+		command = strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " ")
+	}
+	raw, err := json.Marshal(LockHolder{PID: os.Getpid(), Command: command, Since: time.Now()})
+	if err != nil {
+		return
+	}
+	if err := f.Truncate(0); err != nil {
+		return
+	}
+	f.WriteAt(raw, 0)
+}
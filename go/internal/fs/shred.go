@@ -0,0 +1,67 @@
+package fs
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Shred overwrites a regular file with random bytes, syncs it and removes it.
+// A symlink is removed without touching its target. A missing file is not an error.
+//
+// On copy-on-write or journaling filesystems and SSDs an overwrite may not reach
+// the original blocks; Shred is a best effort on top of removal, not a guarantee.
+func Shred(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	if info.Mode().IsRegular() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open %s for overwrite: %w", path, err)
+		}
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to overwrite %s: %w", path, err)
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return SyncDir(filepath.Dir(path))
+}
+
+// ShredTree shreds every regular file under dir and then removes dir.
+func ShredTree(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		return Shred(path)
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+)
+
+// watchPollInterval is how often the polling watcher checks files for changes.
+var watchPollInterval = 500 * time.Millisecond
+
+// notify sends a signal on ch without blocking; a pending signal already covers it.
+func notify(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// fileStamp identifies a version of a file for the polling watcher.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+	inode   any
+}
+
+func stampOf(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime(), inode: info.Sys()}
+}
+
+// pollWatch signals on ch whenever one of files is created, changed, replaced or
+// removed, checking every watchPollInterval until ctx is done.
+func pollWatch(ctx context.Context, files []string, ch chan<- struct{}) {
+	stamps := make([]fileStamp, len(files))
+	for i, f := range files {
+		stamps[i] = stampOf(f)
+	}
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for i, f := range files {
+			if s := stampOf(f); !stampsEqual(s, stamps[i]) {
+				stamps[i] = s
+				notify(ch)
+			}
+		}
+	}
+}
+
+func stampsEqual(a, b fileStamp) bool {
+	if a.exists != b.exists || a.size != b.size || !a.modTime.Equal(b.modTime) {
+		return false
+	}
+	return sameInode(a.inode, b.inode)
+}
+
+// sameInode compares the inodes in two os.FileInfo.Sys values, so a file replaced by a
+// rename with the same size and modification time still counts as changed.
+func sameInode(a, b any) bool {
+	sa, okA := a.(*syscall.Stat_t)
+	sb, okB := b.(*syscall.Stat_t)
+	return okA == okB && (!okA || sa.Ino == sb.Ino)
+}
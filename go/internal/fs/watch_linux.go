@@ -0,0 +1,66 @@
+//go:build linux
+
+package fs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Watch signals on the returned channel whenever one of files is written, replaced
+// (e.g. by an atomic rename), created or removed. Signals are coalesced: one pending
+// signal stands for any number of changes. On Linux it uses inotify on the parent
+// directories, which must exist; elsewhere it polls. It stops when ctx is done.
+func Watch(ctx context.Context, files []string) (<-chan struct{}, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start watcher: %w", err)
+	}
+
+	names := map[int]map[string]bool{} // watch descriptor -> base names of interest
+	for _, f := range files {
+		dir := filepath.Dir(f)
+		wd, err := unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO|unix.IN_MOVED_FROM|unix.IN_DELETE)
+		if err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		if names[wd] == nil {
+			names[wd] = map[string]bool{}
+		}
+		names[wd][filepath.Base(f)] = true
+	}
+
+	ch := make(chan struct{}, 1)
+	go func() {
+		defer unix.Close(fd)
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		for ctx.Err() == nil {
+			// Poll with a timeout so cancellation is noticed without closing fd under a read.
+			n, err := unix.Poll([]unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}, 200)
+			if err != nil && err != unix.EINTR {
+				return
+			}
+			if n <= 0 {
+				continue
+			}
+			n, err = unix.Read(fd, buf)
+			if err != nil || n <= 0 {
+				continue
+			}
+			for off := 0; off+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				name := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+				if names[int(ev.Wd)][unix.ByteSliceToString(name)] || ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+					notify(ch)
+				}
+				off += unix.SizeofInotifyEvent + int(ev.Len)
+			}
+		}
+	}()
+	return ch, nil
+}
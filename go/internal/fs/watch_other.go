@@ -0,0 +1,15 @@
+//go:build !linux
+
+package fs
+
+import "context"
+
+// Watch signals on the returned channel whenever one of files is written, replaced
+// (e.g. by an atomic rename), created or removed. Signals are coalesced: one pending
+// signal stands for any number of changes. On Linux it uses inotify on the parent
+// directories, which must exist; elsewhere it polls. It stops when ctx is done.
+func Watch(ctx context.Context, files []string) (<-chan struct{}, error) {
+	ch := make(chan struct{}, 1)
+	go pollWatch(ctx, files, ch)
+	return ch, nil
+}
@@ -0,0 +1,29 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStampsNoticeReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "auth.json")
+	os.WriteFile(file, []byte(`{"token":"a"}`), 0600)
+	before := stampOf(file)
+	if !stampsEqual(before, stampOf(file)) {
+		t.Fatalf("expected an unchanged file to keep its stamp")
+	}
+
+	// Same size and modification time, but a different file renamed into place.
+	info, _ := os.Stat(file)
+	replacement := filepath.Join(dir, "new")
+	os.WriteFile(replacement, []byte(`{"token":"b"}`), 0600)
+	os.Chtimes(replacement, info.ModTime(), info.ModTime())
+	if err := os.Rename(replacement, file); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if stampsEqual(before, stampOf(file)) {
+		t.Fatalf("expected a replaced file to get a new stamp")
+	}
+}
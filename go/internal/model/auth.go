@@ -1,6 +1,146 @@
 package model
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
 // Auth represents the structure of the authentication file (auth.json).
 // We use map[string]any to be flexible and preserve all fields,
 // as we don't strictly know the schema of the auth token and want to allow forward compatibility.
 type Auth map[string]any
+
+// Auth modes reported in Identity.Mode.
+const (
+	ModeChatGPT = "chatgpt"
+	ModeAPIKey  = "apikey"
+	ModeUnknown = "unknown"
+)
+
+// Identity is the non-secret account information decoded from an auth document.
+// It never carries token or key values.
+type Identity struct {
+	Mode        string     `json:"mode"`
+	Email       string     `json:"email,omitempty"`
+	AccountID   string     `json:"account_id,omitempty"`
+	Plan        string     `json:"plan,omitempty"`
+	LastRefresh *time.Time `json:"last_refresh,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // Access token expiry
+}
+
+// ParseAuth decodes an auth.json document.
+func ParseAuth(raw []byte) (Auth, error) {
+	var auth Auth
+	if err := json.Unmarshal(raw, &auth); err != nil {
+		return nil, fmt.Errorf("invalid auth document: %w", err)
+	}
+	if auth == nil {
+		return nil, fmt.Errorf("invalid auth document: not an object")
+	}
+	return auth, nil
+}
+
+// NewAPIKeyAuth returns the auth document Codex writes for an API-key login.
+func NewAPIKeyAuth(key string) (Auth, error) {
+	if key == "" {
+		return nil, fmt.Errorf("empty API key")
+	}
+	for _, r := range key {
+		if r <= ' ' || r == 0x7f {
+			return nil, fmt.Errorf("invalid API key: contains whitespace or control characters")
+		}
+	}
+	return Auth{"OPENAI_API_KEY": key, "tokens": nil, "last_refresh": nil}, nil
+}
+
+// MaskKey hides all but the prefix and last four characters of an API key,
+// e.g. sk-…wxyz, so it can be shown in output.
+func MaskKey(key string) string {
+	if len(key) < 12 {
+		return "…"
+	}
+	prefix := key[:3]
+	if i := strings.IndexByte(key[3:], '-'); i >= 0 && i < 8 {
+		prefix = key[:3+i+1]
+	}
+	return prefix + "…" + key[len(key)-4:]
+}
+
+// Env returns the environment variables that carry the document's credential to
+// tools that don't read auth.json: OPENAI_API_KEY for API-key logins. ChatGPT logins
+// have no such form and yield nil.
+func (a Auth) Env() map[string]string {
+	if key, ok := a["OPENAI_API_KEY"].(string); ok && key != "" {
+		return map[string]string{"OPENAI_API_KEY": key}
+	}
+	return nil
+}
+
+// Identity extracts account information from the document. Missing or
+// undecodable fields are left empty rather than reported as errors.
+func (a Auth) Identity() Identity {
+	id := Identity{Mode: ModeUnknown}
+
+	if ts, ok := a["last_refresh"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			id.LastRefresh = &t
+		}
+	}
+
+	tokens, _ := a["tokens"].(map[string]any)
+	if tokens != nil {
+		id.Mode = ModeChatGPT
+		if accountID, ok := tokens["account_id"].(string); ok {
+			id.AccountID = accountID
+		}
+
+		if claims := decodeJWT(tokens["id_token"]); claims != nil {
+			id.Email, _ = claims["email"].(string)
+			if authClaims, ok := claims["https://api.openai.com/auth"].(map[string]any); ok {
+				id.Plan, _ = authClaims["chatgpt_plan_type"].(string)
+				if id.AccountID == "" {
+					id.AccountID, _ = authClaims["chatgpt_account_id"].(string)
+				}
+			}
+		}
+
+		if claims := decodeJWT(tokens["access_token"]); claims != nil {
+			if exp, ok := claims["exp"].(float64); ok {
+				t := time.Unix(int64(exp), 0).UTC()
+				id.ExpiresAt = &t
+			}
+		}
+		return id
+	}
+
+	if key, ok := a["OPENAI_API_KEY"].(string); ok && key != "" {
+		id.Mode = ModeAPIKey
+	}
+	return id
+}
+
+// decodeJWT returns the claims of a JWT without verifying its signature.
+func decodeJWT(v any) map[string]any {
+	token, ok := v.(string)
+	if !ok {
+		return nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
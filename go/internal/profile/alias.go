@@ -0,0 +1,146 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+)
+
+// Aliases returns the configured alias -> profile name map.
+func Aliases(paths config.Paths) (map[string]string, error) {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Aliases == nil {
+		return map[string]string{}, nil
+	}
+	return cfg.Aliases, nil
+}
+
+// ResolveAlias returns the profile an alias points to, or name unchanged if it is not an alias.
+func ResolveAlias(name string, paths config.Paths) (string, error) {
+	aliases, err := Aliases(paths)
+	if err != nil {
+		return "", err
+	}
+	if target, ok := aliases[name]; ok {
+		return target, nil
+	}
+	return name, nil
+}
+
+// SetAlias points alias at an existing profile. An alias may not shadow a saved profile.
+func SetAlias(alias, name string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpAlias, Name: alias, To: name}, paths, false)
+	return err
+}
+
+func planAlias(plan *Plan, alias, name string, paths config.Paths) error {
+	if _, err := os.Stat(sourcePath(paths, name)); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if _, err := os.Stat(profilePath(paths, alias)); err == nil {
+		return fmt.Errorf("alias %s would shadow the profile of the same name", alias)
+	}
+	return plan.updateConfig(paths, "alias "+alias+" → "+name, func(cfg *config.Config) error {
+		if cfg.Aliases == nil {
+			cfg.Aliases = map[string]string{}
+		}
+		cfg.Aliases[alias] = name
+		return nil
+	})
+}
+
+// RemoveAlias deletes an alias.
+func RemoveAlias(alias string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpUnalias, Name: alias}, paths, false)
+	return err
+}
+
+func planUnalias(plan *Plan, alias string, paths config.Paths) error {
+	return plan.updateConfig(paths, "remove alias "+alias, func(cfg *config.Config) error {
+		if _, ok := cfg.Aliases[alias]; !ok {
+			return fmt.Errorf("alias not found: %s", alias)
+		}
+		delete(cfg.Aliases, alias)
+		return nil
+	})
+}
+
+// DefaultProfile returns the profile `use` switches to without arguments, or "".
+func DefaultProfile(paths config.Paths) (string, error) {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return "", err
+	}
+	return cfg.DefaultProfile, nil
+}
+
+// SetDefaultProfile configures the default profile. An empty name clears it.
+func SetDefaultProfile(name string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpDefault, Name: name}, paths, false)
+	return err
+}
+
+func planDefault(plan *Plan, name string, paths config.Paths) error {
+	detail := "clear the default profile"
+	if name != "" {
+		if _, err := os.Stat(sourcePath(paths, name)); os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		detail = "default profile: " + name
+	}
+	return plan.updateConfig(paths, detail, func(cfg *config.Config) error {
+		cfg.DefaultProfile = name
+		return nil
+	})
+}
+
+// PreviousProfile returns the profile that was active before the current one, or "".
+func PreviousProfile(paths config.Paths) (string, error) {
+	var name string
+	err := withSharedLock(paths, func() error {
+		var err error
+		name, err = readMarker(paths.PreviousFile)
+		return err
+	})
+	return name, err
+}
+
+// retargetConfig points aliases and the default profile at newName after a rename,
+// or drops them when newName is empty. The config is only rewritten if something changes.
+// Callers must hold the lock.
+func retargetConfig(paths config.Paths, oldName, newName string) error {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return err
+	}
+	changed := cfg.DefaultProfile == oldName
+	for _, target := range cfg.Aliases {
+		if target == oldName {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return config.Update(paths.ConfigFile, func(cfg *config.Config) error {
+		if cfg.DefaultProfile == oldName {
+			cfg.DefaultProfile = newName
+		}
+		for alias, target := range cfg.Aliases {
+			if target != oldName {
+				continue
+			}
+			if newName == "" {
+				delete(cfg.Aliases, alias)
+			} else {
+				cfg.Aliases[alias] = newName
+			}
+		}
+		return nil
+	})
+}
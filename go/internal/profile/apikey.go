@@ -0,0 +1,94 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+)
+
+// AddKey saves an API-key login for key as the profile name, without touching
+// auth.json unless name is the active profile. An existing profile is only replaced
+// with overwrite. With dryRun it only returns the plan; otherwise the change can be
+// reverted with Undo.
+func AddKey(name, key string, overwrite bool, paths config.Paths, dryRun bool) (*Plan, error) {
+	auth, err := model.NewAPIKeyAuth(key)
+	if err != nil {
+		return &Plan{Op: OpAddKey, DryRun: dryRun}, err
+	}
+	data, err := json.MarshalIndent(auth, "", "  ")
+	if err != nil {
+		return &Plan{Op: OpAddKey, DryRun: dryRun}, fmt.Errorf("failed to encode auth document: %w", err)
+	}
+	data = append(data, '\n')
+
+	op := Operation{Op: OpAddKey, Name: name, Force: overwrite, captured: &capturedAuth{data: data}}
+	return Apply(op, paths, dryRun)
+}
+
+// planAddKey plans saving the API-key document data as the profile name.
+func planAddKey(plan *Plan, name string, data []byte, overwrite bool, paths config.Paths) error {
+	if err := checkWritable(paths, name); err != nil {
+		return err
+	}
+	exists, err := checkReplace(paths, name, overwrite)
+	if err != nil {
+		return err
+	}
+	detail := "save API key as " + name
+	if exists {
+		detail = "replace " + name + " with API key"
+	}
+	opts, err := writeOptions(paths)
+	if err != nil {
+		return err
+	}
+	active, err := readActiveProfile(paths)
+	if err != nil {
+		return err
+	}
+
+	planStoreAuth(plan, paths, name, data, detail, name == active, opts)
+	plan.emit(Event{Type: EventSaved, Profile: name, Detail: "api key"})
+	return nil
+}
+
+// checkReplace reports whether the profile name exists, and fails with ErrExists if it
+// does and overwrite is not set.
+func checkReplace(paths config.Paths, name string, overwrite bool) (bool, error) {
+	if _, err := os.Lstat(profilePath(paths, name)); err != nil {
+		return false, nil
+	}
+	if !overwrite {
+		return true, fmt.Errorf("%w: %s (use --force to replace it)", ErrExists, name)
+	}
+	return true, nil
+}
+
+// planStoreAuth plans writing the auth document data as the profile name, and into
+// auth.json too if install is set. Installing is needed when name is the active
+// profile, or else switching away would sync the old auth.json back over it.
+func planStoreAuth(plan *Plan, paths config.Paths, name string, data []byte, detail string, install bool, opts fs.WriteOptions) {
+	file := profilePath(paths, name)
+	plan.add(Step{Action: StepWrite, Path: file, Mode: "0600", Detail: detail}, func() error {
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return fmt.Errorf("failed to create profile group: %w", err)
+		}
+		if err := fs.AtomicWriteFile(file, data, 0600, opts); err != nil {
+			return fmt.Errorf("failed to write profile %s: %w", name, err)
+		}
+		return nil
+	})
+	if install {
+		plan.add(Step{Action: StepWrite, Path: paths.AuthFile, Mode: "0600", Detail: "install " + name}, func() error {
+			if err := fs.AtomicWriteFile(paths.AuthFile, data, 0600, opts); err != nil {
+				return fmt.Errorf("failed to write auth file: %w", err)
+			}
+			return recordInstalled(paths, name)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package profile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+)
+
+// Batch result statuses.
+const (
+	BatchApplied    = "applied"
+	BatchPlanned    = "planned" // Would apply; dry run
+	BatchFailed     = "failed"
+	BatchRolledBack = "rolled-back"
+	BatchSkipped    = "skipped"
+)
+
+// BatchResult reports what happened to one operation.
+type BatchResult struct {
+	Index int `json:"index"`
+	Operation
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ParseBatch reads operations, one JSON object per line. Blank lines are ignored and
+// unknown fields are rejected, so a typo fails before anything runs.
+func ParseBatch(r io.Reader) ([]Operation, error) {
+	var ops []Operation
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		var op Operation
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&op); err != nil {
+			return nil, fmt.Errorf("line %d: invalid operation: %w", line, err)
+		}
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ops = append(ops, op)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read operations: %w", err)
+	}
+	return ops, nil
+}
+
+// Batch applies ops in order as one transaction under a single lock acquisition.
+// The store is snapshotted first; if any operation fails, everything already applied
+// is rolled back and the remaining operations are skipped. With dryRun, the ops run
+// against the snapshot instead, so the report shows exactly what would happen while
+// the live store is never touched. A batch that applies is undone as a whole.
+func Batch(ops []Operation, paths config.Paths, dryRun bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = BatchResult{Index: i, Operation: op, Status: BatchSkipped}
+	}
+
+	err := withLock(paths, func() error {
+		snap, err := takeSnapshot(paths)
+		if err != nil {
+			return err
+		}
+		defer snap.discard()
+
+		target, done := paths, BatchApplied
+		var rec *undoRecorder
+		if dryRun {
+			target, done = snap.Paths, BatchPlanned
+		} else if paths.UndoDir != "" {
+			if rec, err = beginUndo(paths); err != nil {
+				return err
+			}
+		}
+
+		var events []Event
+		for i, op := range ops {
+			plan, err := runOp(op, target, rec)
+			if err != nil {
+				if rec != nil {
+					rec.abandon()
+				}
+				results[i].Status = BatchFailed
+				results[i].Error = err.Error()
+				if dryRun {
+					return fmt.Errorf("operation %d (%s) would fail: %w", i+1, op.Op, err)
+				}
+				perr := rollbackPolicy(snap, paths)
+				if rerr := snap.restore(paths); rerr != nil {
+					return fmt.Errorf("operation %d (%s) failed: %v; %w", i+1, op.Op, err, rerr)
+				}
+				for j := 0; j < i; j++ {
+					results[j].Status = BatchRolledBack
+				}
+				if perr != nil {
+					return fmt.Errorf("operation %d (%s) failed, batch rolled back: %v; %w", i+1, op.Op, err, perr)
+				}
+				return fmt.Errorf("operation %d (%s) failed, batch rolled back: %w", i+1, op.Op, err)
+			}
+			results[i].Status = done
+			events = append(events, plan.events...)
+		}
+		if dryRun {
+			return nil
+		}
+		// Purges leave nothing to undo, so a batch of only purges records no entry.
+		if rec != nil && len(rec.entry.Files) == 0 {
+			rec.abandon()
+		} else if rec != nil {
+			if err := rec.commit(); err != nil {
+				return err
+			}
+		}
+		journalEvents(paths, events)
+		return nil
+	})
+	return results, err
+}
+
+// rollbackPolicy judges the switch a rollback makes when it reinstalls the profile that was
+// active before the batch, against the snapshotted profiles and tags. The rollback still
+// runs, since it only returns to where the batch started, but a block is journaled and
+// reported with ErrPolicyBlocked like any other switch.
+func rollbackPolicy(snap *snapshot, paths config.Paths) error {
+	before, err := readActiveProfile(snap.Paths)
+	if err != nil || before == "" {
+		return err
+	}
+	if current, _ := readActiveProfile(paths); current == before {
+		return nil
+	}
+	check := &Plan{Op: "batch rollback"}
+	err = planPolicy(check, before, snap.Paths)
+	if errors.Is(err, ErrPolicyBlocked) {
+		journalEvents(paths, []Event{policyEvent(*check.Policy, check.Op)})
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+)
+
+// ErrManaged is wrapped by mutations of a profile that belongs to a catalog.
+var ErrManaged = errors.New("profile is managed by a catalog and read-only")
+
+// Catalog is a subscribed directory of shared, read-only profiles. Its profiles are
+// listed under the catalog name as a group, e.g. platform/ci-bot.
+type Catalog struct {
+	Name   string `json:"name"`
+	Dir    string `json:"dir"`
+	Exists bool   `json:"exists"`
+}
+
+// loadCatalogs returns the subscribed catalogs by name.
+func loadCatalogs(paths config.Paths) (map[string]string, error) {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Catalogs, nil
+}
+
+// catalogFile returns the file and catalog of a managed profile name.
+func catalogFile(catalogs map[string]string, name string) (string, string, bool) {
+	catalog, rest, ok := strings.Cut(name, "/")
+	if !ok {
+		return "", "", false
+	}
+	dir, ok := catalogs[catalog]
+	if !ok {
+		return "", "", false
+	}
+	return filepath.Join(dir, filepath.FromSlash(rest)+".json"), catalog, true
+}
+
+// sourcePath returns the file to read the profile name from: its catalog file if it
+// is managed, or its file in the store.
+func sourcePath(paths config.Paths, name string) string {
+	catalogs, _ := loadCatalogs(paths)
+	if file, _, ok := catalogFile(catalogs, name); ok {
+		return file
+	}
+	return profilePath(paths, name)
+}
+
+// checkWritable fails if name belongs to a catalog, so it can't be saved over,
+// renamed, deleted or restored into.
+func checkWritable(paths config.Paths, name string) error {
+	catalogs, err := loadCatalogs(paths)
+	if err != nil {
+		return err
+	}
+	if _, catalog, ok := catalogFile(catalogs, name); ok {
+		return fmt.Errorf("%w: %s (from catalog %s)", ErrManaged, name, catalog)
+	}
+	return nil
+}
+
+// IsManaged reports whether name belongs to a catalog.
+func IsManaged(name string, paths config.Paths) bool {
+	return errors.Is(checkWritable(paths, name), ErrManaged)
+}
+
+// managedProfiles returns every managed profile name with its file, sorted. A catalog
+// whose directory is missing, e.g. an unmounted share, contributes nothing.
+func managedProfiles(paths config.Paths) ([]string, map[string]string, error) {
+	catalogs, err := loadCatalogs(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	files := map[string]string{}
+	for catalog, dir := range catalogs {
+		inner, err := profileNames(dir)
+		if err != nil {
+			continue
+		}
+		for _, name := range inner {
+			full := catalog + "/" + name
+			names = append(names, full)
+			files[full] = filepath.Join(dir, filepath.FromSlash(name)+".json")
+		}
+	}
+	sort.Strings(names)
+	return names, files, nil
+}
+
+// storeNames returns the saved and managed profile names, sorted so that each group's
+// members are contiguous.
+func storeNames(paths config.Paths) ([]string, error) {
+	names, err := profileNames(paths.ProfilesDir)
+	if err != nil {
+		return nil, err
+	}
+	managed, _, err := managedProfiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	names = append(names, managed...)
+	sort.Strings(names)
+	return names, nil
+}
+
+// Catalogs returns the subscribed catalogs, sorted by name.
+func Catalogs(paths config.Paths) ([]Catalog, error) {
+	catalogs, err := loadCatalogs(paths)
+	if err != nil {
+		return nil, err
+	}
+	var out []Catalog
+	for name, dir := range catalogs {
+		info, err := os.Stat(dir)
+		out = append(out, Catalog{Name: name, Dir: dir, Exists: err == nil && info.IsDir()})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// AddCatalog subscribes to the profiles in dir under name. The name may not clash
+// with a group of saved profiles.
+func AddCatalog(name, dir string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpCatalogAdd, Name: name, Dir: dir}, paths, false)
+	return err
+}
+
+func planAddCatalog(plan *Plan, name, dir string, paths config.Paths) error {
+	if info, err := os.Stat(filepath.Join(paths.ProfilesDir, name)); err == nil && info.IsDir() {
+		return fmt.Errorf("catalog %s would hide the saved profiles in group %s", name, name)
+	}
+	return plan.updateConfig(paths, "catalog "+name+" → "+dir, func(cfg *config.Config) error {
+		if cfg.Catalogs == nil {
+			cfg.Catalogs = map[string]string{}
+		}
+		cfg.Catalogs[name] = dir
+		return nil
+	})
+}
+
+// RemoveCatalog unsubscribes from a catalog. Its profiles are left alone.
+func RemoveCatalog(name string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpCatalogRemove, Name: name}, paths, false)
+	return err
+}
+
+func planRemoveCatalog(plan *Plan, name string, paths config.Paths) error {
+	return plan.updateConfig(paths, "remove catalog "+name, func(cfg *config.Config) error {
+		if _, ok := cfg.Catalogs[name]; !ok {
+			return fmt.Errorf("unknown catalog: %s", name)
+		}
+		delete(cfg.Catalogs, name)
+		return nil
+	})
+}
@@ -0,0 +1,176 @@
+package profile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+)
+
+// Current describes the profile installed in a target, as cheaply as possible.
+type Current struct {
+	Target      string `json:"target"`
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	LoggedIn    bool   `json:"logged_in"`
+	// Drift is set when auth.json no longer belongs to the account in the active marker,
+	// e.g. after a `codex login` outside codex-mp. Token refreshes are not drift.
+	Drift bool `json:"drift"`
+}
+
+// installCache remembers what codex-mp last wrote to auth.json, so CurrentProfile
+// can skip hashing while the file is unchanged.
+type installCache struct {
+	Profile     string `json:"profile"`
+	Fingerprint string `json:"fingerprint"`
+	Account     string `json:"account,omitempty"`
+	Size        int64  `json:"size"`
+	ModTime     int64  `json:"mod_time"` // Unix nanoseconds
+}
+
+// CurrentProfile reports the active profile of a target without scanning the profile
+// store. Under a shared lock it reads the marker, stats auth.json, and hashes it only
+// when it changed since codex-mp installed it.
+func CurrentProfile(paths config.Paths) (Current, error) {
+	var cur Current
+	err := withSharedLock(paths, func() error {
+		var err error
+		cur, err = currentProfile(paths)
+		return err
+	})
+	return cur, err
+}
+
+func currentProfile(paths config.Paths) (Current, error) {
+	cur := Current{Target: paths.Target}
+
+	name, err := readActiveProfile(paths)
+	if err != nil {
+		return cur, err
+	}
+	cur.Name = name
+
+	info, err := os.Stat(paths.AuthFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cur, nil
+		}
+		return cur, err
+	}
+	cur.LoggedIn = true
+
+	cache := readInstallCache(paths)
+	if cache.Profile != "" && cache.Profile == name && cache.Size == info.Size() && cache.ModTime == info.ModTime().UnixNano() {
+		cur.Fingerprint = cache.Fingerprint
+		return cur, nil
+	}
+
+	raw, err := os.ReadFile(paths.AuthFile)
+	if err != nil {
+		return cur, err
+	}
+	cur.Fingerprint = fingerprintBytes(raw)
+	if name == "" {
+		return cur, nil
+	}
+
+	// Compare by account when both sides are decodable, so refreshed tokens don't count as drift.
+	want := cache.Account
+	wantFp := cache.Fingerprint
+	if cache.Profile != name {
+		saved, err := os.ReadFile(sourcePath(paths, name))
+		if err != nil {
+			cur.Drift = true
+			return cur, nil
+		}
+		want, wantFp = accountKey(saved), fingerprintBytes(saved)
+	}
+	if got := accountKey(raw); want != "" && got != "" {
+		cur.Drift = got != want
+	} else {
+		cur.Drift = cur.Fingerprint != wantFp
+	}
+	return cur, nil
+}
+
+// recordInstalled caches the state of auth.json right after codex-mp wrote it.
+// Callers must hold the lock.
+func recordInstalled(paths config.Paths, name string) error {
+	if paths.CacheFile == "" {
+		return nil
+	}
+
+	raw, err := os.ReadFile(paths.AuthFile)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(paths.AuthFile)
+	if err != nil {
+		return err
+	}
+
+	return fs.AtomicWriteJSON(paths.CacheFile, installCache{
+		Profile:     name,
+		Fingerprint: fingerprintBytes(raw),
+		Account:     accountKey(raw),
+		Size:        info.Size(),
+		ModTime:     info.ModTime().UnixNano(),
+	}, 0600)
+}
+
+func readInstallCache(paths config.Paths) installCache {
+	var cache installCache
+	if paths.CacheFile == "" {
+		return cache
+	}
+	raw, err := os.ReadFile(paths.CacheFile)
+	if err != nil {
+		return cache
+	}
+	if json.Unmarshal(raw, &cache) != nil {
+		return installCache{}
+	}
+	return cache
+}
+
+// accountKey identifies the account an auth document belongs to, or "" if unknown.
+// API keys are reduced to a hash so the cache never holds secrets.
+func accountKey(raw []byte) string {
+	auth, err := model.ParseAuth(raw)
+	if err != nil {
+		return ""
+	}
+
+	id := auth.Identity()
+	switch {
+	case id.Mode == model.ModeChatGPT && id.AccountID != "":
+		return "chatgpt:" + id.AccountID
+	case id.Mode == model.ModeChatGPT && id.Email != "":
+		return "chatgpt:" + id.Email
+	case id.Mode == model.ModeAPIKey:
+		key, _ := auth["OPENAI_API_KEY"].(string)
+		sum := sha256.Sum256([]byte(key))
+		return "apikey:" + hex.EncodeToString(sum[:8])
+	}
+	return ""
+}
+
+func fingerprintBytes(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Who returns the fingerprint of the target's auth.json under a shared lock.
+func Who(paths config.Paths) (string, error) {
+	var fp string
+	err := withSharedLock(paths, func() error {
+		var err error
+		fp, err = GetFingerprint(paths.AuthFile)
+		return err
+	})
+	return fp, err
+}
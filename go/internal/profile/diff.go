@@ -0,0 +1,197 @@
+package profile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+)
+
+// LiveAuth is the label Diff uses for the target's auth.json.
+const LiveAuth = "auth.json"
+
+// Diff verdicts, from closest to furthest apart.
+const (
+	VerdictIdentical      = "identical"       // Byte-for-byte equal
+	VerdictSameGeneration = "same-generation" // Same account and refresh token (or API key)
+	VerdictSameAccount    = "same-account"    // Same account, different token generation
+	VerdictUnrelated      = "unrelated"       // Different or unknown accounts
+)
+
+// Key change kinds reported in KeyDiff.Change.
+const (
+	KeyEqual   = "equal"
+	KeyChanged = "changed"
+	KeyOnlyA   = "only-a"
+	KeyOnlyB   = "only-b"
+)
+
+// KeyDiff says how one leaf key, in dotted form, differs between two auth documents.
+// Values are never included.
+type KeyDiff struct {
+	Key    string `json:"key"`
+	Change string `json:"change"`
+}
+
+// Comparison is the secret-free result of Diff.
+type Comparison struct {
+	A         string         `json:"a"`
+	B         string         `json:"b"`
+	IdentityA model.Identity `json:"identity_a"`
+	IdentityB model.Identity `json:"identity_b"`
+	Keys      []KeyDiff      `json:"keys"`
+	Verdict   string         `json:"verdict"`
+	// Newer names the side with the later last_refresh, if both have one and they differ.
+	Newer string `json:"newer,omitempty"`
+}
+
+// Diff compares two saved profiles structurally. An empty name stands for the live
+// auth.json of the target. Only key names, decoded identities and a verdict are
+// returned; token and key values never leave this function.
+func Diff(a, b string, paths config.Paths) (Comparison, error) {
+	cmp := Comparison{A: a, B: b}
+	err := withSharedLock(paths, func() error {
+		rawA, label, err := readAuthDocument(a, paths)
+		if err != nil {
+			return err
+		}
+		cmp.A = label
+		rawB, label, err := readAuthDocument(b, paths)
+		if err != nil {
+			return err
+		}
+		cmp.B = label
+
+		authA, err := model.ParseAuth(rawA)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cmp.A, err)
+		}
+		authB, err := model.ParseAuth(rawB)
+		if err != nil {
+			return fmt.Errorf("%s: %w", cmp.B, err)
+		}
+
+		cmp.IdentityA, cmp.IdentityB = authA.Identity(), authB.Identity()
+		cmp.Keys = diffKeys(authA, authB)
+		cmp.Verdict = verdict(rawA, rawB, authA, authB)
+		if ra, rb := cmp.IdentityA.LastRefresh, cmp.IdentityB.LastRefresh; ra != nil && rb != nil {
+			switch {
+			case ra.After(*rb):
+				cmp.Newer = cmp.A
+			case rb.After(*ra):
+				cmp.Newer = cmp.B
+			}
+		}
+		return nil
+	})
+	return cmp, err
+}
+
+// readAuthDocument reads a saved profile, or the live auth.json for an empty name,
+// and returns it with its display label.
+func readAuthDocument(name string, paths config.Paths) ([]byte, string, error) {
+	if name == "" {
+		raw, err := os.ReadFile(paths.AuthFile)
+		if os.IsNotExist(err) {
+			return nil, LiveAuth, fmt.Errorf("missing auth file: %s", paths.AuthFile)
+		}
+		return raw, LiveAuth, err
+	}
+
+	if err := ValidateName(name); err != nil {
+		return nil, name, err
+	}
+	raw, err := os.ReadFile(sourcePath(paths, name))
+	if os.IsNotExist(err) {
+		return nil, name, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return raw, name, err
+}
+
+func verdict(rawA, rawB []byte, a, b model.Auth) string {
+	if bytes.Equal(rawA, rawB) {
+		return VerdictIdentical
+	}
+	accountA, accountB := accountKey(rawA), accountKey(rawB)
+	if accountA == "" || accountA != accountB {
+		return VerdictUnrelated
+	}
+	if genA := generationKey(a); genA != "" && genA == generationKey(b) {
+		return VerdictSameGeneration
+	}
+	return VerdictSameAccount
+}
+
+// generationKey hashes the long-lived credential of a document: the refresh token for
+// ChatGPT logins, or the API key. A re-login produces a new generation; an access token
+// refresh does not.
+func generationKey(auth model.Auth) string {
+	var secret string
+	if tokens, ok := auth["tokens"].(map[string]any); ok {
+		secret, _ = tokens["refresh_token"].(string)
+	}
+	if secret == "" {
+		secret, _ = auth["OPENAI_API_KEY"].(string)
+	}
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// diffKeys compares the leaf keys of two documents, sorted by key.
+func diffKeys(a, b model.Auth) []KeyDiff {
+	leavesA, leavesB := map[string]any{}, map[string]any{}
+	flattenLeaves("", map[string]any(a), leavesA)
+	flattenLeaves("", map[string]any(b), leavesB)
+
+	keys := make([]string, 0, len(leavesA)+len(leavesB))
+	for k := range leavesA {
+		keys = append(keys, k)
+	}
+	for k := range leavesB {
+		if _, ok := leavesA[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := make([]KeyDiff, 0, len(keys))
+	for _, k := range keys {
+		va, inA := leavesA[k]
+		vb, inB := leavesB[k]
+		change := KeyEqual
+		switch {
+		case !inB:
+			change = KeyOnlyA
+		case !inA:
+			change = KeyOnlyB
+		case !reflect.DeepEqual(va, vb):
+			change = KeyChanged
+		}
+		diffs = append(diffs, KeyDiff{Key: k, Change: change})
+	}
+	return diffs
+}
+
+// flattenLeaves collects the non-object values of doc keyed by their dotted path.
+func flattenLeaves(prefix string, doc map[string]any, out map[string]any) {
+	for k, v := range doc {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]any); ok && len(nested) > 0 {
+			flattenLeaves(key, nested, out)
+			continue
+		}
+		out[key] = v
+	}
+}
@@ -0,0 +1,158 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+)
+
+// Check severities reported by Doctor.
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// Check is one finding of Doctor.
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Doctor inspects the store without modifying it: the symlink policy and how it applies
+// to auth.json and each profile, permissions, and the active marker. It takes no lock,
+// so it works while another process holds one.
+func Doctor(paths config.Paths) ([]Check, error) {
+	var checks []Check
+	add := func(name, status, format string, args ...any) {
+		checks = append(checks, Check{Name: name, Status: status, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	policy := fs.SymlinkReplace
+	if opts, err := writeOptions(paths); err != nil {
+		add("config", CheckFail, "%v", err)
+	} else {
+		policy = opts.Symlinks
+		add("config", CheckOK, "symlink policy: %s", policy)
+	}
+	if _, err := trashRetention(paths); err != nil {
+		add("config", CheckFail, "%v", err)
+	}
+
+	for _, dir := range storageDirs(paths) {
+		info, err := os.Stat(dir)
+		switch {
+		case os.IsNotExist(err):
+			add(dir, CheckWarn, "missing (run codex-mp init)")
+		case err != nil:
+			add(dir, CheckFail, "%v", err)
+		case info.Mode().Perm() != 0700:
+			add(dir, CheckWarn, "mode %04o, expected 0700", info.Mode().Perm())
+		default:
+			add(dir, CheckOK, "mode 0700")
+		}
+	}
+
+	for _, dir := range []string{paths.TrashDir, paths.UndoDir} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && info.Mode().Perm() != 0700 {
+			add(dir, CheckWarn, "mode %04o, expected 0700 (holds copies of tokens)", info.Mode().Perm())
+		}
+	}
+
+	checkSecretFile(paths.AuthFile, policy, "codex-mp use", add)
+
+	names, err := profileNames(paths.ProfilesDir)
+	if err != nil {
+		return checks, err
+	}
+	for _, name := range names {
+		checkSecretFile(profilePath(paths, name), policy, "codex-mp save and switching away", add)
+	}
+
+	if catalogs, err := Catalogs(paths); err == nil {
+		for _, c := range catalogs {
+			if !c.Exists {
+				add(c.Dir, CheckWarn, "catalog %s: directory missing (unmounted?)", c.Name)
+			} else {
+				add(c.Dir, CheckOK, "catalog %s", c.Name)
+			}
+		}
+	}
+
+	if raw, err := os.ReadFile(paths.ActiveFile); err == nil {
+		name := strings.TrimSpace(string(raw))
+		if ValidateName(name) != nil {
+			add(paths.ActiveFile, CheckWarn, "invalid profile name %q", name)
+		} else if _, err := os.Stat(sourcePath(paths, name)); err != nil {
+			add(paths.ActiveFile, CheckWarn, "active profile %q does not exist", name)
+		} else {
+			add(paths.ActiveFile, CheckOK, "active profile %s", name)
+		}
+	}
+
+	if holder, _ := fs.ReadLockHolder(paths.LockFile); holder != nil {
+		add(paths.LockFile, CheckWarn, "held by pid %d (%s)", holder.PID, holder.Command)
+	}
+
+	return checks, nil
+}
+
+// checkSecretFile reports the mode of an auth document and what writes to it will do under policy.
+// writer names the commands that write the file, for the symlink findings.
+func checkSecretFile(path string, policy fs.SymlinkPolicy, writer string, add func(name, status, format string, args ...any)) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		add(path, CheckWarn, "missing")
+		return
+	} else if err != nil {
+		add(path, CheckFail, "%v", err)
+		return
+	}
+
+	linked := info.Mode()&os.ModeSymlink != 0
+	if linked {
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			add(path, CheckFail, "dangling symlink: %v", err)
+			return
+		}
+		switch policy {
+		case fs.SymlinkRefuse:
+			add(path, CheckFail, "symlink to %s; %s will refuse to write it", target, writer)
+		case fs.SymlinkWriteThrough:
+			add(path, CheckOK, "symlink to %s; writes go to the target", target)
+		default:
+			add(path, CheckWarn, "symlink to %s; %s will replace the link with a regular file", target, writer)
+		}
+		if info, err = os.Stat(target); err != nil {
+			add(path, CheckFail, "%v", err)
+			return
+		}
+	}
+
+	if info.Mode().Perm() != 0600 {
+		add(path, CheckWarn, "mode %04o, expected 0600", info.Mode().Perm())
+		return
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		add(path, CheckFail, "%v", err)
+		return
+	}
+	if !json.Valid(raw) {
+		add(path, CheckFail, "not valid JSON")
+		return
+	}
+	if !linked {
+		add(path, CheckOK, "mode 0600")
+	}
+}
@@ -0,0 +1,39 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+)
+
+// Env returns the environment variables for the profile name's credential, read
+// under the shared lock. Profiles without an API key, i.e. ChatGPT logins, are an error.
+func Env(name string, paths config.Paths) (map[string]string, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	var raw []byte
+	err := withSharedLock(paths, func() error {
+		var err error
+		raw, err = os.ReadFile(sourcePath(paths, name))
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := model.ParseAuth(raw)
+	if err != nil {
+		return nil, err
+	}
+	env := auth.Env()
+	if len(env) == 0 {
+		return nil, fmt.Errorf("profile %s has no API key to export (mode: %s)", name, auth.Identity().Mode)
+	}
+	return env, nil
+}
@@ -0,0 +1,293 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+)
+
+// Event types.
+const (
+	EventSwitched       = "switched"
+	EventSaved          = "saved"
+	EventDeleted        = "deleted"
+	EventRenamed        = "renamed"
+	EventCopied         = "copied"
+	EventTagged         = "tagged"
+	EventRestored       = "restored"
+	EventSynced         = "synced" // auth.json was copied back into the profile it came from
+	EventUndone         = "undone"
+	EventExternalChange = "external-change-detected"
+	EventPolicy         = "policy-decision" // Detail starts with the decision, e.g. "block use: ..."
+)
+
+// maxEventsFileSize is the size at which the journal is rotated to a single backup.
+const maxEventsFileSize = 1 << 20
+
+// Event is one change to a target's profiles. From is the previous name for switches,
+// renames, copies and restores under another name. For undone events, Profile is the
+// profile active after the undo. Drift is only set on external changes, when auth.json no longer
+// belongs to the active profile's account; a token refresh changes the fingerprint
+// without drift.
+type Event struct {
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Target      string    `json:"target"`
+	Profile     string    `json:"profile,omitempty"`
+	From        string    `json:"from,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Drift       bool      `json:"drift,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+}
+
+// emit queues an event to be journaled once the plan has executed.
+func (p *Plan) emit(ev Event) {
+	p.events = append(p.events, ev)
+}
+
+// journalEvents appends events to the journal, one JSON object per line. Callers must
+// hold the lock. Journaling is best effort: the mutation has already happened, so a
+// failure here must not report it as failed.
+func journalEvents(paths config.Paths, events []Event) {
+	if paths.EventsFile == "" || len(events) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	now := time.Now().UTC()
+	for _, ev := range events {
+		ev.Time = now
+		ev.Target = paths.Target
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if info, err := os.Stat(paths.EventsFile); err == nil && info.Size()+int64(buf.Len()) > maxEventsFileSize {
+		os.Rename(paths.EventsFile, paths.EventsFile+".1")
+	}
+	f, err := os.OpenFile(paths.EventsFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(buf.Bytes())
+}
+
+// journalTail reads events appended to the journal, following it across rotations.
+type journalTail struct {
+	path   string
+	file   *os.File
+	offset int64
+	rest   []byte // A line not yet complete
+}
+
+// openTail starts reading the journal at its end, or at its start if replay is set.
+func openTail(path string, replay bool) *journalTail {
+	t := &journalTail{path: path}
+	if path == "" {
+		return t
+	}
+	if f, err := os.Open(path); err == nil {
+		t.file = f
+		if !replay {
+			t.offset, _ = f.Seek(0, io.SeekEnd)
+		}
+	}
+	return t
+}
+
+func (t *journalTail) close() {
+	if t != nil && t.file != nil {
+		t.file.Close()
+	}
+}
+
+// drain returns the complete events appended since the last call. After a rotation
+// the rest of the old journal is read before switching to the new one.
+func (t *journalTail) drain() []Event {
+	if t.path == "" {
+		return nil
+	}
+	var events []Event
+	if t.file != nil {
+		events = t.read()
+	}
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return events
+	}
+	if t.file != nil {
+		if cur, err := t.file.Stat(); err == nil && os.SameFile(cur, info) && info.Size() >= t.offset {
+			return events
+		}
+		t.file.Close()
+	}
+	f, err := os.Open(t.path)
+	if err != nil {
+		t.file = nil
+		return events
+	}
+	t.file, t.offset, t.rest = f, 0, nil
+	return append(events, t.read()...)
+}
+
+func (t *journalTail) read() []Event {
+	data, err := io.ReadAll(io.NewSectionReader(t.file, t.offset, 1<<62))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	t.offset += int64(len(data))
+	data = append(t.rest, data...)
+
+	var events []Event
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		var ev Event
+		if json.Unmarshal(data[:i], &ev) == nil {
+			events = append(events, ev)
+		}
+		data = data[i+1:]
+	}
+	t.rest = append([]byte(nil), data...)
+	return events
+}
+
+// EventWatcher follows the events of one target. See WatchEvents.
+type EventWatcher struct {
+	ctx     context.Context
+	stop    context.CancelFunc
+	paths   config.Paths
+	changes <-chan struct{}
+	tail    *journalTail
+	last    Current
+}
+
+// WatchEvents starts watching the target in paths for events until ctx is done.
+// Mutations made by codex-mp are read from the journal; any other change to auth.json
+// or the active marker, such as a `codex login`, is reported as an external change.
+// With replay, the events still in the journal are delivered first. Events that
+// happen after WatchEvents returns are never missed; Run delivers them.
+func WatchEvents(ctx context.Context, paths config.Paths, replay bool) (*EventWatcher, error) {
+	if err := EnsureInitialized(paths); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(paths.CodexDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", paths.CodexDir, err)
+	}
+
+	files := []string{paths.AuthFile, paths.ActiveFile}
+	if paths.EventsFile != "" {
+		files = append(files, paths.EventsFile)
+	}
+	ctx, stop := context.WithCancel(ctx)
+	changes, err := fs.Watch(ctx, files)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+
+	w := &EventWatcher{ctx: ctx, stop: stop, paths: paths, changes: changes}
+	err = withSharedLock(paths, func() error {
+		w.tail = openTail(paths.EventsFile, replay)
+		var err error
+		w.last, err = currentProfile(paths)
+		return err
+	})
+	if err != nil {
+		w.tail.close()
+		stop()
+		return nil, err
+	}
+	return w, nil
+}
+
+// drain returns the new journal events of the watched target; the journal is
+// shared by all targets.
+func (w *EventWatcher) drain() []Event {
+	var events []Event
+	for _, ev := range w.tail.drain() {
+		if ev.Target == w.paths.Target {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// Run calls fn for every event until the context is done, which is not an error,
+// or fn fails.
+func (w *EventWatcher) Run(fn func(Event) error) error {
+	defer w.stop()
+	defer w.tail.close()
+
+	deliver := func(events []Event) error {
+		for _, ev := range events {
+			if err := fn(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := deliver(w.drain()); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil
+		case <-w.changes:
+		}
+
+		// The journal is written before the lock is released, so reading both under
+		// the shared lock tells codex-mp's own changes from everyone else's.
+		var events []Event
+		var cur Current
+		err := withSharedLock(w.paths, func() error {
+			events = w.drain()
+			var err error
+			cur, err = currentProfile(w.paths)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := deliver(events); err != nil {
+			return err
+		}
+		if len(events) == 0 && (cur.Name != w.last.Name || cur.Fingerprint != w.last.Fingerprint) {
+			ev := Event{
+				Type:        EventExternalChange,
+				Time:        time.Now().UTC(),
+				Target:      w.paths.Target,
+				Profile:     cur.Name,
+				Fingerprint: cur.Fingerprint,
+				Drift:       cur.Drift,
+			}
+			if cur.Name != w.last.Name {
+				ev.From = w.last.Name
+			}
+			if !cur.LoggedIn {
+				ev.Detail = "auth.json removed"
+			}
+			if err := fn(ev); err != nil {
+				return err
+			}
+		}
+		w.last = cur
+	}
+}
@@ -0,0 +1,190 @@
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+)
+
+// DefaultLoginCommand is run by Login unless login_command is configured.
+var DefaultLoginCommand = []string{"codex", "login"}
+
+// LoginOptions configures Login. Command overrides the configured login command;
+// its standard streams are connected to Stdin, Stdout and Stderr.
+type LoginOptions struct {
+	Command   []string
+	Args      []string // Appended to the command, e.g. --device-auth
+	Overwrite bool     // Replace an existing profile
+	DryRun    bool     // Only plan; the login command is not run
+	Stdin     io.Reader
+	Stdout    io.Writer
+	Stderr    io.Writer
+}
+
+// Login runs the login command with CODEX_HOME set to a fresh temporary directory and
+// saves the auth.json it produces as the profile name. The active profile is synced
+// first and auth.json is backed up; if the command changes it anyway, e.g. by ignoring
+// CODEX_HOME, the backup is restored. The lock is not held while the command runs,
+// since a browser login can take minutes. An existing profile is only replaced with
+// opts.Overwrite, checked before and after the command. With opts.DryRun it only
+// returns the plan; otherwise the saved profile can be reverted with Undo.
+func Login(name string, opts LoginOptions, paths config.Paths) (*Plan, error) {
+	op := Operation{Op: OpLogin, Name: name, Force: opts.Overwrite, captured: &capturedAuth{}}
+	if err := op.validate(); err != nil {
+		return &Plan{Op: OpLogin, DryRun: opts.DryRun}, err
+	}
+	if opts.DryRun {
+		return Apply(op, paths, true)
+	}
+	command := opts.Command
+	if len(command) == 0 {
+		cfg, err := config.Load(paths.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		command = cfg.LoginCommand
+	}
+	if len(command) == 0 {
+		command = DefaultLoginCommand
+	}
+
+	if err := EnsureInitialized(paths); err != nil {
+		return nil, err
+	}
+	// The sync-back only refreshes the active profile from the auth.json it came from,
+	// like any switch, so it is not recorded for Undo.
+	err := withLock(paths, func() error {
+		if err := checkWritable(paths, name); err != nil {
+			return err
+		}
+		if _, err := checkReplace(paths, name, opts.Overwrite); err != nil {
+			return err
+		}
+		wopts, err := writeOptions(paths)
+		if err != nil {
+			return err
+		}
+		plan := &Plan{Op: OpLogin}
+		if err := planSyncBack(plan, paths, name, wopts); err != nil {
+			return err
+		}
+		if err := plan.execute(0); err != nil {
+			return err
+		}
+		journalEvents(paths, plan.events)
+
+		op.captured.before, err = os.ReadFile(paths.AuthFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to back up auth file: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if op.captured.data, err = runLogin(command, opts, paths); err != nil {
+		return nil, err
+	}
+	return Apply(op, paths, false)
+}
+
+// planLogin plans saving a captured login as the profile name, and restoring auth.json
+// if the login command changed it. While planning a login that has not run, it plans
+// the sync-back Login makes first and the save.
+func planLogin(plan *Plan, name string, login *capturedAuth, overwrite bool, paths config.Paths) error {
+	if err := checkWritable(paths, name); err != nil {
+		return err
+	}
+	exists, err := checkReplace(paths, name, overwrite)
+	if err != nil {
+		return err
+	}
+	wopts, err := writeOptions(paths)
+	if err != nil {
+		return err
+	}
+	active, err := readActiveProfile(paths)
+	if err != nil {
+		return err
+	}
+	detail := "save login as " + name
+	if exists {
+		detail = "replace " + name + " with the new login"
+	}
+
+	if login.data == nil {
+		if !plan.DryRun {
+			return fmt.Errorf("login: no login captured")
+		}
+		if err := planSyncBack(plan, paths, name, wopts); err != nil {
+			return err
+		}
+		planStoreAuth(plan, paths, name, nil, detail+" (from the login command)", name == active, wopts)
+		return nil
+	}
+
+	// A token refresh by a running Codex is kept; another account is not.
+	backup := login.before
+	live, err := os.ReadFile(paths.AuthFile)
+	switch {
+	case backup != nil && (err != nil || (!bytes.Equal(live, backup) && accountKey(live) != accountKey(backup))):
+		plan.add(Step{Action: StepWrite, Path: paths.AuthFile, Mode: "0600", Detail: "restore auth.json changed by the login command"}, func() error {
+			if err := fs.AtomicWriteFile(paths.AuthFile, backup, 0600, wopts); err != nil {
+				return fmt.Errorf("failed to restore auth file: %w", err)
+			}
+			return nil
+		})
+	case backup == nil && err == nil:
+		plan.add(Step{Action: StepRemove, Path: paths.AuthFile, Detail: "remove auth.json written by the login command"}, func() error {
+			if err := os.Remove(paths.AuthFile); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove auth file: %w", err)
+			}
+			return nil
+		})
+	}
+	planStoreAuth(plan, paths, name, login.data, detail, name == active, wopts)
+	plan.emit(Event{Type: EventSaved, Profile: name, Detail: "login"})
+	return nil
+}
+
+// runLogin runs command in an isolated CODEX_HOME and returns the auth.json it wrote.
+// The Codex config is copied in so settings such as the login method still apply.
+func runLogin(command []string, opts LoginOptions, paths config.Paths) ([]byte, error) {
+	home, err := os.MkdirTemp("", "codex-mp-login-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login home: %w", err)
+	}
+	defer os.RemoveAll(home)
+	if raw, err := os.ReadFile(filepath.Join(paths.CodexDir, "config.toml")); err == nil {
+		if err := os.WriteFile(filepath.Join(home, "config.toml"), raw, 0600); err != nil {
+			return nil, fmt.Errorf("failed to copy Codex config: %w", err)
+		}
+	}
+
+	args := append(append([]string(nil), command[1:]...), opts.Args...)
+	cmd := exec.Command(command[0], args...)
+	cmd.Env = append(os.Environ(), "CODEX_HOME="+home)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = opts.Stdin, opts.Stdout, opts.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("login command %s failed: %w", command[0], err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, "auth.json"))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("login command %s did not write auth.json", command[0])
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read new login: %w", err)
+	}
+	if _, err := model.ParseAuth(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
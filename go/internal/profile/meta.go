@@ -0,0 +1,139 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+)
+
+// Meta is the non-secret bookkeeping kept alongside saved profiles.
+type Meta struct {
+	Tags     []string   `json:"tags,omitempty"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+// Details describes a saved profile for display.
+type Details struct {
+	ProfileStatus
+	Identity model.Identity `json:"identity"`
+	Meta
+}
+
+// loadMeta reads the metadata file. A missing file yields an empty map.
+func loadMeta(paths config.Paths) (map[string]Meta, error) {
+	meta := map[string]Meta{}
+	if paths.MetaFile == "" {
+		return meta, nil
+	}
+
+	raw, err := os.ReadFile(paths.MetaFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return nil, fmt.Errorf("failed to read profile metadata: %w", err)
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("invalid profile metadata %s: %w", paths.MetaFile, err)
+	}
+	return meta, nil
+}
+
+// updateMeta applies fn to the metadata and writes it back. Callers must hold the lock.
+func updateMeta(paths config.Paths, fn func(meta map[string]Meta)) error {
+	if paths.MetaFile == "" {
+		return nil
+	}
+
+	meta, err := loadMeta(paths)
+	if err != nil {
+		return err
+	}
+	fn(meta)
+
+	if err := fs.AtomicWriteJSON(paths.MetaFile, meta, 0600); err != nil {
+		return fmt.Errorf("failed to write profile metadata: %w", err)
+	}
+	return nil
+}
+
+// SetTags replaces the tags of a saved profile. Tags follow profile name rules.
+func SetTags(name string, tags []string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpTag, Name: name, Tags: tags}, paths, false)
+	return err
+}
+
+// cleanTags validates, dedupes and sorts tags.
+func cleanTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	var clean []string
+	for _, tag := range tags {
+		if !nameRegex.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag: %s (allowed: A-Z a-z 0-9 . _ -)", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			clean = append(clean, tag)
+		}
+	}
+	sort.Strings(clean)
+	return clean, nil
+}
+
+func planTags(plan *Plan, name string, tags []string, paths config.Paths) error {
+	if _, err := os.Stat(sourcePath(paths, name)); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	planMeta(plan, paths, "tags of "+name, func(meta map[string]Meta) {
+		m := meta[name]
+		m.Tags = tags
+		if m.Tags == nil && m.LastUsed == nil {
+			delete(meta, name)
+			return
+		}
+		meta[name] = m
+	})
+	plan.emit(Event{Type: EventTagged, Profile: name, Detail: strings.Join(tags, ",")})
+	return nil
+}
+
+// ListDetails returns every profile with its decoded identity and metadata.
+// Profiles whose auth document cannot be parsed are listed with an unknown identity.
+func ListDetails(paths config.Paths) ([]Details, error) {
+	profiles, err := List(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := loadMeta(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	details := make([]Details, 0, len(profiles))
+	for _, p := range profiles {
+		d := Details{
+			ProfileStatus: p,
+			Identity:      model.Identity{Mode: model.ModeUnknown},
+			Meta:          meta[p.Name],
+		}
+		file := p.Origin
+		if file == "" {
+			file = profilePath(paths, p.Name)
+		}
+		if raw, err := os.ReadFile(file); err == nil {
+			if auth, err := model.ParseAuth(raw); err == nil {
+				d.Identity = auth.Identity()
+			}
+		}
+		details = append(details, d)
+	}
+	return details, nil
+}
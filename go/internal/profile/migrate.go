@@ -0,0 +1,393 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+)
+
+// MigrateStorage moves saved profiles, their metadata, the trash, the event journal and the
+// active markers from one storage layout to another.
+// Profiles are staged next to the destination and renamed into place, and the config file is
+// switched to the new layout before the source is removed, so an interrupted migration leaves
+// the original storage intact and in use. It returns the number of profiles moved and the plan;
+// a dry run only plans the migration.
+func MigrateStorage(from, to config.Paths, dryRun bool) (int, *Plan, error) {
+	plan := &Plan{Op: "migrate-storage", DryRun: dryRun}
+	if from.ProfilesDir == to.ProfilesDir {
+		return 0, plan, fmt.Errorf("storage already uses the %s layout", to.Storage)
+	}
+
+	m := &migration{from: from, to: to, existed: map[string]bool{}}
+	if dryRun {
+		err := withSharedLock(from, func() error { return m.build(plan) })
+		return m.moved, plan, err
+	}
+	err := withLock(from, func() error {
+		if err := os.MkdirAll(to.StateDir, 0700); err != nil {
+			return fmt.Errorf("failed to create state directory: %w", err)
+		}
+		unlock, err := lockStore(to.LockFile, false)
+		if err != nil {
+			return fmt.Errorf("failed to acquire destination lock: %w", err)
+		}
+		defer unlock()
+
+		if err := m.build(plan); err != nil {
+			return err
+		}
+		for i, step := range plan.Steps {
+			if err := step.run(); err != nil {
+				if i <= m.commit {
+					m.rollback()
+				}
+				return err
+			}
+		}
+		return nil
+	})
+	return m.moved, plan, err
+}
+
+// migration holds what MigrateStorage found while planning, so a failure before the
+// commit point can remove exactly what the migration added.
+type migration struct {
+	from, to config.Paths
+	existed  map[string]bool // Destination directories that existed before
+	trees    [][3]string     // Source, destination, what it holds
+	journal  [][2]string     // Source, destination
+	markers  [][2]config.Paths
+	moved    int
+	commit   int // Index of the step that switches the config
+}
+
+// build checks the destination and plans the migration. Nothing is merged into
+// existing data: every destination must be missing or empty.
+func (m *migration) build(plan *Plan) error {
+	from, to := m.from, m.to
+	var err error
+	for _, tree := range [][3]string{{from.TrashDir, to.TrashDir, "trash"}, {from.SyncDir, to.SyncDir, "sync store"}} {
+		if tree[0] == "" || tree[1] == "" || tree[0] == tree[1] {
+			continue
+		}
+		if m.existed[tree[1]], err = checkEmptyDir(tree[1]); err != nil {
+			return err
+		}
+		m.trees = append(m.trees, tree)
+	}
+	if to.MetaFile != from.MetaFile {
+		if _, err := os.Lstat(to.MetaFile); err == nil {
+			return fmt.Errorf("destination is not empty: %s", to.MetaFile)
+		}
+	}
+	// The journal and its rotated backup move as they are, so usage and replay
+	// still cover switches made before the migration.
+	if from.EventsFile != "" && to.EventsFile != "" && to.EventsFile != from.EventsFile {
+		for _, suffix := range []string{"", ".1"} {
+			src, dst := from.EventsFile+suffix, to.EventsFile+suffix
+			if _, err := os.Lstat(dst); err == nil {
+				return fmt.Errorf("destination is not empty: %s", dst)
+			}
+			m.journal = append(m.journal, [2]string{src, dst})
+		}
+	}
+	if m.existed[to.ProfilesDir], err = checkEmptyDir(to.ProfilesDir); err != nil {
+		return err
+	}
+	if m.markers, err = markerPairs(from, to); err != nil {
+		return err
+	}
+	if m.moved, err = countProfiles(from.ProfilesDir); err != nil {
+		return err
+	}
+
+	plan.add(Step{Action: StepCopy, Path: to.ProfilesDir, Source: from.ProfilesDir, Detail: fmt.Sprintf("stage %d profile(s) and rename them into place", m.moved)}, func() error {
+		if err := removeEmptyDir(to.ProfilesDir); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(to.DataDir, 0700); err != nil {
+			return fmt.Errorf("failed to create data directory: %w", err)
+		}
+		staging, err := os.MkdirTemp(to.DataDir, ".profiles-migrate-*")
+		if err != nil {
+			return fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		defer os.RemoveAll(staging)
+
+		if err := copyTree(from.ProfilesDir, staging); err != nil {
+			return err
+		}
+		if err := os.Rename(staging, to.ProfilesDir); err != nil {
+			return fmt.Errorf("failed to move profiles into place: %w", err)
+		}
+		return nil
+	})
+
+	metaMoves := to.MetaFile != from.MetaFile && exists(from.MetaFile)
+	if metaMoves {
+		plan.add(Step{Action: StepCopy, Path: to.MetaFile, Source: from.MetaFile, Mode: "0600", Detail: "profile metadata"}, func() error {
+			if err := fs.AtomicCopy(from.MetaFile, to.MetaFile, 0600); err != nil {
+				return fmt.Errorf("failed to move profile metadata: %w", err)
+			}
+			return nil
+		})
+	}
+	for _, file := range m.journal {
+		file := file
+		if !exists(file[0]) {
+			continue
+		}
+		plan.add(Step{Action: StepCopy, Path: file[1], Source: file[0], Mode: "0600", Detail: "event journal"}, func() error {
+			if err := fs.AtomicCopy(file[0], file[1], 0600); err != nil {
+				return fmt.Errorf("failed to move event journal: %w", err)
+			}
+			return nil
+		})
+	}
+	for _, tree := range m.trees {
+		tree := tree
+		if !exists(tree[0]) {
+			continue
+		}
+		plan.add(Step{Action: StepCopy, Path: tree[1], Source: tree[0], Detail: tree[2]}, func() error {
+			if err := copyTree(tree[0], tree[1]); err != nil {
+				return fmt.Errorf("failed to move %s: %w", tree[2], err)
+			}
+			return nil
+		})
+	}
+	for _, pair := range m.markers {
+		pair := pair
+		activeName, err := readActiveProfile(pair[0])
+		if err != nil {
+			return err
+		}
+		if activeName == "" {
+			continue
+		}
+		plan.add(Step{Action: StepWrite, Path: pair[1].ActiveFile, Mode: "0600", Detail: "active profile: " + activeName}, func() error {
+			if err := writeActiveProfile(pair[1], activeName); err != nil {
+				return fmt.Errorf("failed to move active profile marker: %w", err)
+			}
+			return nil
+		})
+		if previous, _ := readMarker(pair[0].PreviousFile); previous != "" {
+			plan.add(Step{Action: StepWrite, Path: pair[1].PreviousFile, Mode: "0600", Detail: "previous profile: " + previous}, func() error {
+				if err := writeMarker(pair[1].PreviousFile, previous); err != nil {
+					return fmt.Errorf("failed to move previous profile marker: %w", err)
+				}
+				return nil
+			})
+		}
+	}
+
+	// Switching the config is the commit point of the migration.
+	m.commit = len(plan.Steps)
+	if err := plan.updateConfig(to, "storage: "+to.Storage, func(cfg *config.Config) error {
+		cfg.Storage = to.Storage
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	plan.add(Step{Action: StepRemove, Path: from.ProfilesDir, Detail: "old profiles directory"}, func() error {
+		if err := os.RemoveAll(from.ProfilesDir); err != nil {
+			return fmt.Errorf("migrated, but failed to remove old profiles directory: %w", err)
+		}
+		return nil
+	})
+	if metaMoves {
+		plan.add(Step{Action: StepRemove, Path: from.MetaFile, Detail: "old profile metadata"}, func() error {
+			if err := os.Remove(from.MetaFile); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("migrated, but failed to remove old profile metadata: %w", err)
+			}
+			return nil
+		})
+	}
+	for _, pair := range m.markers {
+		for _, file := range []string{pair[0].ActiveFile, pair[0].PreviousFile} {
+			file := file
+			if file == "" || !exists(file) {
+				continue
+			}
+			plan.add(Step{Action: StepRemove, Path: file, Detail: "old profile marker"}, func() error {
+				return clearMarker(file)
+			})
+		}
+	}
+	for _, tree := range m.trees {
+		tree := tree
+		if !exists(tree[0]) {
+			continue
+		}
+		plan.add(Step{Action: StepRemove, Path: tree[0], Detail: "old " + tree[2]}, func() error {
+			if err := os.RemoveAll(tree[0]); err != nil {
+				return fmt.Errorf("migrated, but failed to remove old %s: %w", tree[2], err)
+			}
+			return nil
+		})
+	}
+	// Undo entries restore paths of the old layout, so they don't carry over.
+	if from.UndoDir != "" && exists(from.UndoDir) {
+		plan.add(Step{Action: StepRemove, Path: from.UndoDir, Detail: "old undo history"}, func() error {
+			if err := os.RemoveAll(from.UndoDir); err != nil {
+				return fmt.Errorf("migrated, but failed to remove old undo history: %w", err)
+			}
+			return nil
+		})
+	}
+	for _, file := range m.journal {
+		file := file
+		if !exists(file[0]) {
+			continue
+		}
+		plan.add(Step{Action: StepRemove, Path: file[0], Detail: "old event journal"}, func() error {
+			if err := os.Remove(file[0]); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("migrated, but failed to remove old event journal: %w", err)
+			}
+			return nil
+		})
+	}
+	return nil
+}
+
+// rollback removes what the steps before the commit point added to the destination.
+func (m *migration) rollback() {
+	to := m.to
+	os.RemoveAll(to.ProfilesDir)
+	if m.existed[to.ProfilesDir] {
+		os.Mkdir(to.ProfilesDir, 0700)
+	}
+	for _, tree := range m.trees {
+		emptyOrRemoveDir(tree[1], m.existed[tree[1]])
+	}
+	if to.MetaFile != m.from.MetaFile {
+		os.Remove(to.MetaFile)
+	}
+	for _, file := range m.journal {
+		os.Remove(file[1])
+	}
+	for _, pair := range m.markers {
+		clearActiveProfile(pair[1])
+		clearMarker(pair[1].PreviousFile)
+	}
+}
+
+// markerPairs returns the (source, destination) paths of every target whose active and previous markers move.
+func markerPairs(from, to config.Paths) ([][2]config.Paths, error) {
+	cfg, err := config.Load(from.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := [][2]config.Paths{{from, to}}
+	for name, dir := range cfg.Targets {
+		src, dst := from.WithTarget(name, dir), to.WithTarget(name, dir)
+		if src.ActiveFile != dst.ActiveFile {
+			pairs = append(pairs, [2]config.Paths{src, dst})
+		}
+	}
+	return pairs, nil
+}
+
+// checkEmptyDir reports whether dir exists, and fails if it has entries.
+func checkEmptyDir(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	if len(entries) > 0 {
+		return true, fmt.Errorf("destination is not empty: %s", dir)
+	}
+	return true, nil
+}
+
+// removeEmptyDir removes dir if it exists and is empty, and fails if it has entries.
+func removeEmptyDir(dir string) error {
+	existed, err := checkEmptyDir(dir)
+	if err != nil || !existed {
+		return err
+	}
+	if err := os.Remove(dir); err != nil {
+		return fmt.Errorf("failed to remove empty %s: %w", dir, err)
+	}
+	return nil
+}
+
+// emptyOrRemoveDir undoes copying into dir: a directory that existed before is
+// emptied again, one that didn't is removed.
+func emptyOrRemoveDir(dir string, existed bool) {
+	if !existed {
+		os.RemoveAll(dir)
+		return
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		os.RemoveAll(filepath.Join(dir, e.Name()))
+	}
+}
+
+// copyTree copies regular files under src into dst, keeping their permissions.
+func copyTree(src, dst string) error {
+	err := filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == src {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := fs.AtomicCopy(path, filepath.Join(dst, rel), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy profiles: %w", err)
+	}
+	return nil
+}
+
+// countProfiles returns the number of profile files under dir; a missing dir has none.
+func countProfiles(dir string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.Type().IsRegular() && filepath.Ext(path) == ".json" {
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	return count, nil
+}
+
+// exists reports whether path exists, without following a final symlink.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,461 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+)
+
+// Operation names.
+const (
+	OpSave    = "save"
+	OpUse     = "use"
+	OpRename  = "rename"
+	OpDelete  = "delete"
+	OpTag     = "tag"
+	OpCopy    = "copy"
+	OpRestore = "restore"
+	OpAddKey  = "add-key" // Only through AddKey, which supplies the key
+	OpLogin   = "login"   // Only through Login, which runs the login command
+
+	// Config changes
+	OpAlias         = "alias"
+	OpUnalias       = "unalias"
+	OpDefault       = "default"
+	OpCatalogAdd    = "catalog-add"
+	OpCatalogRemove = "catalog-remove"
+	OpTargetAdd     = "target-add"
+	OpTargetRemove  = "target-remove"
+)
+
+// Operation describes one mutation, e.g. a batch line such as
+// {"op":"rename","from":"old","to":"new"}.
+type Operation struct {
+	Op    string   `json:"op"`
+	Name  string   `json:"name,omitempty"`  // save, use, delete, tag; restore takes a trash id or name; the alias, catalog or target of config changes
+	From  string   `json:"from,omitempty"`  // rename, copy
+	To    string   `json:"to,omitempty"`    // rename, copy; restore under another name; the profile an alias points to
+	Dir   string   `json:"dir,omitempty"`   // catalog-add, target-add
+	Tags  []string `json:"tags,omitempty"`  // tag
+	Purge bool     `json:"purge,omitempty"` // delete: shred instead of moving to the trash
+	Force bool     `json:"force,omitempty"` // add-key, login: replace an existing profile
+
+	captured *capturedAuth // add-key, login: what to store; never read from a batch
+}
+
+// capturedAuth is the auth document an add-key or login stores. For a login it also
+// holds auth.json as it was before the login command ran, nil if there was none.
+type capturedAuth struct {
+	data   []byte // nil while planning a login that has not run yet
+	before []byte
+}
+
+// String describes op briefly, e.g. "rename old → new".
+func (op Operation) String() string {
+	switch op.Op {
+	case OpRename, OpCopy:
+		return fmt.Sprintf("%s %s → %s", op.Op, op.From, op.To)
+	case OpTag:
+		return fmt.Sprintf("tag %s %v", op.Name, op.Tags)
+	case OpRestore:
+		if op.To != "" {
+			return fmt.Sprintf("restore %s as %s", op.Name, op.To)
+		}
+	case OpDelete:
+		if op.Purge {
+			return "delete --purge " + op.Name
+		}
+	case OpAlias:
+		return fmt.Sprintf("alias %s → %s", op.Name, op.To)
+	case OpCatalogAdd, OpTargetAdd:
+		return fmt.Sprintf("%s %s → %s", op.Op, op.Name, op.Dir)
+	case OpDefault:
+		if op.Name == "" {
+			return "default (clear)"
+		}
+	}
+	return op.Op + " " + op.Name
+}
+
+// validate checks the op and the names it carries, before any lock is taken.
+func (op Operation) validate() error {
+	var names []string
+	switch op.Op {
+	case OpSave, OpUse, OpDelete:
+		names = []string{op.Name}
+	case OpAddKey, OpLogin:
+		if op.captured == nil {
+			return fmt.Errorf("%s: not available in a batch", op.Op)
+		}
+		names = []string{op.Name}
+	case OpTag:
+		names = []string{op.Name}
+		if _, err := cleanTags(op.Tags); err != nil {
+			return err
+		}
+	case OpRename, OpCopy:
+		names = []string{op.From, op.To}
+	case OpRestore:
+		if op.Name == "" {
+			return fmt.Errorf("restore: missing trash id or profile name")
+		}
+		if _, err := strconv.Atoi(op.Name); err != nil {
+			names = []string{op.Name}
+		}
+		if op.To != "" {
+			names = append(names, op.To)
+		}
+	case OpAlias:
+		if op.Name == "-" {
+			return fmt.Errorf("invalid alias: - is reserved for stdin and the previous profile")
+		}
+		if op.Name == "" || ValidateName(op.Name) != nil {
+			return fmt.Errorf("invalid alias: %s", op.Name)
+		}
+		names = []string{op.To}
+	case OpUnalias, OpCatalogRemove, OpTargetRemove:
+		if op.Name == "" {
+			return fmt.Errorf("%s: missing name", op.Op)
+		}
+	case OpDefault:
+		if op.Name != "" {
+			names = []string{op.Name}
+		}
+	case OpCatalogAdd:
+		if op.Name == "" || strings.Contains(op.Name, "/") || ValidateName(op.Name) != nil {
+			return fmt.Errorf("invalid catalog name: %s", op.Name)
+		}
+	case OpTargetAdd:
+		if err := config.ValidateTargetName(op.Name); err != nil {
+			return err
+		}
+	case "":
+		return fmt.Errorf("missing op")
+	default:
+		return fmt.Errorf("unknown op: %s (allowed: save, use, rename, delete, tag, copy, restore, "+
+			"alias, unalias, default, catalog-add, catalog-remove, target-add, target-remove)", op.Op)
+	}
+	if (op.Op == OpCatalogAdd || op.Op == OpTargetAdd) != (op.Dir != "") {
+		if op.Dir == "" {
+			return fmt.Errorf("%s: missing dir", op.Op)
+		}
+		return fmt.Errorf("%s: dir only applies to catalog-add and target-add", op.Op)
+	}
+	if op.Purge && op.Op != OpDelete {
+		return fmt.Errorf("%s: purge only applies to delete", op.Op)
+	}
+	if op.Force && op.Op != OpAddKey && op.Op != OpLogin {
+		return fmt.Errorf("%s: force only applies to add-key and login", op.Op)
+	}
+
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("%s: missing profile name", op.Op)
+		}
+		if err := ValidateName(name); err != nil {
+			return fmt.Errorf("%s: %w", op.Op, err)
+		}
+	}
+	return nil
+}
+
+// Step actions.
+const (
+	StepMkdir  = "mkdir"
+	StepChmod  = "chmod"
+	StepCopy   = "copy"
+	StepWrite  = "write"
+	StepRename = "rename"
+	StepRemove = "remove"
+)
+
+// Step is one filesystem change of a Plan. Source is set for copies and renames;
+// FromMode is set when the change alters the permissions of an existing file.
+type Step struct {
+	Action   string `json:"action"`
+	Path     string `json:"path"`
+	Source   string `json:"source,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+	FromMode string `json:"from_mode,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+
+	run          func() error
+	irreversible bool // Destroys data on purpose; never captured for Undo
+}
+
+// Plan is the list of changes a mutation makes, built before anything is touched.
+// Real runs execute it; dry runs only report it, so both share the same decisions.
+type Plan struct {
+	Op     string          `json:"op"`
+	DryRun bool            `json:"dry_run"`
+	Steps  []Step          `json:"steps"`
+	Policy *PolicyDecision `json:"policy,omitempty"` // Set when a policy rule applied to a switch
+
+	events []Event // Journaled once the plan has executed; never for dry runs
+}
+
+func (p *Plan) add(step Step, run func() error) {
+	step.run = run
+	p.Steps = append(p.Steps, step)
+}
+
+// execute runs the steps from index start on, stopping at the first failure.
+func (p *Plan) execute(start int) error {
+	for _, step := range p.Steps[start:] {
+		if err := step.run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile plans an atomic copy of src to dst with mode 0600 under the symlink policy in opts.
+// A symlinked destination that the policy refuses fails planning, before anything is written.
+func (p *Plan) copyFile(src, dst string, opts fs.WriteOptions, detail string) error {
+	step := Step{Action: StepCopy, Path: dst, Source: src, Mode: "0600", Detail: detail}
+	if info, err := os.Lstat(dst); err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			switch opts.Symlinks {
+			case fs.SymlinkRefuse:
+				return fmt.Errorf("refusing to write %s: %w (symlink policy: refuse)", dst, fs.ErrSymlinkRefused)
+			case fs.SymlinkWriteThrough:
+				if target, err := filepath.EvalSymlinks(dst); err == nil {
+					step.Path = target
+					step.Detail += " (through symlink " + dst + ")"
+				}
+			default:
+				step.Detail += " (replaces symlink)"
+			}
+			info, err = os.Stat(step.Path)
+			if err != nil {
+				info = nil
+			}
+		}
+		if info != nil && info.Mode().Perm() != 0600 {
+			step.FromMode = fmt.Sprintf("%04o", info.Mode().Perm())
+		}
+	}
+
+	p.add(step, func() error {
+		return fs.AtomicCopy(src, dst, 0600, opts)
+	})
+	return nil
+}
+
+// writeMarker plans writing name into a marker file.
+func (p *Plan) writeMarker(file, name, detail string) {
+	p.add(Step{Action: StepWrite, Path: file, Mode: "0600", Detail: detail}, func() error {
+		return writeMarker(file, name)
+	})
+}
+
+// clearMarker plans removing a marker file.
+func (p *Plan) clearMarker(file, detail string) {
+	p.add(Step{Action: StepRemove, Path: file, Detail: detail}, func() error {
+		return clearMarker(file)
+	})
+}
+
+// updateConfig plans rewriting the config file with fn applied. fn is tried on the
+// current config while planning too, so a dry run fails where the real run would.
+func (p *Plan) updateConfig(paths config.Paths, detail string, fn func(cfg *config.Config) error) error {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return err
+	}
+	if err := fn(&cfg); err != nil {
+		return err
+	}
+	p.add(Step{Action: StepWrite, Path: paths.ConfigFile, Mode: "0600", Detail: detail}, func() error {
+		return config.Update(paths.ConfigFile, fn)
+	})
+	return nil
+}
+
+// planInitialize plans what EnsureInitialized changes: missing storage directories
+// and permissions that need tightening.
+func planInitialize(paths config.Paths, p *Plan) {
+	for _, dir := range storageDirs(paths) {
+		dir := dir
+		info, err := os.Stat(dir)
+		switch {
+		case os.IsNotExist(err):
+			p.add(Step{Action: StepMkdir, Path: dir, Mode: "0700"}, func() error {
+				if err := os.MkdirAll(dir, 0700); err != nil {
+					return fmt.Errorf("failed to create %s: %w", dir, err)
+				}
+				if err := os.Chmod(dir, 0700); err != nil {
+					return fmt.Errorf("failed to set permissions on %s: %w", dir, err)
+				}
+				return nil
+			})
+		case err == nil && info.Mode().Perm() != 0700:
+			p.add(Step{Action: StepChmod, Path: dir, Mode: "0700", FromMode: fmt.Sprintf("%04o", info.Mode().Perm())}, func() error {
+				if err := os.Chmod(dir, 0700); err != nil {
+					return fmt.Errorf("failed to set permissions on %s: %w", dir, err)
+				}
+				return nil
+			})
+		}
+	}
+
+	if info, err := os.Stat(paths.ActiveFile); err == nil && info.Mode().Perm() != 0600 {
+		p.add(Step{Action: StepChmod, Path: paths.ActiveFile, Mode: "0600", FromMode: fmt.Sprintf("%04o", info.Mode().Perm())}, func() error {
+			if err := os.Chmod(paths.ActiveFile, 0600); err != nil {
+				return fmt.Errorf("failed to set permissions on %s: %w", paths.ActiveFile, err)
+			}
+			return nil
+		})
+	}
+}
+
+// Apply plans a single operation and, unless dryRun, executes it under the lock and
+// records it for Undo. The returned plan lists every change, including any
+// initialization of the store.
+// A dry run takes only the shared lock, and none at all if the store does not exist yet.
+func Apply(op Operation, paths config.Paths, dryRun bool) (*Plan, error) {
+	plan := &Plan{Op: op.Op, DryRun: dryRun}
+	if err := op.validate(); err != nil {
+		return plan, err
+	}
+
+	planInitialize(paths, plan)
+
+	if dryRun {
+		if _, err := os.Stat(filepath.Dir(paths.LockFile)); errors.Is(err, os.ErrNotExist) {
+			return plan, buildOp(plan, op, paths)
+		}
+		return plan, withSharedLock(paths, func() error {
+			return buildOp(plan, op, paths)
+		})
+	}
+
+	if err := plan.execute(0); err != nil {
+		return plan, err
+	}
+	err := withLock(paths, func() error {
+		start := len(plan.Steps)
+		if err := buildOp(plan, op, paths); err != nil {
+			return err
+		}
+		// A purge must not leave a copy behind, so it can't be undone.
+		if !op.Purge {
+			if err := recordUndo(paths, op, plan.Steps[start:]); err != nil {
+				return err
+			}
+		}
+		if err := plan.execute(start); err != nil {
+			return err
+		}
+		journalEvents(paths, plan.events)
+		return nil
+	})
+	return plan, err
+}
+
+// recordUndo saves the pre-images of the files steps will change as a new undo entry.
+// The entry is committed before anything changes, so even a mutation interrupted
+// halfway can be undone.
+func recordUndo(paths config.Paths, op Operation, steps []Step) error {
+	if len(steps) == 0 || paths.UndoDir == "" {
+		return nil
+	}
+	rec, err := beginUndo(paths)
+	if err != nil {
+		return err
+	}
+	if err := rec.capture(op, steps); err != nil {
+		rec.abandon()
+		return err
+	}
+	if err := rec.commit(); err != nil {
+		rec.abandon()
+		return err
+	}
+	return nil
+}
+
+// runOp plans and executes one operation, capturing pre-images into rec if it is
+// not nil. Callers must hold the lock.
+func runOp(op Operation, paths config.Paths, rec *undoRecorder) (*Plan, error) {
+	plan := &Plan{Op: op.Op}
+	if err := buildOp(plan, op, paths); err != nil {
+		return plan, err
+	}
+	if rec != nil && !op.Purge {
+		if err := rec.capture(op, plan.Steps); err != nil {
+			return plan, err
+		}
+	}
+	return plan, plan.execute(0)
+}
+
+// buildOp adds the steps of a validated operation to plan, resolving aliases first.
+// Callers must hold the lock.
+func buildOp(plan *Plan, op Operation, paths config.Paths) error {
+	resolve := func(name string) (string, error) {
+		resolved, err := ResolveAlias(name, paths)
+		if err != nil {
+			return "", err
+		}
+		return resolved, ValidateName(resolved)
+	}
+
+	switch op.Op {
+	case OpRestore:
+		return planRestore(plan, op.Name, op.To, paths)
+	case OpAddKey:
+		return planAddKey(plan, op.Name, op.captured.data, op.Force, paths)
+	case OpLogin:
+		return planLogin(plan, op.Name, op.captured, op.Force, paths)
+	case OpAlias:
+		return planAlias(plan, op.Name, op.To, paths)
+	case OpUnalias:
+		return planUnalias(plan, op.Name, paths)
+	case OpDefault:
+		return planDefault(plan, op.Name, paths)
+	case OpCatalogAdd:
+		return planAddCatalog(plan, op.Name, op.Dir, paths)
+	case OpCatalogRemove:
+		return planRemoveCatalog(plan, op.Name, paths)
+	case OpTargetAdd:
+		return planAddTarget(plan, op.Name, op.Dir, paths)
+	case OpTargetRemove:
+		return planRemoveTarget(plan, op.Name, paths)
+	case OpRename, OpCopy:
+		from, err := resolve(op.From)
+		if err != nil {
+			return err
+		}
+		if op.Op == OpRename {
+			return planRename(plan, from, op.To, paths)
+		}
+		return planCopy(plan, from, op.To, paths)
+	}
+
+	name, err := resolve(op.Name)
+	if err != nil {
+		return err
+	}
+	switch op.Op {
+	case OpSave:
+		return planSave(plan, name, paths)
+	case OpUse:
+		return planUse(plan, name, paths)
+	case OpDelete:
+		return planDelete(plan, name, op.Purge, paths)
+	case OpTag:
+		tags, err := cleanTags(op.Tags)
+		if err != nil {
+			return err
+		}
+		return planTags(plan, name, tags, paths)
+	}
+	return fmt.Errorf("unknown op: %s", op.Op)
+}
@@ -0,0 +1,266 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+)
+
+// Policy decisions.
+const (
+	PolicyNone  = "none" // No rule applies
+	PolicyAllow = "allow"
+	PolicyWarn  = "warn"
+	PolicyBlock = "block"
+)
+
+// PolicyRule restricts the accounts that may be used in a directory (and below it)
+// or on matching hosts. A rule with both applies only where both match. A profile is
+// allowed if its account id is listed, its email matches one of the email patterns
+// (e.g. *@acme.com), or it carries one of the tags. Mode is block, the default, or warn.
+type PolicyRule struct {
+	Dir      string   `json:"dir,omitempty"`
+	Host     string   `json:"host,omitempty"` // Glob pattern, e.g. build-*
+	Accounts []string `json:"accounts,omitempty"`
+	Emails   []string `json:"emails,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Mode     string   `json:"mode,omitempty"`
+}
+
+// Policy is the policy file: every rule that applies must allow the profile.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// PolicyDecision is the outcome of checking a profile against the policy.
+// Violations describe the rules that did not allow it.
+type PolicyDecision struct {
+	Profile    string   `json:"profile"`
+	Dir        string   `json:"dir"`
+	Host       string   `json:"host"`
+	Decision   string   `json:"decision"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// String describes the decision, e.g. "personal is not allowed in /src/acme on laptop (rule dir=~/src)".
+func (d PolicyDecision) String() string {
+	switch d.Decision {
+	case PolicyBlock:
+		return fmt.Sprintf("%s is not allowed in %s on %s (%s)", d.Profile, d.Dir, d.Host, strings.Join(d.Violations, "; "))
+	case PolicyWarn:
+		return fmt.Sprintf("%s should not be used in %s on %s (%s)", d.Profile, d.Dir, d.Host, strings.Join(d.Violations, "; "))
+	}
+	return fmt.Sprintf("%s is allowed in %s on %s", d.Profile, d.Dir, d.Host)
+}
+
+// LoadPolicy reads the policy file. A missing file is an empty policy.
+func LoadPolicy(paths config.Paths) (Policy, error) {
+	var policy Policy
+	if paths.PolicyFile == "" {
+		return policy, nil
+	}
+	raw, err := os.ReadFile(paths.PolicyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return policy, nil
+		}
+		return policy, fmt.Errorf("failed to read policy %s: %w", paths.PolicyFile, err)
+	}
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return policy, fmt.Errorf("invalid policy %s: %w", paths.PolicyFile, err)
+	}
+	for i, rule := range policy.Rules {
+		if rule.Dir == "" && rule.Host == "" {
+			return policy, fmt.Errorf("invalid policy %s: rule %d has neither dir nor host", paths.PolicyFile, i+1)
+		}
+		if rule.Mode != "" && rule.Mode != PolicyBlock && rule.Mode != PolicyWarn {
+			return policy, fmt.Errorf("invalid policy %s: rule %d: unknown mode %s (allowed: block, warn)", paths.PolicyFile, i+1, rule.Mode)
+		}
+		if _, err := path.Match(rule.Host, ""); err != nil {
+			return policy, fmt.Errorf("invalid policy %s: rule %d: bad host pattern %s", paths.PolicyFile, i+1, rule.Host)
+		}
+	}
+	return policy, nil
+}
+
+// ErrPolicyBlocked is wrapped by switches to a profile a blocking rule does not allow.
+var ErrPolicyBlocked = errors.New("blocked by policy")
+
+// CheckPolicy decides whether the profile name may be used in dir on this host.
+func CheckPolicy(name, dir string, paths config.Paths) (PolicyDecision, error) {
+	decision, rules, err := applicableRules(name, dir, paths)
+	if err != nil || len(rules) == 0 {
+		return decision, err
+	}
+	err = withSharedLock(paths, func() error {
+		return judgePolicy(&decision, rules, paths)
+	})
+	return decision, err
+}
+
+// applicableRules returns the undecided decision for name in dir on this host and the
+// policy rules that apply there.
+func applicableRules(name, dir string, paths config.Paths) (PolicyDecision, []PolicyRule, error) {
+	host, _ := os.Hostname()
+	decision := PolicyDecision{Profile: name, Dir: dir, Host: host, Decision: PolicyNone}
+
+	policy, err := LoadPolicy(paths)
+	if err != nil {
+		return decision, nil, err
+	}
+	var applicable []PolicyRule
+	for _, rule := range policy.Rules {
+		if (rule.Dir == "" || underDir(dir, rule.Dir)) && (rule.Host == "" || matchHost(rule.Host, host)) {
+			applicable = append(applicable, rule)
+		}
+	}
+	return decision, applicable, nil
+}
+
+// judgePolicy decides on the profile against the applicable rules. Callers must hold
+// the lock.
+func judgePolicy(decision *PolicyDecision, rules []PolicyRule, paths config.Paths) error {
+	name := decision.Profile
+	raw, err := os.ReadFile(sourcePath(paths, name))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	} else if err != nil {
+		return err
+	}
+	var id model.Identity
+	if auth, err := model.ParseAuth(raw); err == nil {
+		id = auth.Identity()
+	}
+	meta, err := loadMeta(paths)
+	if err != nil {
+		return err
+	}
+	tags := meta[name].Tags
+
+	decision.Decision = PolicyAllow
+	for _, rule := range rules {
+		if rule.allows(id, tags) {
+			continue
+		}
+		decision.Violations = append(decision.Violations, rule.String())
+		if rule.Mode == PolicyWarn {
+			if decision.Decision == PolicyAllow {
+				decision.Decision = PolicyWarn
+			}
+		} else {
+			decision.Decision = PolicyBlock
+		}
+	}
+	return nil
+}
+
+// planPolicy checks a switch to name against the policy for the working directory and
+// records the decision on the plan. Allowed and warned switches journal it with the
+// plan; a blocked one fails, journaling the decision right away unless this is a dry
+// run. Callers must hold the lock.
+func planPolicy(plan *Plan, name string, paths config.Paths) error {
+	dir, _ := os.Getwd()
+	decision, rules, err := applicableRules(name, dir, paths)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	if err := judgePolicy(&decision, rules, paths); err != nil {
+		return err
+	}
+	plan.Policy = &decision
+	ev := policyEvent(decision, plan.Op)
+	if decision.Decision == PolicyBlock {
+		if !plan.DryRun {
+			journalEvents(paths, []Event{ev})
+		}
+		return fmt.Errorf("%w: %s", ErrPolicyBlocked, decision)
+	}
+	plan.emit(ev)
+	return nil
+}
+
+func policyEvent(d PolicyDecision, action string) Event {
+	return Event{Type: EventPolicy, Profile: d.Profile, Detail: d.Decision + " " + action + ": " + d.String()}
+}
+
+func (r PolicyRule) allows(id model.Identity, tags []string) bool {
+	for _, account := range r.Accounts {
+		if id.AccountID != "" && account == id.AccountID {
+			return true
+		}
+	}
+	for _, pattern := range r.Emails {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(id.Email)); ok && id.Email != "" {
+			return true
+		}
+	}
+	for _, want := range r.Tags {
+		for _, tag := range tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String names the rule by where it applies, e.g. "rule dir=~/src/acme host=build-*".
+func (r PolicyRule) String() string {
+	s := "rule"
+	if r.Dir != "" {
+		s += " dir=" + r.Dir
+	}
+	if r.Host != "" {
+		s += " host=" + r.Host
+	}
+	return s
+}
+
+// underDir reports whether dir is root or inside it. A leading ~ in root is the home
+// directory, and symlinks are resolved on both sides where possible.
+func underDir(dir, root string) bool {
+	if root == "~" || strings.HasPrefix(root, "~/") {
+		home, _ := os.UserHomeDir()
+		root = filepath.Join(home, root[1:])
+	}
+	resolve := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			p = real
+		}
+		return filepath.Clean(p)
+	}
+	dir, root = resolve(dir), resolve(root)
+	rel, err := filepath.Rel(root, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func matchHost(pattern, host string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(host))
+	return ok
+}
+
+// RecordPolicyDecision journals a decision made when enforcing the policy, as the
+// audit trail of which accounts were used where. Decisions where no rule applied
+// are not recorded.
+func RecordPolicyDecision(d PolicyDecision, action string, paths config.Paths) error {
+	if d.Decision == PolicyNone {
+		return nil
+	}
+	if err := EnsureInitialized(paths); err != nil {
+		return err
+	}
+	return withLock(paths, func() error {
+		journalEvents(paths, []Event{policyEvent(d, action)})
+		return nil
+	})
+}
@@ -1,60 +1,176 @@
 package profile
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/BigCactusLabs/codex-multipass/internal/config"
 	"github.com/BigCactusLabs/codex-multipass/internal/fs"
 )
 
-// EnsureInitialized ensures that the profiles directory exists and has correct permissions.
+// EnsureInitialized ensures that the storage directories exist and have correct permissions.
 func EnsureInitialized(paths config.Paths) error {
-	if err := os.MkdirAll(paths.ProfilesDir, 0700); err != nil {
-		return fmt.Errorf("failed to create profiles directory: %w", err)
-	}
+	_, err := Initialize(paths, false)
+	return err
+}
 
-	// Enforce 0700 on CodexDir and ProfilesDir explicitly
-	if err := os.Chmod(paths.CodexDir, 0700); err != nil {
-		return fmt.Errorf("failed to set permissions on %s: %w", paths.CodexDir, err)
+// Initialize is EnsureInitialized that also returns the plan; a dry run only plans it.
+func Initialize(paths config.Paths, dryRun bool) (*Plan, error) {
+	plan := &Plan{Op: "init", DryRun: dryRun}
+	planInitialize(paths, plan)
+	if dryRun {
+		return plan, nil
 	}
-	if err := os.Chmod(paths.ProfilesDir, 0700); err != nil {
-		return fmt.Errorf("failed to set permissions on %s: %w", paths.ProfilesDir, err)
-	}
-	if _, err := os.Stat(paths.ActiveFile); err == nil {
-		if err := os.Chmod(paths.ActiveFile, 0600); err != nil {
-			return fmt.Errorf("failed to set permissions on %s: %w", paths.ActiveFile, err)
+	return plan, plan.execute(0)
+}
+
+// storageDirs returns the distinct directories codex-mp owns for the given layout.
+func storageDirs(paths config.Paths) []string {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, dir := range []string{paths.DataDir, paths.StateDir, paths.ProfilesDir} {
+		if dir == "" || seen[dir] {
+			continue
 		}
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("failed to stat %s: %w", paths.ActiveFile, err)
+		seen[dir] = true
+		dirs = append(dirs, dir)
 	}
-
-	return nil
+	return dirs
 }
 
 var nameRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
 
+// Errors wrapped by operations on a missing, already existing or invalid profile name.
+var (
+	ErrNotFound    = errors.New("profile not found")
+	ErrExists      = errors.New("profile already exists")
+	ErrInvalidName = errors.New("invalid profile name")
+)
+
 // ProfileStatus represents the state of a profile
 type ProfileStatus struct {
-	Name        string `json:"name"`
-	Fingerprint string `json:"fingerprint"`
-	Active      bool   `json:"active"`
+	Name        string   `json:"name"`
+	Fingerprint string   `json:"fingerprint"`
+	Active      bool     `json:"active"`
+	Targets     []string `json:"targets,omitempty"` // Targets where this profile is active
+	Managed     bool     `json:"managed,omitempty"` // Read-only, from a catalog
+	Origin      string   `json:"origin,omitempty"`  // File a managed profile is read from
 }
 
-// ValidateName checks if the profile name is valid
+// ValidateName checks if the profile name is valid. Names may be grouped with "/",
+// e.g. acme/dev; every segment follows the flat-name rules, and "." or ".." segments
+// are rejected so a name can never leave ProfilesDir.
 func ValidateName(name string) error {
-	if !nameRegex.MatchString(name) {
-		return fmt.Errorf("invalid profile name: %s (allowed: A-Z a-z 0-9 . _ -)", name)
+	segments := strings.Split(name, "/")
+	for i, seg := range segments {
+		group := i < len(segments)-1
+		if !validSegment(seg) || (group && strings.HasSuffix(seg, ".json")) {
+			return fmt.Errorf("%w: %s (allowed: A-Z a-z 0-9 . _ - and / between groups)", ErrInvalidName, name)
+		}
 	}
 	return nil
 }
 
+func validSegment(seg string) bool {
+	return seg != "." && seg != ".." && nameRegex.MatchString(seg)
+}
+
+// IsPattern reports whether s is a glob pattern rather than a profile name.
+func IsPattern(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// Match returns the saved profiles whose names match a glob pattern, sorted.
+// As in a shell, "*" does not cross "/", so 'acme/*' selects one group level.
+func Match(pattern string, paths config.Paths) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern: %s", pattern)
+	}
+
+	var matched []string
+	err := withSharedLock(paths, func() error {
+		names, err := storeNames(paths)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = append(matched, name)
+			}
+		}
+		return nil
+	})
+	return matched, err
+}
+
+// profilePath returns the file holding the profile name, which must be valid.
+func profilePath(paths config.Paths, name string) string {
+	return filepath.Join(paths.ProfilesDir, filepath.FromSlash(name)+".json")
+}
+
+// profileNames walks dir and returns every profile name, grouped ones included, sorted
+// so that each group's members are contiguous. Only directories with a valid group name
+// are descended into.
+func profileNames(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != dir && !validSegment(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, strings.TrimSuffix(filepath.ToSlash(rel), ".json"))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profiles: %w", err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// pruneGroups removes the group directories above a deleted or moved profile once they are empty.
+func pruneGroups(paths config.Paths, name string) error {
+	dir := filepath.Dir(profilePath(paths, name))
+	for dir != paths.ProfilesDir && strings.HasPrefix(dir, paths.ProfilesDir) {
+		if err := os.Remove(dir); err != nil {
+			if os.IsNotExist(err) {
+				dir = filepath.Dir(dir)
+				continue
+			}
+			return nil // Not empty
+		}
+		dir = filepath.Dir(dir)
+	}
+	return fs.SyncDir(dir)
+}
+
 // GetFingerprint returns the SHA256 fingerprint of a file
 func GetFingerprint(path string) (string, error) {
 	f, err := os.Open(path)
@@ -70,14 +186,40 @@ func GetFingerprint(path string) (string, error) {
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
-// withLock executes the given function with a file lock
+// LockTimeout bounds how long operations wait for the store lock.
+// Zero waits forever; a negative value fails immediately if the lock is held.
+var LockTimeout time.Duration
+
+// lockStore acquires the lock at path, honoring LockTimeout.
+func lockStore(path string, shared bool) (func(), error) {
+	ctx, cancel := context.Background(), func() {}
+	if LockTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, LockTimeout)
+	}
+	defer cancel()
+
+	return fs.LockContext(ctx, path, fs.LockOptions{Shared: shared, Try: LockTimeout < 0})
+}
+
+// withLock executes the given function with an exclusive file lock
 func withLock(paths config.Paths, action func() error) error {
 	if err := EnsureInitialized(paths); err != nil {
 		return err
 	}
 
-	lockPath := filepath.Join(paths.CodexDir, ".codex-mp.lock")
-	unlock, err := fs.Lock(lockPath)
+	unlock, err := lockStore(paths.LockFile, false)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer unlock()
+
+	return action()
+}
+
+// withSharedLock executes the given read-only function with a shared file lock,
+// so readers never block each other and only wait for writers.
+func withSharedLock(paths config.Paths, action func() error) error {
+	unlock, err := lockStore(paths.LockFile, true)
 	if err != nil {
 		return fmt.Errorf("failed to acquire lock: %w", err)
 	}
@@ -86,13 +228,37 @@ func withLock(paths config.Paths, action func() error) error {
 	return action()
 }
 
+// ActiveTargets reads the active marker of each target and returns the active
+// profile name keyed by target name. Targets without an active profile are omitted.
+func ActiveTargets(targets []config.Paths) (map[string]string, error) {
+	active := map[string]string{}
+	for _, target := range targets {
+		name, err := readActiveProfile(target)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			active[target.Target] = name
+		}
+	}
+	return active, nil
+}
+
 func readActiveProfile(paths config.Paths) (string, error) {
-	raw, err := os.ReadFile(paths.ActiveFile)
+	return readMarker(paths.ActiveFile)
+}
+
+// readMarker reads a profile name from a marker file. A missing file or invalid name reads as "".
+func readMarker(file string) (string, error) {
+	if file == "" {
+		return "", nil
+	}
+	raw, err := os.ReadFile(file)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return "", nil
 		}
-		return "", fmt.Errorf("failed to read active profile marker: %w", err)
+		return "", fmt.Errorf("failed to read profile marker: %w", err)
 	}
 
 	name := strings.TrimSpace(string(raw))
@@ -108,57 +274,56 @@ func readActiveProfile(paths config.Paths) (string, error) {
 }
 
 func writeActiveProfile(paths config.Paths, name string) error {
+	return writeMarker(paths.ActiveFile, name)
+}
+
+func writeMarker(file, name string) error {
 	if err := ValidateName(name); err != nil {
 		return err
 	}
 
-	dir := filepath.Dir(paths.ActiveFile)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create marker directory: %w", err)
-	}
-
-	tmp, err := os.CreateTemp(dir, ".codex-mp-active-*")
-	if err != nil {
-		return fmt.Errorf("failed to create marker temp file: %w", err)
-	}
-	defer os.Remove(tmp.Name())
-	defer tmp.Close()
-
-	if _, err := tmp.WriteString(name + "\n"); err != nil {
-		return fmt.Errorf("failed to write active profile marker: %w", err)
+	if err := fs.AtomicWriteFile(file, []byte(name+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write profile marker: %w", err)
 	}
+	return nil
+}
 
-	if err := tmp.Chmod(0600); err != nil {
-		return fmt.Errorf("failed to set permissions on active profile marker: %w", err)
-	}
+func clearActiveProfile(paths config.Paths) error {
+	return clearMarker(paths.ActiveFile)
+}
 
-	if err := tmp.Close(); err != nil {
-		return fmt.Errorf("failed to close active profile marker temp file: %w", err)
+func clearMarker(file string) error {
+	if file == "" {
+		return nil
 	}
-
-	if err := os.Rename(tmp.Name(), paths.ActiveFile); err != nil {
-		return fmt.Errorf("failed to write active profile marker: %w", err)
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear profile marker: %w", err)
 	}
-
 	return nil
 }
 
-func clearActiveProfile(paths config.Paths) error {
-	if err := os.Remove(paths.ActiveFile); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to clear active profile marker: %w", err)
+// writeOptions returns the atomic write options for auth.json and profile files,
+// carrying the configured symlink policy.
+func writeOptions(paths config.Paths) (fs.WriteOptions, error) {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return fs.WriteOptions{}, err
 	}
-	return nil
+	policy, err := fs.ParseSymlinkPolicy(cfg.SymlinkPolicy)
+	if err != nil {
+		return fs.WriteOptions{}, err
+	}
+	return fs.WriteOptions{Symlinks: policy}, nil
 }
 
-func syncActiveProfile(paths config.Paths, nextName string) error {
+// planSyncBack plans copying auth.json back into the active profile before another
+// profile is installed, so tokens Codex refreshed in place are not lost.
+func planSyncBack(plan *Plan, paths config.Paths, nextName string, opts fs.WriteOptions) error {
 	activeName, err := readActiveProfile(paths)
 	if err != nil {
 		return err
 	}
-	if activeName == "" {
-		return nil
-	}
-	if activeName == nextName {
+	if activeName == "" || activeName == nextName || IsManaged(activeName, paths) {
 		return nil
 	}
 
@@ -168,130 +333,257 @@ func syncActiveProfile(paths config.Paths, nextName string) error {
 		return fmt.Errorf("failed to read auth file state: %w", err)
 	}
 
-	activePath := filepath.Join(paths.ProfilesDir, activeName+".json")
+	activePath := profilePath(paths, activeName)
 	if _, err := os.Stat(activePath); os.IsNotExist(err) {
-		if err := clearActiveProfile(paths); err != nil {
-			return err
-		}
+		plan.clearMarker(paths.ActiveFile, "active profile "+activeName+" no longer exists")
 		return nil
 	} else if err != nil {
 		return fmt.Errorf("failed to read profile %s: %w", activeName, err)
 	}
 
-	if err := fs.AtomicCopy(paths.AuthFile, activePath, 0600); err != nil {
-		return fmt.Errorf("failed to sync active profile %s: %w", activeName, err)
+	if err := plan.copyFile(paths.AuthFile, activePath, opts, "sync-back: keep refreshed tokens of "+activeName); err != nil {
+		return err
 	}
+	plan.emit(Event{Type: EventSynced, Profile: activeName})
 	return nil
 }
 
-// Save saves the current auth as a profile
-func Save(name string, paths config.Paths) (string, error) {
-	if err := ValidateName(name); err != nil {
-		return "", err
+// planActivate plans marking name active after it was installed: the previous marker
+// (for `use -`), the active marker, the install cache and the last-used time.
+func planActivate(plan *Plan, paths config.Paths, name string) error {
+	current, err := readActiveProfile(paths)
+	if err != nil {
+		return err
 	}
+	if current != "" && current != name && paths.PreviousFile != "" {
+		plan.writeMarker(paths.PreviousFile, current, "previous profile: "+current)
+	}
+	plan.writeMarker(paths.ActiveFile, name, "active profile: "+name)
 
-	profilePath := filepath.Join(paths.ProfilesDir, name+".json")
-
-	err := withLock(paths, func() error {
-		// Check Auth Existence INSIDE lock
-		if _, err := os.Stat(paths.AuthFile); os.IsNotExist(err) {
-			return fmt.Errorf("missing auth file: %s. Hint: run 'codex login' first", paths.AuthFile)
-		}
+	if paths.CacheFile != "" {
+		plan.add(Step{Action: StepWrite, Path: paths.CacheFile, Mode: "0600", Detail: "install cache"}, func() error {
+			if err := recordInstalled(paths, name); err != nil {
+				return fmt.Errorf("failed to cache installed auth state: %w", err)
+			}
+			return nil
+		})
+	}
+	planMeta(plan, paths, "last used: "+name, func(meta map[string]Meta) {
+		now := time.Now().UTC().Truncate(time.Second)
+		m := meta[name]
+		m.LastUsed = &now
+		meta[name] = m
+	})
+	return nil
+}
 
-		// Atomic Copy
-		if err := fs.AtomicCopy(paths.AuthFile, profilePath, 0600); err != nil {
-			return fmt.Errorf("failed to save profile: %w", err)
-		}
+// planMeta plans an update of the metadata file.
+func planMeta(plan *Plan, paths config.Paths, detail string, fn func(meta map[string]Meta)) {
+	if paths.MetaFile == "" {
+		return
+	}
+	plan.add(Step{Action: StepWrite, Path: paths.MetaFile, Mode: "0600", Detail: detail}, func() error {
+		return updateMeta(paths, fn)
+	})
+}
 
-		if err := writeActiveProfile(paths, name); err != nil {
-			return fmt.Errorf("failed to update active profile marker: %w", err)
+// planConfig plans pointing aliases and the default profile at newName, or dropping
+// them when newName is empty, if the config refers to oldName at all.
+func planConfig(plan *Plan, paths config.Paths, oldName, newName string) error {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return err
+	}
+	refs := 0
+	if cfg.DefaultProfile == oldName {
+		refs++
+	}
+	for _, target := range cfg.Aliases {
+		if target == oldName {
+			refs++
 		}
+	}
+	if refs == 0 {
 		return nil
+	}
+
+	detail := fmt.Sprintf("retarget %d alias/default reference(s) to %s", refs, newName)
+	if newName == "" {
+		detail = fmt.Sprintf("drop %d alias/default reference(s) to %s", refs, oldName)
+	}
+	plan.add(Step{Action: StepWrite, Path: paths.ConfigFile, Mode: "0600", Detail: detail}, func() error {
+		return retargetConfig(paths, oldName, newName)
 	})
+	return nil
+}
 
-	return profilePath, err
+// Save saves the current auth as a profile
+func Save(name string, paths config.Paths) (string, error) {
+	_, err := Apply(Operation{Op: OpSave, Name: name}, paths, false)
+	if err != nil {
+		return "", err
+	}
+	return profilePath(paths, name), nil
 }
 
-// Use switches to a saved profile
-func Use(name string, paths config.Paths) error {
-	if err := ValidateName(name); err != nil {
+func planSave(plan *Plan, name string, paths config.Paths) error {
+	if err := checkWritable(paths, name); err != nil {
 		return err
 	}
+	// Check Auth Existence INSIDE lock
+	if _, err := os.Stat(paths.AuthFile); os.IsNotExist(err) {
+		return fmt.Errorf("missing auth file: %s. Hint: run 'codex login' first", paths.AuthFile)
+	}
 
-	profilePath := filepath.Join(paths.ProfilesDir, name+".json")
+	opts, err := writeOptions(paths)
+	if err != nil {
+		return err
+	}
 
-	return withLock(paths, func() error {
-		// Check Profile Existence INSIDE lock
-		if _, err := os.Stat(profilePath); os.IsNotExist(err) {
-			return fmt.Errorf("profile not found: %s", name)
-		}
+	detail := "save auth.json as " + name
+	if _, err := os.Lstat(profilePath(paths, name)); err == nil {
+		detail = "overwrite " + name + " with auth.json"
+	}
+	if err := plan.copyFile(paths.AuthFile, profilePath(paths, name), opts, detail); err != nil {
+		return err
+	}
+	plan.emit(Event{Type: EventSaved, Profile: name})
+	return planActivate(plan, paths, name)
+}
 
-		if err := syncActiveProfile(paths, name); err != nil {
-			return err
-		}
+// Use switches to a saved profile, if the account policy allows it.
+func Use(name string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpUse, Name: name}, paths, false)
+	return err
+}
 
-		// Atomic Copy
-		if err := fs.AtomicCopy(profilePath, paths.AuthFile, 0600); err != nil {
-			return fmt.Errorf("failed to switch profile: %w", err)
-		}
+func planUse(plan *Plan, name string, paths config.Paths) error {
+	profileFile := sourcePath(paths, name)
 
-		if err := writeActiveProfile(paths, name); err != nil {
-			return fmt.Errorf("failed to update active profile marker: %w", err)
-		}
-		return nil
-	})
+	// Check Profile Existence INSIDE lock
+	if _, err := os.Stat(profileFile); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err := planPolicy(plan, name, paths); err != nil {
+		return err
+	}
+
+	opts, err := writeOptions(paths)
+	if err != nil {
+		return err
+	}
+
+	from, err := readActiveProfile(paths)
+	if err != nil {
+		return err
+	}
+	if err := planSyncBack(plan, paths, name, opts); err != nil {
+		return err
+	}
+	if err := plan.copyFile(profileFile, paths.AuthFile, opts, "install "+name); err != nil {
+		return err
+	}
+	plan.emit(Event{Type: EventSwitched, Profile: name, From: from})
+	return planActivate(plan, paths, name)
 }
 
-// Delete removes a profile
+// Delete moves a profile to the trash.
 func Delete(name string, paths config.Paths) error {
-	if err := ValidateName(name); err != nil {
+	_, err := Apply(Operation{Op: OpDelete, Name: name}, paths, false)
+	return err
+}
+
+// Purge deletes a profile for good, overwriting its contents before removal.
+func Purge(name string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpDelete, Name: name, Purge: true}, paths, false)
+	return err
+}
+
+func planDelete(plan *Plan, name string, purge bool, paths config.Paths) error {
+	if err := checkWritable(paths, name); err != nil {
 		return err
 	}
+	profileFile := profilePath(paths, name)
 
-	profilePath := filepath.Join(paths.ProfilesDir, name+".json")
-
-	return withLock(paths, func() error {
-		// Check Existence INSIDE lock
-		if _, err := os.Stat(profilePath); os.IsNotExist(err) {
-			return fmt.Errorf("profile not found: %s", name)
-		}
+	// Check Existence INSIDE lock
+	if _, err := os.Lstat(profileFile); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
 
-		if err := os.Remove(profilePath); err != nil {
-			return fmt.Errorf("failed to delete profile: %w", err)
+	switch {
+	case purge:
+		if err := planPurge(plan, name, paths); err != nil {
+			return err
 		}
-
-		activeName, err := readActiveProfile(paths)
-		if err != nil {
+	case paths.TrashDir != "":
+		if err := planTrash(plan, name, paths); err != nil {
 			return err
 		}
-		if activeName == name {
-			if err := clearActiveProfile(paths); err != nil {
-				return err
+	default:
+		plan.add(Step{Action: StepRemove, Path: profileFile, Detail: "delete " + name}, func() error {
+			if err := os.Remove(profileFile); err != nil {
+				return fmt.Errorf("failed to delete profile: %w", err)
 			}
-		}
-		return nil
-	})
-}
+			return pruneGroups(paths, name)
+		})
+	}
 
-// Rename renames a profile
-func Rename(oldName, newName string, paths config.Paths) error {
-	if err := ValidateName(oldName); err != nil {
+	activeName, err := readActiveProfile(paths)
+	if err != nil {
 		return err
 	}
-	if err := ValidateName(newName); err != nil {
+	if activeName == name {
+		plan.clearMarker(paths.ActiveFile, "deleted profile was active")
+	}
+	if previous, _ := readMarker(paths.PreviousFile); previous == name {
+		plan.clearMarker(paths.PreviousFile, "deleted profile was previous")
+	}
+	if err := planConfig(plan, paths, name, ""); err != nil {
 		return err
 	}
+	planMeta(plan, paths, "forget "+name, func(meta map[string]Meta) {
+		delete(meta, name)
+	})
+	ev := Event{Type: EventDeleted, Profile: name}
+	if purge {
+		ev.Detail = "purged"
+	} else if paths.TrashDir != "" {
+		ev.Detail = "moved to trash"
+	}
+	plan.emit(ev)
+	return planExpireTrash(plan, paths)
+}
 
-	oldPath := filepath.Join(paths.ProfilesDir, oldName+".json")
-	newPath := filepath.Join(paths.ProfilesDir, newName+".json")
+// Rename renames a profile
+func Rename(oldName, newName string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpRename, From: oldName, To: newName}, paths, false)
+	return err
+}
 
-	return withLock(paths, func() error {
-		// Checks INSIDE lock
-		if _, err := os.Stat(oldPath); os.IsNotExist(err) {
-			return fmt.Errorf("profile not found: %s", oldName)
+func planRename(plan *Plan, oldName, newName string, paths config.Paths) error {
+	for _, name := range []string{oldName, newName} {
+		if err := checkWritable(paths, name); err != nil {
+			return err
 		}
-		if _, err := os.Stat(newPath); err == nil {
-			return fmt.Errorf("profile already exists: %s", newName)
+	}
+	oldPath := profilePath(paths, oldName)
+	newPath := profilePath(paths, newName)
+
+	// Checks INSIDE lock
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, oldName)
+	}
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, newName)
+	}
+
+	step := Step{Action: StepRename, Path: newPath, Source: oldPath, Mode: "0600", Detail: "rename " + oldName + " to " + newName}
+	if info, err := os.Stat(oldPath); err == nil && info.Mode().Perm() != 0600 {
+		step.FromMode = fmt.Sprintf("%04o", info.Mode().Perm())
+	}
+	plan.add(step, func() error {
+		if err := os.MkdirAll(filepath.Dir(newPath), 0700); err != nil {
+			return fmt.Errorf("failed to create profile group: %w", err)
 		}
 
 		// Ensure permissions before rename if possible, or after
@@ -302,25 +594,82 @@ func Rename(oldName, newName string, paths config.Paths) error {
 		if err := os.Chmod(newPath, 0600); err != nil {
 			return fmt.Errorf("failed to set permissions on renamed profile: %w", err)
 		}
-
-		activeName, err := readActiveProfile(paths)
-		if err != nil {
+		if err := fs.SyncDir(filepath.Dir(newPath)); err != nil {
 			return err
 		}
-		if activeName == oldName {
-			if err := writeActiveProfile(paths, newName); err != nil {
-				return err
-			}
+		return pruneGroups(paths, oldName)
+	})
+
+	activeName, err := readActiveProfile(paths)
+	if err != nil {
+		return err
+	}
+	if activeName == oldName {
+		plan.writeMarker(paths.ActiveFile, newName, "active profile: "+newName)
+	}
+	if previous, _ := readMarker(paths.PreviousFile); previous == oldName {
+		plan.writeMarker(paths.PreviousFile, newName, "previous profile: "+newName)
+	}
+	if err := planConfig(plan, paths, oldName, newName); err != nil {
+		return err
+	}
+	planMeta(plan, paths, "move metadata to "+newName, func(meta map[string]Meta) {
+		if m, ok := meta[oldName]; ok {
+			meta[newName] = m
+			delete(meta, oldName)
 		}
-		return nil
 	})
+	plan.emit(Event{Type: EventRenamed, Profile: newName, From: oldName})
+	return nil
+}
+
+// Copy saves a copy of a profile under a new name. Tags are cloned; the copy has
+// never been used, so its last-used time starts empty.
+func Copy(srcName, dstName string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpCopy, From: srcName, To: dstName}, paths, false)
+	return err
+}
+
+func planCopy(plan *Plan, srcName, dstName string, paths config.Paths) error {
+	if err := checkWritable(paths, dstName); err != nil {
+		return err
+	}
+	srcPath := sourcePath(paths, srcName)
+	dstPath := profilePath(paths, dstName)
+
+	if _, err := os.Stat(srcPath); os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, srcName)
+	}
+	if _, err := os.Lstat(dstPath); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, dstName)
+	}
+
+	opts, err := writeOptions(paths)
+	if err != nil {
+		return err
+	}
+	if err := plan.copyFile(srcPath, dstPath, opts, "copy "+srcName+" to "+dstName); err != nil {
+		return err
+	}
+
+	meta, err := loadMeta(paths)
+	if err != nil {
+		return err
+	}
+	if tags := meta[srcName].Tags; len(tags) > 0 {
+		planMeta(plan, paths, "copy tags to "+dstName, func(meta map[string]Meta) {
+			meta[dstName] = Meta{Tags: append([]string(nil), tags...)}
+		})
+	}
+	plan.emit(Event{Type: EventCopied, Profile: dstName, From: srcName})
+	return nil
 }
 
 // List returns all profiles
 func List(paths config.Paths) ([]ProfileStatus, error) {
 	var profiles []ProfileStatus
 
-	err := withLock(paths, func() error {
+	err := withSharedLock(paths, func() error {
 		// active fingerprint (read inside lock)
 		activeFp, _ := GetFingerprint(paths.AuthFile)
 		activeName, err := readActiveProfile(paths)
@@ -328,27 +677,28 @@ func List(paths config.Paths) ([]ProfileStatus, error) {
 			return err
 		}
 		if activeName != "" {
-			if _, err := os.Stat(filepath.Join(paths.ProfilesDir, activeName+".json")); err != nil {
+			if _, err := os.Stat(sourcePath(paths, activeName)); err != nil {
 				activeName = ""
 			}
 		}
 
-		entries, err := os.ReadDir(paths.ProfilesDir)
+		names, err := profileNames(paths.ProfilesDir)
 		if err != nil {
-			if os.IsNotExist(err) {
-				return nil // Return empty list
-			}
-			return fmt.Errorf("failed to list profiles: %w", err)
+			return err
 		}
+		managed, files, err := managedProfiles(paths)
+		if err != nil {
+			return err
+		}
+		names = append(names, managed...)
+		sort.Strings(names)
 
-		for _, entry := range entries {
-			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
-				continue
+		for _, name := range names {
+			fullPath, isManaged := files[name]
+			if !isManaged {
+				fullPath = profilePath(paths, name)
 			}
 
-			name := strings.TrimSuffix(entry.Name(), ".json")
-			fullPath := filepath.Join(paths.ProfilesDir, entry.Name())
-
 			fp, err := GetFingerprint(fullPath)
 			if err != nil {
 				// Profile might have been deleted concurrently, skip it
@@ -359,6 +709,8 @@ func List(paths config.Paths) ([]ProfileStatus, error) {
 				Name:        name,
 				Fingerprint: fp,
 				Active:      (activeName != "" && name == activeName) || (activeName == "" && activeFp != "" && fp == activeFp),
+				Managed:     isManaged,
+				Origin:      files[name],
 			})
 		}
 		return nil
@@ -1,11 +1,22 @@
 package profile
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
 )
 
 func setupTest(t *testing.T) (config.Paths, func()) {
@@ -20,10 +31,18 @@ func setupTest(t *testing.T) (config.Paths, func()) {
 	}
 
 	paths := config.Paths{
-		CodexDir:    tmpDir,
-		AuthFile:    filepath.Join(tmpDir, "auth.json"),
-		ProfilesDir: profilesDir,
-		ActiveFile:  filepath.Join(tmpDir, ".codex-mp-active"),
+		Target:       config.DefaultTarget,
+		CodexDir:     tmpDir,
+		AuthFile:     filepath.Join(tmpDir, "auth.json"),
+		Storage:      config.StorageCodex,
+		DataDir:      tmpDir,
+		StateDir:     tmpDir,
+		ProfilesDir:  profilesDir,
+		MetaFile:     filepath.Join(tmpDir, ".codex-mp-meta.json"),
+		ActiveFile:   filepath.Join(tmpDir, ".codex-mp-active"),
+		PreviousFile: filepath.Join(tmpDir, ".codex-mp-previous"),
+		CacheFile:    filepath.Join(tmpDir, ".codex-mp-cache.json"),
+		LockFile:     filepath.Join(tmpDir, ".codex-mp.lock"),
 	}
 
 	cleanup := func() {
@@ -263,3 +282,1764 @@ func TestRenameAndDeleteUpdateActiveMarker(t *testing.T) {
 		t.Fatalf("expected active marker to be removed after deleting active profile")
 	}
 }
+
+func TestMigrateStorageMovesProfilesAndMarker(t *testing.T) {
+	from, cleanup := setupTest(t)
+	defer cleanup()
+
+	xdgDir := filepath.Join(from.CodexDir, "xdg")
+	from.ConfigFile = filepath.Join(xdgDir, "config", "config.json")
+	to := from
+	to.Storage = config.StorageXDG
+	to.DataDir = filepath.Join(xdgDir, "data")
+	to.StateDir = filepath.Join(xdgDir, "state")
+	to.ProfilesDir = filepath.Join(to.DataDir, "profiles")
+	to.MetaFile = filepath.Join(to.DataDir, "meta.json")
+	to.ActiveFile = filepath.Join(to.StateDir, "active")
+	to.LockFile = filepath.Join(to.StateDir, "lock")
+	from.EventsFile = filepath.Join(from.CodexDir, ".codex-mp-events.jsonl")
+	to.EventsFile = filepath.Join(to.StateDir, "events.jsonl")
+
+	if err := os.WriteFile(from.AuthFile, []byte(`{"token":"w"}`), 0600); err != nil {
+		t.Fatalf("failed to write auth file: %v", err)
+	}
+	if _, err := Save("work", from); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := Use("work", from); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	os.Chmod(filepath.Join(from.ProfilesDir, "work.json"), 0640)
+
+	// A dry run plans the same moves and leaves both layouts alone.
+	moved, plan, err := MigrateStorage(from, to, true)
+	if err != nil || moved != 1 || len(plan.Steps) == 0 {
+		t.Fatalf("expected a planned migration of 1 profile, got %d, %+v (%v)", moved, plan, err)
+	}
+	if _, err := os.Stat(to.ProfilesDir); !os.IsNotExist(err) {
+		t.Fatalf("expected a dry run to leave the destination alone")
+	}
+
+	moved, _, err = MigrateStorage(from, to, false)
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if moved != 1 {
+		t.Fatalf("expected 1 migrated profile, got %d", moved)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(to.ProfilesDir, "work.json"))
+	if err != nil || string(raw) != `{"token":"w"}` {
+		t.Fatalf("expected profile in new storage, got %q (%v)", raw, err)
+	}
+	if info, _ := os.Stat(filepath.Join(to.ProfilesDir, "work.json")); info.Mode().Perm() != 0640 {
+		t.Fatalf("expected the profile's mode kept, got %v", info.Mode())
+	}
+	if _, err := os.Stat(from.ProfilesDir); !os.IsNotExist(err) {
+		t.Fatalf("expected old profiles directory to be removed")
+	}
+	if _, err := os.Stat(from.ActiveFile); !os.IsNotExist(err) {
+		t.Fatalf("expected old active marker to be removed")
+	}
+
+	activeRaw, err := os.ReadFile(to.ActiveFile)
+	if err != nil || string(activeRaw) != "work\n" {
+		t.Fatalf("expected active marker in state dir, got %q (%v)", activeRaw, err)
+	}
+
+	cfg, err := config.Load(from.ConfigFile)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Storage != config.StorageXDG {
+		t.Fatalf("expected config storage %s, got %q", config.StorageXDG, cfg.Storage)
+	}
+
+	// The journal moved, so usage still knows which profile a later session ran under.
+	if _, err := os.Stat(from.EventsFile); !os.IsNotExist(err) {
+		t.Fatalf("expected old event journal to be removed")
+	}
+	day := filepath.Join(to.CodexDir, "sessions", "2099", "01", "01")
+	os.MkdirAll(day, 0700)
+	os.WriteFile(filepath.Join(day, "rollout-a.jsonl"), []byte(`{"timestamp":"2099-01-01T10:00:00Z","type":"session_meta","payload":{"id":"a"}}`+"\n"), 0600)
+	report, err := Usage(to, time.Time{}, "")
+	if err != nil || len(report.Profiles) != 1 || report.Profiles[0].Profile != "work" || report.BeforeJournal != 0 {
+		t.Fatalf("expected the session attributed to work after migrating, got %+v (%v)", report, err)
+	}
+
+	if _, _, err := MigrateStorage(to, to, false); err == nil {
+		t.Fatalf("expected migrating to the same layout to fail")
+	}
+}
+
+func TestInitializeDryRunCreatesNothing(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	os.Remove(paths.ProfilesDir)
+
+	plan, err := Initialize(paths, true)
+	if err != nil || len(plan.Steps) != 1 || plan.Steps[0].Path != paths.ProfilesDir {
+		t.Fatalf("expected the profiles directory planned, got %+v (%v)", plan, err)
+	}
+	if _, err := os.Stat(paths.ProfilesDir); !os.IsNotExist(err) {
+		t.Fatalf("expected a dry run to create nothing")
+	}
+	if _, err := Initialize(paths, false); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	if info, err := os.Stat(paths.ProfilesDir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected the profiles directory created with mode 700, got %v (%v)", info, err)
+	}
+}
+
+func TestMigrateStorageRefusesNonEmptyDestination(t *testing.T) {
+	from, cleanup := setupTest(t)
+	defer cleanup()
+
+	to := from
+	to.Storage = config.StorageXDG
+	to.DataDir = filepath.Join(from.CodexDir, "data")
+	to.StateDir = filepath.Join(from.CodexDir, "state")
+	to.ProfilesDir = filepath.Join(to.DataDir, "profiles")
+	to.MetaFile = filepath.Join(to.DataDir, "meta.json")
+	to.ActiveFile = filepath.Join(to.StateDir, "active")
+	to.LockFile = filepath.Join(to.StateDir, "lock")
+
+	os.WriteFile(filepath.Join(from.ProfilesDir, "a.json"), []byte(`{}`), 0600)
+	os.MkdirAll(to.ProfilesDir, 0700)
+	os.WriteFile(filepath.Join(to.ProfilesDir, "b.json"), []byte(`{}`), 0600)
+
+	if _, _, err := MigrateStorage(from, to, false); err == nil {
+		t.Fatalf("expected migration into non-empty storage to fail")
+	}
+	if _, err := os.Stat(filepath.Join(from.ProfilesDir, "a.json")); err != nil {
+		t.Fatalf("expected source profile to be untouched: %v", err)
+	}
+
+	// The trash is checked like the profiles, before anything changes.
+	os.Remove(filepath.Join(to.ProfilesDir, "b.json"))
+	from.TrashDir = filepath.Join(from.CodexDir, ".codex-mp-trash")
+	to.TrashDir = filepath.Join(to.DataDir, "trash")
+	os.MkdirAll(filepath.Join(to.TrashDir, "1"), 0700)
+	os.WriteFile(filepath.Join(to.TrashDir, "1", "profile.json"), []byte(`{}`), 0600)
+	if _, _, err := MigrateStorage(from, to, false); err == nil {
+		t.Fatalf("expected migration into a non-empty trash to fail")
+	}
+	if _, err := os.Stat(filepath.Join(to.TrashDir, "1", "profile.json")); err != nil {
+		t.Fatalf("expected the destination trash to be untouched: %v", err)
+	}
+	if _, err := os.Stat(to.ProfilesDir); err != nil {
+		t.Fatalf("expected the empty destination profiles directory to be kept: %v", err)
+	}
+}
+
+func TestMigrateStorageRollbackKeepsExistingDirectories(t *testing.T) {
+	from, cleanup := setupTest(t)
+	defer cleanup()
+	from.TrashDir = filepath.Join(from.CodexDir, ".codex-mp-trash")
+	from.SyncDir = filepath.Join(from.CodexDir, ".codex-mp-sync")
+
+	to := from
+	to.Storage = config.StorageXDG
+	to.DataDir = filepath.Join(from.CodexDir, "data")
+	to.StateDir = filepath.Join(from.CodexDir, "state")
+	to.ProfilesDir = filepath.Join(to.DataDir, "profiles")
+	to.MetaFile = filepath.Join(to.DataDir, "meta.json")
+	to.TrashDir = filepath.Join(to.DataDir, "trash")
+	to.SyncDir = filepath.Join(to.DataDir, "sync")
+	to.ActiveFile = filepath.Join(to.StateDir, "active")
+	to.LockFile = filepath.Join(to.StateDir, "lock")
+
+	os.WriteFile(from.AuthFile, []byte(`{"token":"a"}`), 0600)
+	if _, err := Save("a", from); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	os.MkdirAll(filepath.Join(from.TrashDir, "1"), 0700)
+	os.WriteFile(filepath.Join(from.TrashDir, "1", "profile.json"), []byte(`{}`), 0600)
+	os.MkdirAll(from.SyncDir, 0700)
+	os.WriteFile(filepath.Join(from.SyncDir, "state.json"), []byte(`{}`), 0600)
+
+	// An existing, empty trash; no sync directory; and an active marker that can't be
+	// written, so the migration fails after copying both.
+	os.MkdirAll(to.TrashDir, 0700)
+	os.MkdirAll(filepath.Join(to.ActiveFile, "blocker"), 0700)
+
+	if _, _, err := MigrateStorage(from, to, false); err == nil || !strings.Contains(err.Error(), "active profile marker") {
+		t.Fatalf("expected the migration to fail writing the marker, got %v", err)
+	}
+	if entries, err := os.ReadDir(to.TrashDir); err != nil || len(entries) != 0 {
+		t.Fatalf("expected the existing trash emptied again, got %v (%v)", entries, err)
+	}
+	if _, err := os.Stat(to.SyncDir); !os.IsNotExist(err) {
+		t.Fatalf("expected the sync directory the migration created to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(from.TrashDir, "1", "profile.json")); err != nil {
+		t.Fatalf("expected the source trash untouched: %v", err)
+	}
+}
+
+func TestUseTracksActiveProfilePerTarget(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	ci := paths.WithTarget("ci", filepath.Join(paths.CodexDir, "ci-home"))
+
+	if err := os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"token":"w"}`), 0600); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(paths.ProfilesDir, "home.json"), []byte(`{"token":"h"}`), 0600); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+
+	if err := Use("home", paths); err != nil {
+		t.Fatalf("use in default target failed: %v", err)
+	}
+	if err := Use("work", ci); err != nil {
+		t.Fatalf("use in ci target failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(ci.AuthFile)
+	if err != nil || string(raw) != `{"token":"w"}` {
+		t.Fatalf("expected work auth in ci target, got %q (%v)", raw, err)
+	}
+	raw, err = os.ReadFile(paths.AuthFile)
+	if err != nil || string(raw) != `{"token":"h"}` {
+		t.Fatalf("expected default target untouched, got %q (%v)", raw, err)
+	}
+
+	active, err := ActiveTargets([]config.Paths{paths, ci})
+	if err != nil {
+		t.Fatalf("active targets failed: %v", err)
+	}
+	if active[config.DefaultTarget] != "home" || active["ci"] != "work" {
+		t.Fatalf("unexpected active targets: %v", active)
+	}
+
+	// Token refresh in the ci target syncs back to the shared store on the next switch there.
+	if err := os.WriteFile(ci.AuthFile, []byte(`{"token":"w2"}`), 0600); err != nil {
+		t.Fatalf("failed to rotate ci auth: %v", err)
+	}
+	if err := Use("home", ci); err != nil {
+		t.Fatalf("second use in ci target failed: %v", err)
+	}
+	raw, _ = os.ReadFile(filepath.Join(paths.ProfilesDir, "work.json"))
+	if string(raw) != `{"token":"w2"}` {
+		t.Fatalf("expected work profile synced from ci target, got %q", raw)
+	}
+}
+
+func fakeJWT(claims string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".sig"
+}
+
+func TestListDetailsDecodesIdentityAndMetadata(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	idToken := fakeJWT(`{"email":"dev@example.com","https://api.openai.com/auth":{"chatgpt_plan_type":"pro","chatgpt_account_id":"acct-1"}}`)
+	accessToken := fakeJWT(`{"exp":1893456000}`)
+	auth := `{"tokens":{"id_token":"` + idToken + `","access_token":"` + accessToken + `"},"last_refresh":"2026-01-02T03:04:05Z"}`
+	if err := os.WriteFile(paths.AuthFile, []byte(auth), 0600); err != nil {
+		t.Fatalf("failed to write auth file: %v", err)
+	}
+	if _, err := Save("work", paths); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := SetTags("work", []string{"client", "billing", "client"}, paths); err != nil {
+		t.Fatalf("set tags failed: %v", err)
+	}
+	if err := SetTags("work", []string{"bad tag"}, paths); err == nil {
+		t.Fatalf("expected invalid tag to be rejected")
+	}
+
+	details, err := ListDetails(paths)
+	if err != nil {
+		t.Fatalf("list details failed: %v", err)
+	}
+	if len(details) != 1 {
+		t.Fatalf("expected 1 profile, got %d", len(details))
+	}
+
+	d := details[0]
+	if d.Identity.Email != "dev@example.com" || d.Identity.Plan != "pro" || d.Identity.AccountID != "acct-1" {
+		t.Fatalf("unexpected identity: %+v", d.Identity)
+	}
+	if d.Identity.ExpiresAt == nil || d.Identity.ExpiresAt.Unix() != 1893456000 {
+		t.Fatalf("expected access token expiry, got %v", d.Identity.ExpiresAt)
+	}
+	if d.Identity.LastRefresh == nil {
+		t.Fatalf("expected last refresh to be decoded")
+	}
+	if len(d.Tags) != 2 || d.Tags[0] != "billing" || d.Tags[1] != "client" {
+		t.Fatalf("expected sorted unique tags, got %v", d.Tags)
+	}
+	if d.LastUsed == nil {
+		t.Fatalf("expected last used to be recorded on save")
+	}
+
+	if err := Rename("work", "office", paths); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	details, _ = ListDetails(paths)
+	if len(details[0].Tags) != 2 {
+		t.Fatalf("expected tags to follow rename, got %v", details[0].Tags)
+	}
+}
+
+func TestCurrentProfileDetectsDrift(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	authFor := func(account, token string) string {
+		return `{"tokens":{"account_id":"` + account + `","access_token":"` + token + `"}}`
+	}
+
+	if err := os.WriteFile(paths.AuthFile, []byte(authFor("acct-a", "t1")), 0600); err != nil {
+		t.Fatalf("failed to write auth file: %v", err)
+	}
+	if _, err := Save("a", paths); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	cur, err := CurrentProfile(paths)
+	if err != nil {
+		t.Fatalf("current failed: %v", err)
+	}
+	if cur.Name != "a" || cur.Drift || !cur.LoggedIn {
+		t.Fatalf("unexpected current after save: %+v", cur)
+	}
+	if fp, _ := GetFingerprint(paths.AuthFile); cur.Fingerprint != fp {
+		t.Fatalf("expected cached fingerprint %s, got %s", fp, cur.Fingerprint)
+	}
+
+	// A token refresh for the same account is not drift.
+	if err := os.WriteFile(paths.AuthFile, []byte(authFor("acct-a", "t2-refreshed")), 0600); err != nil {
+		t.Fatalf("failed to refresh auth file: %v", err)
+	}
+	if cur, _ = CurrentProfile(paths); cur.Drift {
+		t.Fatalf("expected refreshed tokens not to be drift")
+	}
+
+	// Logging in to another account outside codex-mp is.
+	if err := os.WriteFile(paths.AuthFile, []byte(authFor("acct-b", "t1")), 0600); err != nil {
+		t.Fatalf("failed to replace auth file: %v", err)
+	}
+	if cur, _ = CurrentProfile(paths); !cur.Drift || cur.Name != "a" {
+		t.Fatalf("expected drift for a different account, got %+v", cur)
+	}
+
+	os.Remove(paths.AuthFile)
+	if cur, _ = CurrentProfile(paths); cur.LoggedIn || cur.Drift {
+		t.Fatalf("expected logged out state, got %+v", cur)
+	}
+}
+
+func TestLockTimeoutReportsHolder(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{}`), 0600)
+
+	unlock, err := fs.LockContext(context.Background(), paths.LockFile, fs.LockOptions{Holder: "codex-mp use work"})
+	if err != nil {
+		t.Fatalf("failed to take lock: %v", err)
+	}
+	defer unlock()
+
+	LockTimeout = 50 * time.Millisecond
+	defer func() { LockTimeout = 0 }()
+
+	start := time.Now()
+	err = Delete("work", paths)
+	if err == nil {
+		t.Fatalf("expected delete to time out while locked")
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Fatalf("expected timeout near 50ms, waited %s", waited)
+	}
+
+	var locked *fs.LockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("expected a LockedError, got %v", err)
+	}
+	want := fmt.Sprintf("locked by pid %d (codex-mp use work) for ", os.Getpid())
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected %q in error, got %q", want, err.Error())
+	}
+
+	// Readers also wait for the exclusive holder.
+	if _, err := List(paths); err == nil {
+		t.Fatalf("expected list to time out while a writer holds the lock")
+	}
+}
+
+func TestSharedLockAllowsReaders(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{}`), 0600)
+
+	unlock, err := fs.LockContext(context.Background(), paths.LockFile, fs.LockOptions{Shared: true})
+	if err != nil {
+		t.Fatalf("failed to take shared lock: %v", err)
+	}
+	defer unlock()
+
+	LockTimeout = -1 // try mode: never wait
+	defer func() { LockTimeout = 0 }()
+
+	if profiles, err := List(paths); err != nil || len(profiles) != 1 {
+		t.Fatalf("expected list to run alongside another reader, got %v (%v)", profiles, err)
+	}
+	if _, err := CurrentProfile(paths); err != nil {
+		t.Fatalf("expected current to run alongside another reader: %v", err)
+	}
+
+	err = Delete("work", paths)
+	if err == nil || !strings.Contains(err.Error(), "locked by another process") {
+		t.Fatalf("expected writer to fail fast while readers hold the lock, got %v", err)
+	}
+}
+
+func TestSymlinkPolicyAppliesToUseAndSave(t *testing.T) {
+	for _, policy := range []fs.SymlinkPolicy{fs.SymlinkReplace, fs.SymlinkWriteThrough, fs.SymlinkRefuse} {
+		t.Run(string(policy), func(t *testing.T) {
+			paths, cleanup := setupTest(t)
+			defer cleanup()
+
+			paths.ConfigFile = filepath.Join(paths.CodexDir, "config.json")
+			os.WriteFile(paths.ConfigFile, []byte(`{"symlink_policy":"`+policy+`"}`), 0600)
+
+			vault := filepath.Join(paths.CodexDir, "vault")
+			os.MkdirAll(vault, 0700)
+			target := filepath.Join(vault, "auth.json")
+			os.WriteFile(target, []byte(`{"token":"vault"}`), 0600)
+			if err := os.Symlink(target, paths.AuthFile); err != nil {
+				t.Fatalf("failed to create symlink: %v", err)
+			}
+			os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"token":"work"}`), 0600)
+
+			// Saving only reads auth.json, so it works through the link under every policy.
+			if _, err := Save("vault", paths); err != nil {
+				t.Fatalf("save failed: %v", err)
+			}
+
+			err := Use("work", paths)
+			info, _ := os.Lstat(paths.AuthFile)
+			vaultRaw, _ := os.ReadFile(target)
+			authRaw, _ := os.ReadFile(paths.AuthFile)
+
+			switch policy {
+			case fs.SymlinkReplace:
+				if err != nil {
+					t.Fatalf("use failed: %v", err)
+				}
+				if info.Mode()&os.ModeSymlink != 0 || string(authRaw) != `{"token":"work"}` || string(vaultRaw) != `{"token":"vault"}` {
+					t.Fatalf("expected link replaced and vault untouched, got auth=%q vault=%q", authRaw, vaultRaw)
+				}
+			case fs.SymlinkWriteThrough:
+				if err != nil {
+					t.Fatalf("use failed: %v", err)
+				}
+				if info.Mode()&os.ModeSymlink == 0 || string(vaultRaw) != `{"token":"work"}` {
+					t.Fatalf("expected link kept and vault updated, got vault=%q", vaultRaw)
+				}
+			case fs.SymlinkRefuse:
+				if !errors.Is(err, fs.ErrSymlinkRefused) {
+					t.Fatalf("expected ErrSymlinkRefused, got %v", err)
+				}
+				if info.Mode()&os.ModeSymlink == 0 || string(vaultRaw) != `{"token":"vault"}` {
+					t.Fatalf("expected link and vault untouched, got vault=%q", vaultRaw)
+				}
+			}
+
+			checks, err := Doctor(paths)
+			if err != nil {
+				t.Fatalf("doctor failed: %v", err)
+			}
+			var authStatus string
+			for _, c := range checks {
+				if c.Name == paths.AuthFile {
+					authStatus = c.Status
+				}
+			}
+			want := map[fs.SymlinkPolicy]string{fs.SymlinkReplace: CheckOK, fs.SymlinkWriteThrough: CheckOK, fs.SymlinkRefuse: CheckFail}[policy]
+			if authStatus != want {
+				t.Fatalf("expected doctor to report auth.json as %s, got %s", want, authStatus)
+			}
+		})
+	}
+}
+
+func TestInvalidSymlinkPolicyIsRejected(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	paths.ConfigFile = filepath.Join(paths.CodexDir, "config.json")
+	os.WriteFile(paths.ConfigFile, []byte(`{"symlink_policy":"follow"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"token":"work"}`), 0600)
+
+	if err := Use("work", paths); err == nil || !strings.Contains(err.Error(), "invalid symlink policy") {
+		t.Fatalf("expected invalid policy error, got %v", err)
+	}
+	if _, err := os.Stat(paths.AuthFile); !os.IsNotExist(err) {
+		t.Fatalf("expected auth.json not to be written")
+	}
+}
+
+func TestValidateNameAllowsGroupsButNotTraversal(t *testing.T) {
+	for _, name := range []string{"work", "acme/dev", "acme/eu/prod", "v1.2"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("expected %q to be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "/abs", "acme/", "acme//dev", "../x", "acme/../x", "acme/./dev", "..", "a.json/b", `acme\dev`} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestGroupedProfiles(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, name := range []string{"acme/dev", "acme/prod", "old/a", "old/b", "personal"} {
+		os.WriteFile(paths.AuthFile, []byte(`{"token":"`+name+`"}`), 0600)
+		if _, err := Save(name, paths); err != nil {
+			t.Fatalf("save %s failed: %v", name, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(paths.ProfilesDir, "acme")); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected group directory with mode 0700, got %v", err)
+	}
+
+	if err := Use("acme/dev", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	profiles, err := List(paths)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	var names []string
+	for _, p := range profiles {
+		names = append(names, p.Name)
+		if p.Active != (p.Name == "acme/dev") {
+			t.Fatalf("unexpected active state for %s", p.Name)
+		}
+	}
+	if got := strings.Join(names, ","); got != "acme/dev,acme/prod,old/a,old/b,personal" {
+		t.Fatalf("unexpected list order: %s", got)
+	}
+
+	matched, err := Match("old/*", paths)
+	if err != nil || strings.Join(matched, ",") != "old/a,old/b" {
+		t.Fatalf("unexpected matches %v (%v)", matched, err)
+	}
+	for _, name := range matched {
+		if err := Delete(name, paths); err != nil {
+			t.Fatalf("delete %s failed: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfilesDir, "old")); !os.IsNotExist(err) {
+		t.Fatalf("expected empty group directory to be removed")
+	}
+
+	if err := Rename("acme/dev", "globex/dev", paths); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if name, _ := readActiveProfile(paths); name != "globex/dev" {
+		t.Fatalf("expected active marker to follow rename, got %q", name)
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfilesDir, "acme", "prod.json")); err != nil {
+		t.Fatalf("expected sibling to stay in its group: %v", err)
+	}
+}
+
+func TestPreviousProfileTracksSwitches(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, name := range []string{"work", "personal"} {
+		os.WriteFile(filepath.Join(paths.ProfilesDir, name+".json"), []byte(`{"token":"`+name+`"}`), 0600)
+	}
+
+	if prev, _ := PreviousProfile(paths); prev != "" {
+		t.Fatalf("expected no previous profile, got %q", prev)
+	}
+	Use("work", paths)
+	Use("work", paths)
+	if prev, _ := PreviousProfile(paths); prev != "" {
+		t.Fatalf("expected re-using the active profile not to set previous, got %q", prev)
+	}
+	Use("personal", paths)
+	if prev, _ := PreviousProfile(paths); prev != "work" {
+		t.Fatalf("expected previous work, got %q", prev)
+	}
+
+	if err := Rename("work", "job", paths); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if prev, _ := PreviousProfile(paths); prev != "job" {
+		t.Fatalf("expected previous marker to follow rename, got %q", prev)
+	}
+	if err := Delete("job", paths); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if prev, _ := PreviousProfile(paths); prev != "" {
+		t.Fatalf("expected previous marker cleared on delete, got %q", prev)
+	}
+}
+
+func TestAliasesAndDefaultFollowProfiles(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.ConfigFile = filepath.Join(paths.CodexDir, "config.json")
+
+	for _, name := range []string{"work", "personal"} {
+		os.WriteFile(filepath.Join(paths.ProfilesDir, name+".json"), []byte(`{"token":"`+name+`"}`), 0600)
+	}
+
+	if err := SetAlias("w", "missing", paths); err == nil {
+		t.Fatalf("expected alias to a missing profile to fail")
+	}
+	if err := SetAlias("personal", "work", paths); err == nil {
+		t.Fatalf("expected alias shadowing a profile to fail")
+	}
+	// Config changes are planned like any other mutation.
+	plan, err := Apply(Operation{Op: OpAlias, Name: "w", To: "work"}, paths, true)
+	if err != nil || len(plan.Steps) != 1 || plan.Steps[0].Path != paths.ConfigFile {
+		t.Fatalf("expected a dry run planning the config write, got %+v (%v)", plan, err)
+	}
+	if aliases, _ := Aliases(paths); len(aliases) != 0 {
+		t.Fatalf("expected the dry run to change nothing, got %v", aliases)
+	}
+	if err := SetAlias("w", "work", paths); err != nil {
+		t.Fatalf("set alias failed: %v", err)
+	}
+	if err := SetDefaultProfile("work", paths); err != nil {
+		t.Fatalf("set default failed: %v", err)
+	}
+	if name, _ := ResolveAlias("w", paths); name != "work" {
+		t.Fatalf("expected w to resolve to work, got %q", name)
+	}
+	if name, _ := ResolveAlias("personal", paths); name != "personal" {
+		t.Fatalf("expected plain names to pass through, got %q", name)
+	}
+
+	paths.UndoDir = filepath.Join(paths.CodexDir, ".codex-mp-undo")
+	ops := []Operation{{Op: OpAlias, Name: "p", To: "personal"}, {Op: OpTargetAdd, Name: "ci", Dir: "/srv/ci"}}
+	if _, err := Batch(ops, paths, false); err != nil {
+		t.Fatalf("batch of config changes failed: %v", err)
+	}
+	if _, _, err := Undo(paths, false); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if cfg, _ := config.Load(paths.ConfigFile); cfg.Aliases["p"] != "" || len(cfg.Targets) != 0 || cfg.Aliases["w"] != "work" {
+		t.Fatalf("expected the batch of config changes undone, got %+v", cfg)
+	}
+
+	if err := Rename("work", "job", paths); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if name, _ := ResolveAlias("w", paths); name != "job" {
+		t.Fatalf("expected alias to follow rename, got %q", name)
+	}
+	if name, _ := DefaultProfile(paths); name != "job" {
+		t.Fatalf("expected default to follow rename, got %q", name)
+	}
+
+	if err := Delete("job", paths); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if aliases, _ := Aliases(paths); len(aliases) != 0 {
+		t.Fatalf("expected alias dropped with its profile, got %v", aliases)
+	}
+	if name, _ := DefaultProfile(paths); name != "" {
+		t.Fatalf("expected default cleared with its profile, got %q", name)
+	}
+}
+
+func TestCopyClonesProfileAndTags(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"token":"work"}`), 0600)
+	if err := SetTags("work", []string{"prod"}, paths); err != nil {
+		t.Fatalf("set tags failed: %v", err)
+	}
+
+	if err := Copy("work", "scratch/work", paths); err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	if err := Copy("work", "scratch/work", paths); err == nil {
+		t.Fatalf("expected copy onto an existing profile to fail")
+	}
+
+	raw, err := os.ReadFile(filepath.Join(paths.ProfilesDir, "scratch", "work.json"))
+	if err != nil || string(raw) != `{"token":"work"}` {
+		t.Fatalf("unexpected copy content %q (%v)", raw, err)
+	}
+	meta, _ := loadMeta(paths)
+	if got := meta["scratch/work"].Tags; len(got) != 1 || got[0] != "prod" {
+		t.Fatalf("expected tags cloned, got %v", got)
+	}
+}
+
+func TestDiffClassifiesProfiles(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	idToken := func(account string) string {
+		return fakeJWT(`{"email":"dev@example.com","https://api.openai.com/auth":{"chatgpt_account_id":"` + account + `"}}`)
+	}
+	doc := func(account, access, refresh, refreshed string) string {
+		return `{"tokens":{"id_token":"` + idToken(account) + `","access_token":"` + access +
+			`","refresh_token":"` + refresh + `"},"last_refresh":"` + refreshed + `"}`
+	}
+	write := func(name, content string) {
+		os.WriteFile(filepath.Join(paths.ProfilesDir, name+".json"), []byte(content), 0600)
+	}
+
+	write("base", doc("acct-1", "access-1", "refresh-1", "2026-01-01T00:00:00Z"))
+	write("refreshed", doc("acct-1", "access-2", "refresh-1", "2026-01-02T00:00:00Z"))
+	write("relogin", doc("acct-1", "access-3", "refresh-2", "2026-01-03T00:00:00Z"))
+	write("other", doc("acct-2", "access-4", "refresh-4", "2026-01-01T00:00:00Z"))
+	write("copy", doc("acct-1", "access-1", "refresh-1", "2026-01-01T00:00:00Z"))
+	os.WriteFile(paths.AuthFile, []byte(`{"OPENAI_API_KEY":"sk-secret"}`), 0600)
+
+	cases := []struct{ b, want string }{
+		{"copy", VerdictIdentical},
+		{"refreshed", VerdictSameGeneration},
+		{"relogin", VerdictSameAccount},
+		{"other", VerdictUnrelated},
+		{"", VerdictUnrelated},
+	}
+	for _, c := range cases {
+		cmp, err := Diff("base", c.b, paths)
+		if err != nil {
+			t.Fatalf("diff base %s failed: %v", c.b, err)
+		}
+		if cmp.Verdict != c.want {
+			t.Errorf("diff base %q: expected %s, got %s", c.b, c.want, cmp.Verdict)
+		}
+	}
+
+	cmp, _ := Diff("base", "refreshed", paths)
+	if cmp.Newer != "refreshed" {
+		t.Fatalf("expected refreshed to be newer, got %q", cmp.Newer)
+	}
+	changes := map[string]string{}
+	for _, k := range cmp.Keys {
+		changes[k.Key] = k.Change
+	}
+	if changes["tokens.access_token"] != KeyChanged || changes["tokens.refresh_token"] != KeyEqual {
+		t.Fatalf("unexpected key changes: %v", changes)
+	}
+
+	cmp, _ = Diff("base", "", paths)
+	if cmp.B != LiveAuth || cmp.IdentityB.Mode != "apikey" {
+		t.Fatalf("unexpected live comparison: %+v", cmp)
+	}
+	out := fmt.Sprintf("%+v", cmp)
+	for _, secret := range []string{"sk-secret", "access-1", "refresh-1"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("comparison leaked secret %q", secret)
+		}
+	}
+}
+
+func TestParseBatchRejectsBadOperations(t *testing.T) {
+	ops, err := ParseBatch(strings.NewReader(`{"op":"save","name":"work"}
+
+{"op":"rename","from":"work","to":"acme/work"}
+`))
+	if err != nil || len(ops) != 2 {
+		t.Fatalf("expected 2 operations, got %v (%v)", ops, err)
+	}
+
+	for _, input := range []string{
+		`{"op":"launch","name":"work"}`,
+		`{"op":"use"}`,
+		`{"op":"use","name":"../x"}`,
+		`{"op":"use","nmae":"work"}`,
+		`{"op":"tag","name":"work","tags":["bad tag"]}`,
+	} {
+		if _, err := ParseBatch(strings.NewReader(input)); err == nil {
+			t.Errorf("expected %s to be rejected", input)
+		}
+	}
+}
+
+func TestBatchAppliesOrRollsBackAsOne(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.ConfigFile = filepath.Join(paths.CodexDir, "config.json")
+
+	os.WriteFile(paths.AuthFile, []byte(`{"token":"live"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "old.json"), []byte(`{"token":"old"}`), 0600)
+	if err := Use("old", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+
+	snapshotStore := func() string {
+		var b strings.Builder
+		names, _ := profileNames(paths.ProfilesDir)
+		for _, name := range names {
+			raw, _ := os.ReadFile(profilePath(paths, name))
+			fmt.Fprintf(&b, "%s=%s;", name, raw)
+		}
+		for _, file := range []string{paths.AuthFile, paths.ActiveFile, paths.PreviousFile, paths.MetaFile} {
+			raw, _ := os.ReadFile(file)
+			fmt.Fprintf(&b, "%s=%s;", filepath.Base(file), raw)
+		}
+		return b.String()
+	}
+	before := snapshotStore()
+
+	ops := []Operation{
+		{Op: "copy", From: "old", To: "acme/dev"},
+		{Op: "tag", Name: "acme/dev", Tags: []string{"team"}},
+		{Op: "use", Name: "acme/dev"},
+		{Op: "delete", Name: "old"},
+		{Op: "use", Name: "missing"},
+		{Op: "save", Name: "never"},
+	}
+
+	// Dry run: the failure is reported but nothing changes.
+	results, err := Batch(ops, paths, true)
+	if err == nil {
+		t.Fatalf("expected dry run to report the failing operation")
+	}
+	if results[3].Status != BatchPlanned || results[4].Status != BatchFailed || results[5].Status != BatchSkipped {
+		t.Fatalf("unexpected dry-run statuses: %+v", results)
+	}
+	if after := snapshotStore(); after != before {
+		t.Fatalf("dry run changed the store:\n%s\n%s", before, after)
+	}
+
+	// Real run: the failure rolls every earlier operation back.
+	results, err = Batch(ops, paths, false)
+	if err == nil {
+		t.Fatalf("expected batch to fail")
+	}
+	if results[0].Status != BatchRolledBack || results[4].Status != BatchFailed || results[5].Status != BatchSkipped {
+		t.Fatalf("unexpected statuses: %+v", results)
+	}
+	if after := snapshotStore(); after != before {
+		t.Fatalf("rollback did not restore the store:\n%s\n%s", before, after)
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfilesDir, "acme")); !os.IsNotExist(err) {
+		t.Fatalf("expected group created by the batch to be removed")
+	}
+
+	// Without the failing operation everything applies.
+	results, err = Batch(ops[:4], paths, false)
+	if err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+	for _, r := range results {
+		if r.Status != BatchApplied {
+			t.Fatalf("unexpected status: %+v", r)
+		}
+	}
+	if name, _ := readActiveProfile(paths); name != "acme/dev" {
+		t.Fatalf("expected acme/dev active, got %q", name)
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfilesDir, "old.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected old to be deleted")
+	}
+	entries, _ := os.ReadDir(paths.DataDir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".codex-mp-snapshot-") {
+			t.Fatalf("snapshot left behind: %s", e.Name())
+		}
+	}
+}
+
+func TestBatchPurgeLeavesNoCopy(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "gone.json"), []byte(`{"token":"secret-gone"}`), 0600)
+
+	// A file linked to a snapshot copy shows whether the copy was overwritten.
+	snap, err := takeSnapshot(paths)
+	if err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	linked := filepath.Join(paths.CodexDir, "linked")
+	if err := os.Link(profilePath(snap.Paths, "gone"), linked); err != nil {
+		t.Fatalf("link failed: %v", err)
+	}
+	snap.discard()
+	if raw, _ := os.ReadFile(linked); strings.Contains(string(raw), "secret-gone") {
+		t.Fatalf("expected the snapshot copy shredded, got %q", raw)
+	}
+	os.Remove(linked)
+
+	ops := []Operation{{Op: OpDelete, Name: "gone", Purge: true}}
+	for _, dryRun := range []bool{true, false} {
+		if _, err := Batch(ops, paths, dryRun); err != nil {
+			t.Fatalf("batch (dry run %v) failed: %v", dryRun, err)
+		}
+	}
+	filepath.WalkDir(paths.DataDir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if raw, _ := os.ReadFile(p); strings.Contains(string(raw), "secret-gone") {
+				t.Errorf("copy of the purged profile survived in %s", p)
+			}
+		}
+		return nil
+	})
+}
+
+func TestDryRunPlansWithoutChanging(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "a.json"), []byte(`{"token":"a"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "b.json"), []byte(`{"token":"b"}`), 0600)
+	if err := Use("b", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	os.WriteFile(paths.AuthFile, []byte(`{"token":"b2"}`), 0644)
+	os.Chmod(paths.AuthFile, 0644)
+
+	plan, err := Apply(Operation{Op: OpUse, Name: "a"}, paths, true)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	var details []string
+	for _, step := range plan.Steps {
+		details = append(details, step.Action+" "+filepath.Base(step.Path)+" "+step.FromMode+" "+step.Detail)
+	}
+	want := []string{
+		"copy b.json  sync-back: keep refreshed tokens of b",
+		"copy auth.json 0644 install a",
+		"write .codex-mp-previous  previous profile: b",
+		"write .codex-mp-active  active profile: a",
+	}
+	if len(details) < len(want) || strings.Join(details[:len(want)], "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected plan:\n%s", strings.Join(details, "\n"))
+	}
+
+	auth, _ := os.ReadFile(paths.AuthFile)
+	b, _ := os.ReadFile(filepath.Join(paths.ProfilesDir, "b.json"))
+	active, _ := readActiveProfile(paths)
+	if string(auth) != `{"token":"b2"}` || string(b) != `{"token":"b"}` || active != "b" {
+		t.Fatalf("dry run changed the store: auth=%q b=%q active=%q", auth, b, active)
+	}
+
+	applied, err := Apply(Operation{Op: OpUse, Name: "a"}, paths, false)
+	if err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	if len(applied.Steps) != len(plan.Steps) {
+		t.Fatalf("expected the real run to follow the plan, got %d steps for %d planned", len(applied.Steps), len(plan.Steps))
+	}
+	if b, _ := os.ReadFile(filepath.Join(paths.ProfilesDir, "b.json")); string(b) != `{"token":"b2"}` {
+		t.Fatalf("expected sync-back into b, got %q", b)
+	}
+
+	// A destination the symlink policy refuses fails at planning time.
+	paths.ConfigFile = filepath.Join(paths.CodexDir, "config.json")
+	os.WriteFile(paths.ConfigFile, []byte(`{"symlink_policy":"refuse"}`), 0600)
+	os.Remove(paths.AuthFile)
+	os.Symlink(filepath.Join(paths.ProfilesDir, "a.json"), paths.AuthFile)
+	if _, err := Apply(Operation{Op: OpUse, Name: "b"}, paths, true); !errors.Is(err, fs.ErrSymlinkRefused) {
+		t.Fatalf("expected ErrSymlinkRefused, got %v", err)
+	}
+}
+
+func TestUndoRevertsMutations(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.UndoDir = filepath.Join(paths.CodexDir, ".codex-mp-undo")
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "a.json"), []byte(`{"token":"a"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "b.json"), []byte(`{"token":"b"}`), 0600)
+	if err := Use("b", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	os.WriteFile(paths.AuthFile, []byte(`{"token":"b2"}`), 0600)
+	if err := Use("a", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	if err := Delete("b", paths); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	history, err := UndoHistory(paths)
+	if err != nil || len(history) != 3 || history[0].Ops[0] != "delete b" {
+		t.Fatalf("unexpected undo history: %+v (%v)", history, err)
+	}
+
+	if _, plan, err := Undo(paths, true); err != nil || len(plan.Steps) == 0 {
+		t.Fatalf("undo dry run failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfilesDir, "b.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected dry run to leave b deleted")
+	}
+
+	if _, _, err := Undo(paths, false); err != nil {
+		t.Fatalf("undo delete failed: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(paths.ProfilesDir, "b.json")); string(b) != `{"token":"b2"}` {
+		t.Fatalf("expected deleted profile restored, got %q", b)
+	}
+
+	// Undoing the switch also reverts the sync-back into b.
+	entry, _, err := Undo(paths, false)
+	if err != nil || entry.Ops[0] != "use a" {
+		t.Fatalf("undo use failed: %+v (%v)", entry, err)
+	}
+	auth, _ := os.ReadFile(paths.AuthFile)
+	b, _ := os.ReadFile(filepath.Join(paths.ProfilesDir, "b.json"))
+	active, _ := readActiveProfile(paths)
+	if string(auth) != `{"token":"b2"}` || string(b) != `{"token":"b"}` || active != "b" {
+		t.Fatalf("expected switch reverted, got auth=%q b=%q active=%q", auth, b, active)
+	}
+
+	var before []byte
+	linked := filepath.Join(paths.CodexDir, "linked")
+	for i := 0; i < UndoDepth+2; i++ {
+		if err := SetTags("a", []string{fmt.Sprintf("t%d", i)}, paths); err != nil {
+			t.Fatalf("tag failed: %v", err)
+		}
+		if i > 0 {
+			continue
+		}
+		// A file linked to the first entry's pre-image shows whether dropping it shredded it.
+		entries, _ := UndoHistory(paths)
+		first := entries[0]
+		blob := filepath.Join(paths.UndoDir, strconv.Itoa(first.ID), first.Files[0].Blob)
+		before, _ = os.ReadFile(blob)
+		if err := os.Link(blob, linked); err != nil {
+			t.Fatalf("link failed: %v", err)
+		}
+	}
+	if history, _ := UndoHistory(paths); len(history) != UndoDepth {
+		t.Fatalf("expected undo history bounded to %d, got %d", UndoDepth, len(history))
+	}
+	if after, _ := os.ReadFile(linked); len(before) == 0 || bytes.Equal(after, before) {
+		t.Fatalf("expected the dropped undo entry shredded, got %q", after)
+	}
+
+	ops := []Operation{{Op: OpCopy, From: "a", To: "c"}, {Op: OpDelete, Name: "a"}}
+	if _, err := Batch(ops, paths, false); err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+	if entry, _, err := Undo(paths, false); err != nil || len(entry.Ops) != 2 {
+		t.Fatalf("expected batch undone as one entry, got %+v (%v)", entry, err)
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfilesDir, "c.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected copy undone")
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfilesDir, "a.json")); err != nil {
+		t.Fatalf("expected delete undone: %v", err)
+	}
+}
+
+func TestUndoShredsTheEntryItRestored(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.UndoDir = filepath.Join(paths.CodexDir, ".codex-mp-undo")
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "a.json"), []byte(`{"token":"a"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "b.json"), []byte(`{"token":"b"}`), 0600)
+	if err := Use("b", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	os.WriteFile(paths.AuthFile, []byte(`{"token":"secret-b2"}`), 0600)
+	if err := Use("a", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+
+	// A file linked to the pre-image of auth.json shows whether dropping the entry shredded it.
+	history, _ := UndoHistory(paths)
+	linked := filepath.Join(paths.CodexDir, "linked")
+	for _, img := range history[0].Files {
+		if img.Path == paths.AuthFile {
+			if err := os.Link(filepath.Join(paths.UndoDir, strconv.Itoa(history[0].ID), img.Blob), linked); err != nil {
+				t.Fatalf("link failed: %v", err)
+			}
+		}
+	}
+
+	if _, _, err := Undo(paths, false); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if raw, err := os.ReadFile(linked); err != nil || strings.Contains(string(raw), "secret-b2") {
+		t.Fatalf("expected the undone entry shredded, got %q (%v)", raw, err)
+	}
+	filepath.WalkDir(paths.UndoDir, func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if raw, _ := os.ReadFile(p); strings.Contains(string(raw), "secret-b2") {
+				t.Errorf("copy of the restored auth.json survived in %s", p)
+			}
+		}
+		return nil
+	})
+}
+
+func TestUndoUseKeepsRefreshedTokens(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.UndoDir = filepath.Join(paths.CodexDir, ".codex-mp-undo")
+	paths.EventsFile = filepath.Join(paths.CodexDir, ".codex-mp-events.jsonl")
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "a.json"), []byte(`{"token":"a"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "b.json"), []byte(`{"token":"b"}`), 0600)
+	if err := Use("a", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	if err := Use("b", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	// Codex refreshes b's tokens in place before the switch is undone.
+	os.WriteFile(paths.AuthFile, []byte(`{"token":"b-refreshed"}`), 0600)
+
+	if _, _, err := Undo(paths, false); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	auth, _ := os.ReadFile(paths.AuthFile)
+	b, _ := os.ReadFile(filepath.Join(paths.ProfilesDir, "b.json"))
+	if active, _ := readActiveProfile(paths); string(auth) != `{"token":"a"}` || active != "a" {
+		t.Fatalf("expected the switch undone, got auth=%q active=%q", auth, active)
+	}
+	if string(b) != `{"token":"b-refreshed"}` {
+		t.Fatalf("expected refreshed tokens synced back into b, got %q", b)
+	}
+	events := openTail(paths.EventsFile, true).drain()
+	if last := events[len(events)-1]; last.Type != EventUndone || last.Profile != "a" {
+		t.Fatalf("expected the undo to name the profile active after it, got %+v", last)
+	}
+}
+
+func TestDeleteMovesToTrashAndRestores(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.TrashDir = filepath.Join(paths.CodexDir, ".codex-mp-trash")
+	paths.UndoDir = filepath.Join(paths.CodexDir, ".codex-mp-undo")
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"token":"w1"}`), 0600)
+	if err := SetTags("work", []string{"prod"}, paths); err != nil {
+		t.Fatalf("tag failed: %v", err)
+	}
+	if err := Delete("work", paths); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"token":"w2"}`), 0600)
+	if err := Delete("work", paths); err != nil {
+		t.Fatalf("second delete failed: %v", err)
+	}
+
+	items, err := ListTrash(paths)
+	if err != nil || len(items) != 2 || items[0].ID != 2 || items[1].Tags[0] != "prod" || items[0].ExpiresAt == nil {
+		t.Fatalf("unexpected trash: %+v (%v)", items, err)
+	}
+	if info, err := os.Stat(paths.TrashDir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected trash with mode 0700, got %v (%v)", info, err)
+	}
+
+	// By name, the newest item comes back; by id, any item, optionally renamed.
+	if _, err := Apply(Operation{Op: OpRestore, Name: "work"}, paths, false); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(paths.ProfilesDir, "work.json")); string(raw) != `{"token":"w2"}` {
+		t.Fatalf("expected newest copy restored, got %q", raw)
+	}
+	if _, err := Apply(Operation{Op: OpRestore, Name: "1"}, paths, false); err == nil {
+		t.Fatalf("expected restore over an existing profile to fail")
+	}
+	if _, err := Apply(Operation{Op: OpRestore, Name: "1", To: "work-old"}, paths, false); err != nil {
+		t.Fatalf("restore as failed: %v", err)
+	}
+	meta, _ := loadMeta(paths)
+	if raw, _ := os.ReadFile(filepath.Join(paths.ProfilesDir, "work-old.json")); string(raw) != `{"token":"w1"}` || len(meta["work-old"].Tags) != 1 {
+		t.Fatalf("expected first copy restored with tags, got %q %+v", raw, meta["work-old"])
+	}
+
+	// Undoing the restore puts the item back in the trash.
+	if _, _, err := Undo(paths, false); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if items, _ := ListTrash(paths); len(items) != 1 || items[0].Name != "work" {
+		t.Fatalf("expected item back in trash, got %+v", items)
+	}
+
+	// Expired items are shredded by the next delete.
+	paths.ConfigFile = filepath.Join(paths.CodexDir, "config.json")
+	os.WriteFile(paths.ConfigFile, []byte(`{"trash_retention":"1ns"}`), 0600)
+	if err := Delete("work", paths); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	plan, err := EmptyTrash(nil, true, paths, true)
+	if err != nil || len(plan.Steps) != 1 {
+		t.Fatalf("expected one expired item, got %+v (%v)", plan, err)
+	}
+	if _, err := EmptyTrash(nil, true, paths, false); err != nil {
+		t.Fatalf("empty failed: %v", err)
+	}
+	if items, _ := ListTrash(paths); len(items) != 0 {
+		t.Fatalf("expected trash emptied, got %+v", items)
+	}
+}
+
+func TestPurgeLeavesNoCopies(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.TrashDir = filepath.Join(paths.CodexDir, ".codex-mp-trash")
+	paths.UndoDir = filepath.Join(paths.CodexDir, ".codex-mp-undo")
+
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "leaked.json"), []byte(`{"token":"leaked"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "other.json"), []byte(`{"token":"other"}`), 0600)
+	if err := Use("leaked", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	if err := Use("other", paths); err != nil { // Keeps a pre-image of auth.json holding leaked
+		t.Fatalf("use failed: %v", err)
+	}
+
+	if err := Purge("leaked", paths); err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	if items, _ := ListTrash(paths); len(items) != 0 {
+		t.Fatalf("expected nothing in trash, got %+v", items)
+	}
+	filepath.WalkDir(paths.CodexDir, func(path string, d os.DirEntry, err error) error {
+		if raw, _ := os.ReadFile(path); strings.Contains(string(raw), "leaked") && !strings.HasSuffix(path, "entry.json") {
+			t.Errorf("copy of the purged profile left at %s", path)
+		}
+		return nil
+	})
+	history, _ := UndoHistory(paths)
+	for _, entry := range history {
+		if entry.Ops[0] == "delete --purge leaked" {
+			t.Fatalf("expected purge not to be undoable")
+		}
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	for in, want := range map[string]time.Duration{"": DefaultTrashRetention, "0": 0, "7d": 7 * 24 * time.Hour, "72h": 72 * time.Hour} {
+		if got, err := ParseRetention(in); err != nil || got != want {
+			t.Fatalf("ParseRetention(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"-1h", "soon", "xd"} {
+		if _, err := ParseRetention(in); err == nil {
+			t.Fatalf("expected ParseRetention(%q) to fail", in)
+		}
+	}
+}
+
+func TestEventsJournalMutations(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.EventsFile = filepath.Join(paths.CodexDir, ".codex-mp-events.jsonl")
+
+	tail := openTail(paths.EventsFile, true)
+	defer tail.close()
+	expect := func(want ...string) {
+		t.Helper()
+		var got []string
+		for _, ev := range tail.drain() {
+			got = append(got, ev.Type+":"+ev.Profile+":"+ev.From)
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("expected events %v, got %v", want, got)
+		}
+	}
+
+	os.WriteFile(paths.AuthFile, []byte(`{"token":"work"}`), 0600)
+	if _, err := Save("work", paths); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "home.json"), []byte(`{"token":"home"}`), 0600)
+	if _, err := Apply(Operation{Op: OpUse, Name: "home"}, paths, true); err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if err := Use("home", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	expect("saved:work:", "synced:work:", "switched:home:work")
+
+	// A batch reports its events only once it has applied as a whole.
+	ops := []Operation{{Op: OpRename, From: "work", To: "job"}, {Op: OpDelete, Name: "missing"}}
+	if _, err := Batch(ops, paths, false); err == nil {
+		t.Fatalf("expected batch to fail")
+	}
+	expect()
+	if _, err := Batch(ops[:1], paths, false); err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+	expect("renamed:job:work")
+
+	// The tail follows the journal across a rotation without losing events.
+	f, _ := os.OpenFile(paths.EventsFile, os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte(strings.Repeat("\n", maxEventsFileSize)))
+	f.Close()
+	expect()
+	if err := Delete("job", paths); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := os.Stat(paths.EventsFile + ".1"); err != nil {
+		t.Fatalf("expected journal rotated: %v", err)
+	}
+	expect("deleted:job:")
+}
+
+func TestSyncBetweenMachinesThroughBareRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	remote := filepath.Join(t.TempDir(), "store.git")
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", out)
+	}
+	machine := func() config.Paths {
+		paths, cleanup := setupTest(t)
+		t.Cleanup(cleanup)
+		paths.SyncDir = filepath.Join(paths.CodexDir, ".codex-mp-sync")
+		paths.TrashDir = filepath.Join(paths.CodexDir, ".codex-mp-trash")
+		return paths
+	}
+	auth := func(token, refreshed string) []byte {
+		return []byte(`{"last_refresh":"` + refreshed + `","tokens":{"access_token":"` + token + `"}}`)
+	}
+	a, b := machine(), machine()
+
+	os.WriteFile(filepath.Join(a.ProfilesDir, "work.json"), auth("sk-work-1", "2026-01-01T00:00:00Z"), 0600)
+	if err := SetTags("work", []string{"client"}, a); err != nil {
+		t.Fatalf("tag failed: %v", err)
+	}
+	if err := SyncInit(remote, "", a); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	if report, err := SyncPush(a); err != nil || len(report.Pushed) != 1 {
+		t.Fatalf("push failed: %+v (%v)", report, err)
+	}
+	filepath.WalkDir(syncRepoDir(a), func(path string, d os.DirEntry, err error) error {
+		if raw, _ := os.ReadFile(path); !d.IsDir() && (strings.Contains(string(raw), "sk-work") || strings.Contains(string(raw), "client")) {
+			t.Errorf("plaintext committed in %s", path)
+		}
+		return nil
+	})
+
+	if err := SyncInit(remote, "", b); err == nil {
+		t.Fatalf("expected joining a store without its key to fail")
+	}
+	if err := SyncInit(remote, SyncKeyFile(a), b); err != nil {
+		t.Fatalf("init with key failed: %v", err)
+	}
+	if report, err := SyncPull(b); err != nil || len(report.Pulled) != 1 {
+		t.Fatalf("pull failed: %+v (%v)", report, err)
+	}
+	meta, _ := loadMeta(b)
+	if raw, _ := os.ReadFile(filepath.Join(b.ProfilesDir, "work.json")); !strings.Contains(string(raw), "sk-work-1") || len(meta["work"].Tags) != 1 {
+		t.Fatalf("expected work pulled with its tags, got %q %+v", raw, meta["work"])
+	}
+	if report, err := SyncPush(b); err != nil || len(report.Pushed) != 0 {
+		t.Fatalf("expected nothing to push back, got %+v (%v)", report, err)
+	}
+
+	// Both sides refresh the tokens; the newest last_refresh wins either way.
+	os.WriteFile(filepath.Join(a.ProfilesDir, "work.json"), auth("sk-work-new", "2026-03-01T00:00:00Z"), 0600)
+	os.WriteFile(filepath.Join(b.ProfilesDir, "work.json"), auth("sk-work-old", "2026-02-01T00:00:00Z"), 0600)
+	if _, err := SyncPush(a); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if report, err := SyncPush(b); err != nil || len(report.Pushed) != 0 {
+		t.Fatalf("expected the older copy not to be pushed, got %+v (%v)", report, err)
+	}
+	if _, err := SyncPull(b); err != nil {
+		t.Fatalf("pull failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(b.ProfilesDir, "work.json")); !strings.Contains(string(raw), "sk-work-new") {
+		t.Fatalf("expected the newest copy, got %q", raw)
+	}
+
+	// A deletion travels as a tombstone and lands in the other machine's trash.
+	if err := Delete("work", a); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if report, err := SyncPush(a); err != nil || len(report.Deleted) != 1 {
+		t.Fatalf("expected deletion pushed, got %+v (%v)", report, err)
+	}
+	if report, err := SyncPull(b); err != nil || len(report.Deleted) != 1 {
+		t.Fatalf("expected deletion pulled, got %+v (%v)", report, err)
+	}
+	if items, _ := ListTrash(b); len(items) != 1 || items[0].Name != "work" {
+		t.Fatalf("expected work in trash, got %+v", items)
+	}
+}
+
+func TestCatalogProfilesAreReadOnly(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.ConfigFile = filepath.Join(paths.CodexDir, "config.json")
+	catalog := t.TempDir()
+	os.MkdirAll(filepath.Join(catalog, "ci"), 0755)
+	os.WriteFile(filepath.Join(catalog, "ci", "bot.json"), []byte(`{"OPENAI_API_KEY":"sk-bot"}`), 0644)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"OPENAI_API_KEY":"sk-work"}`), 0600)
+
+	os.MkdirAll(filepath.Join(paths.ProfilesDir, "acme"), 0700)
+	if err := AddCatalog("acme", catalog, paths); err == nil {
+		t.Fatalf("expected a catalog hiding a local group to be refused")
+	}
+	if err := AddCatalog("platform", catalog, paths); err != nil {
+		t.Fatalf("add catalog failed: %v", err)
+	}
+
+	profiles, err := List(paths)
+	if err != nil || len(profiles) != 2 || profiles[0].Name != "platform/ci/bot" || !profiles[0].Managed || profiles[0].Origin != filepath.Join(catalog, "ci", "bot.json") {
+		t.Fatalf("expected managed entry in list, got %+v (%v)", profiles, err)
+	}
+
+	if err := Use("platform/ci/bot", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(paths.AuthFile); string(raw) != `{"OPENAI_API_KEY":"sk-bot"}` {
+		t.Fatalf("expected catalog profile installed, got %q", raw)
+	}
+	// Codex rewriting auth.json must not leak back into the catalog on switch.
+	os.WriteFile(paths.AuthFile, []byte(`{"OPENAI_API_KEY":"sk-bot-rotated"}`), 0600)
+	if err := Use("work", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(filepath.Join(catalog, "ci", "bot.json")); string(raw) != `{"OPENAI_API_KEY":"sk-bot"}` {
+		t.Fatalf("expected no sync-back into the catalog, got %q", raw)
+	}
+
+	for _, op := range []Operation{
+		{Op: OpSave, Name: "platform/ci/bot"},
+		{Op: OpDelete, Name: "platform/ci/bot"},
+		{Op: OpRename, From: "platform/ci/bot", To: "bot"},
+		{Op: OpRename, From: "work", To: "platform/work"},
+	} {
+		if _, err := Apply(op, paths, false); !errors.Is(err, ErrManaged) {
+			t.Fatalf("%s: expected ErrManaged, got %v", op, err)
+		}
+	}
+	if err := Copy("platform/ci/bot", "bot", paths); err != nil {
+		t.Fatalf("expected a local copy of a managed profile to work, got %v", err)
+	}
+}
+
+func TestAddKeySavesAPIKeyProfile(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+
+	if _, err := AddKey("ci/bot", "sk bad", false, paths, false); err == nil {
+		t.Fatalf("expected a key with whitespace to be refused")
+	}
+	plan, err := AddKey("ci/bot", "sk-proj-first-0001", false, paths, true)
+	if err != nil || len(plan.Steps) == 0 || plan.Steps[len(plan.Steps)-1].Path != profilePath(paths, "ci/bot") {
+		t.Fatalf("expected the dry run to plan writing the profile, got %+v (%v)", plan, err)
+	}
+	if _, err := os.Stat(profilePath(paths, "ci/bot")); !os.IsNotExist(err) {
+		t.Fatalf("expected the dry run to write nothing, got %v", err)
+	}
+	if _, err := AddKey("ci/bot", "sk-proj-first-0001", false, paths, false); err != nil {
+		t.Fatalf("add-key failed: %v", err)
+	}
+	if _, err := ParseBatch(strings.NewReader(`{"op":"add-key","name":"x"}`)); err == nil {
+		t.Fatalf("expected add-key to be refused in a batch")
+	}
+	raw, _ := os.ReadFile(profilePath(paths, "ci/bot"))
+	auth, err := model.ParseAuth(raw)
+	if err != nil || auth.Identity().Mode != model.ModeAPIKey || auth["OPENAI_API_KEY"] != "sk-proj-first-0001" {
+		t.Fatalf("expected an API-key document, got %s (%v)", raw, err)
+	}
+	if _, err := os.Stat(paths.AuthFile); !os.IsNotExist(err) {
+		t.Fatalf("expected auth.json untouched, got %v", err)
+	}
+
+	if _, err := AddKey("ci/bot", "sk-proj-second-0002", false, paths, false); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected ErrExists without overwrite, got %v", err)
+	}
+
+	// Replacing the active profile's key installs it too, so switching away can't sync the old one back.
+	if err := Use("ci/bot", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	if _, err := AddKey("ci/bot", "sk-proj-second-0002", true, paths, false); err != nil {
+		t.Fatalf("add-key --force failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(paths.AuthFile); !strings.Contains(string(raw), "sk-proj-second-0002") {
+		t.Fatalf("expected new key installed, got %s", raw)
+	}
+
+	if got := model.MaskKey("sk-proj-second-0002"); got != "sk-proj-…0002" {
+		t.Fatalf("unexpected mask %q", got)
+	}
+}
+
+func TestLoginCapturesIsolatedAuth(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"OPENAI_API_KEY":"sk-work"}`), 0600)
+	if err := Use("work", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	// Codex refreshed the active login in place; login must sync it first.
+	os.WriteFile(paths.AuthFile, []byte(`{"OPENAI_API_KEY":"sk-work","last_refresh":"2026-01-01T00:00:00Z"}`), 0600)
+
+	// A dry run plans the sync-back and the save without running the command.
+	plan, err := Login("personal", LoginOptions{Command: []string{"false"}, DryRun: true}, paths)
+	if err != nil || len(plan.Steps) != 2 || plan.Steps[0].Path != profilePath(paths, "work") || plan.Steps[1].Path != profilePath(paths, "personal") {
+		t.Fatalf("expected a sync-back and a save planned, got %+v (%v)", plan, err)
+	}
+
+	fake := []string{"sh", "-c", `test ! -e "$CODEX_HOME/auth.json" && printf '{"OPENAI_API_KEY":"%s"}' "$1" > "$CODEX_HOME/auth.json"`, "fake-login"}
+	if _, err := Login("personal", LoginOptions{Command: fake, Args: []string{"sk-personal"}}, paths); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(profilePath(paths, "personal")); string(raw) != `{"OPENAI_API_KEY":"sk-personal"}` {
+		t.Fatalf("expected login captured, got %q", raw)
+	}
+	if raw, _ := os.ReadFile(profilePath(paths, "work")); !strings.Contains(string(raw), "last_refresh") {
+		t.Fatalf("expected active profile synced before login, got %q", raw)
+	}
+	if raw, _ := os.ReadFile(paths.AuthFile); !strings.Contains(string(raw), "sk-work") {
+		t.Fatalf("expected auth.json untouched, got %q", raw)
+	}
+
+	// A saved profile is only replaced on request, so a typo can't clobber another account.
+	if _, err := Login("personal", LoginOptions{Command: fake, Args: []string{"sk-other"}}, paths); !errors.Is(err, ErrExists) {
+		t.Fatalf("expected login over an existing profile to be refused, got %v", err)
+	}
+	if raw, _ := os.ReadFile(profilePath(paths, "personal")); string(raw) != `{"OPENAI_API_KEY":"sk-personal"}` {
+		t.Fatalf("expected the existing profile kept, got %q", raw)
+	}
+	if _, err := Login("personal", LoginOptions{Command: fake, Args: []string{"sk-other"}, Overwrite: true}, paths); err != nil {
+		t.Fatalf("login with overwrite failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(profilePath(paths, "personal")); string(raw) != `{"OPENAI_API_KEY":"sk-other"}` {
+		t.Fatalf("expected the profile replaced, got %q", raw)
+	}
+
+	// A login command that writes the real auth.json is undone.
+	rogue := []string{"sh", "-c", `printf '{"OPENAI_API_KEY":"sk-rogue"}' | tee "$CODEX_HOME/auth.json" > "$1"`, "fake-login", paths.AuthFile}
+	if _, err := Login("rogue", LoginOptions{Command: rogue}, paths); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if raw, _ := os.ReadFile(paths.AuthFile); !strings.Contains(string(raw), "sk-work") {
+		t.Fatalf("expected auth.json restored, got %q", raw)
+	}
+
+	if _, err := Login("broken", LoginOptions{Command: []string{"true"}}, paths); err == nil {
+		t.Fatalf("expected a login without auth.json to fail")
+	}
+	if _, err := os.Stat(profilePath(paths, "broken")); !os.IsNotExist(err) {
+		t.Fatalf("expected no profile for a failed login, got %v", err)
+	}
+}
+
+func TestPolicyBlocksAccountsOutsideTheirDirectories(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.PolicyFile = filepath.Join(paths.CodexDir, "policy.json")
+	paths.EventsFile = filepath.Join(paths.CodexDir, ".codex-mp-events.jsonl")
+	repo := filepath.Join(paths.CodexDir, "src", "acme")
+	os.MkdirAll(filepath.Join(repo, "sub"), 0700)
+
+	work := `{"tokens":{"id_token":"` + fakeJWT(`{"email":"dev@Acme.com"}`) + `"}}`
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(work), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "personal.json"), []byte(`{"OPENAI_API_KEY":"sk-me"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "bot.json"), []byte(`{"OPENAI_API_KEY":"sk-bot"}`), 0600)
+	if err := SetTags("bot", []string{"ci"}, paths); err != nil {
+		t.Fatalf("set tags failed: %v", err)
+	}
+
+	if d, err := CheckPolicy("personal", repo, paths); err != nil || d.Decision != PolicyNone {
+		t.Fatalf("expected no decision without a policy file, got %+v (%v)", d, err)
+	}
+	policy := `{"rules":[
+		{"dir":"` + repo + `","emails":["*@acme.com"],"tags":["ci"]},
+		{"host":"*","tags":["approved"],"mode":"warn"}
+	]}`
+	os.WriteFile(paths.PolicyFile, []byte(policy), 0600)
+
+	for name, want := range map[string]string{"work": PolicyWarn, "bot": PolicyWarn, "personal": PolicyBlock} {
+		d, err := CheckPolicy(name, filepath.Join(repo, "sub"), paths)
+		if err != nil || d.Decision != want {
+			t.Fatalf("%s: expected %s, got %+v (%v)", name, want, d, err)
+		}
+	}
+	if d, _ := CheckPolicy("personal", paths.ProfilesDir, paths); d.Decision != PolicyWarn || len(d.Violations) != 1 {
+		t.Fatalf("expected only the host rule outside the repo, got %+v", d)
+	}
+
+	d, _ := CheckPolicy("personal", repo, paths)
+	if err := RecordPolicyDecision(d, "use", paths); err != nil {
+		t.Fatalf("record failed: %v", err)
+	}
+	events := openTail(paths.EventsFile, true).drain()
+	last := events[len(events)-1]
+	if last.Type != EventPolicy || last.Profile != "personal" || !strings.HasPrefix(last.Detail, "block use: ") {
+		t.Fatalf("expected the decision in the journal, got %+v", events)
+	}
+}
+
+func TestSwitchesEnforcePolicy(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.PolicyFile = filepath.Join(paths.CodexDir, "policy.json")
+	paths.EventsFile = filepath.Join(paths.CodexDir, ".codex-mp-events.jsonl")
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"OPENAI_API_KEY":"sk-work"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "home.json"), []byte(`{"OPENAI_API_KEY":"sk-home"}`), 0600)
+	if err := SetTags("work", []string{"approved"}, paths); err != nil {
+		t.Fatalf("set tags failed: %v", err)
+	}
+	os.WriteFile(paths.PolicyFile, []byte(`{"rules":[{"host":"*","tags":["approved"]}]}`), 0600)
+
+	if err := Use("home", paths); !errors.Is(err, ErrPolicyBlocked) {
+		t.Fatalf("expected use to be blocked, got %v", err)
+	}
+	ops := []Operation{{Op: OpUse, Name: "work"}, {Op: OpUse, Name: "home"}}
+	if _, err := Batch(ops, paths, true); !errors.Is(err, ErrPolicyBlocked) {
+		t.Fatalf("expected the dry-run batch to be blocked, got %v", err)
+	}
+	results, err := Batch(ops, paths, false)
+	if !errors.Is(err, ErrPolicyBlocked) || results[0].Status != BatchRolledBack {
+		t.Fatalf("expected the batch to be blocked and rolled back, got %+v (%v)", results, err)
+	}
+	if _, err := os.Stat(paths.AuthFile); !os.IsNotExist(err) {
+		t.Fatalf("expected blocked switches to leave auth.json alone")
+	}
+
+	var decisions []string
+	for _, ev := range openTail(paths.EventsFile, true).drain() {
+		if ev.Type == EventPolicy {
+			decisions = append(decisions, strings.SplitN(ev.Detail, ":", 2)[0]+" "+ev.Profile)
+		}
+	}
+	// The dry run journals nothing, and the rolled-back allowed switch is not journaled.
+	if want := "block use home,block use home"; strings.Join(decisions, ",") != want {
+		t.Fatalf("expected decisions %s, got %v", want, decisions)
+	}
+
+	// Undo and a batch rollback put an earlier auth.json back, which is a switch too.
+	paths.UndoDir = filepath.Join(paths.CodexDir, ".codex-mp-undo")
+	os.Rename(paths.PolicyFile, paths.PolicyFile+".off")
+	if err := Use("home", paths); err != nil {
+		t.Fatalf("use without a policy failed: %v", err)
+	}
+	if err := Use("work", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	os.Rename(paths.PolicyFile+".off", paths.PolicyFile)
+	if _, _, err := Undo(paths, false); !errors.Is(err, ErrPolicyBlocked) {
+		t.Fatalf("expected undoing back to home to be blocked, got %v", err)
+	}
+	if auth, _ := os.ReadFile(paths.AuthFile); string(auth) != `{"OPENAI_API_KEY":"sk-work"}` {
+		t.Fatalf("expected the blocked undo to leave work installed, got %q", auth)
+	}
+
+	os.Rename(paths.PolicyFile, paths.PolicyFile+".off")
+	if _, _, err := Undo(paths, false); err != nil {
+		t.Fatalf("undo without a policy failed: %v", err)
+	}
+	os.Rename(paths.PolicyFile+".off", paths.PolicyFile)
+	ops = []Operation{{Op: OpUse, Name: "work"}, {Op: OpRename, From: "missing", To: "x"}}
+	if _, err := Batch(ops, paths, false); !errors.Is(err, ErrPolicyBlocked) {
+		t.Fatalf("expected the rollback back to home to report the block, got %v", err)
+	}
+}
+
+func TestUsageAttributesSessionsToActiveProfile(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.EventsFile = filepath.Join(paths.CodexDir, ".codex-mp-events.jsonl")
+	journal := `{"type":"switched","time":"2026-03-01T09:00:00Z","target":"default","profile":"work"}
+{"type":"switched","time":"2026-03-01T09:00:00Z","target":"other","profile":"elsewhere"}
+{"type":"switched","time":"2026-03-01T18:00:00Z","target":"default","profile":"home","from":"work"}
+{"type":"renamed","time":"2026-03-02T08:00:00Z","target":"default","profile":"personal","from":"home"}
+{"type":"deleted","time":"2026-03-02T10:00:00Z","target":"default","profile":"personal"}
+{"type":"restored","time":"2026-03-02T11:00:00Z","target":"default","profile":"personal"}
+{"type":"switched","time":"2026-03-02T12:00:00Z","target":"default","profile":"work","from":"personal"}
+{"type":"undone","time":"2026-03-02T13:00:00Z","target":"default","profile":"personal","detail":"use work"}
+`
+	os.WriteFile(paths.EventsFile, []byte(journal), 0600)
+
+	day := filepath.Join(paths.CodexDir, "sessions", "2026", "03", "01")
+	os.MkdirAll(day, 0700)
+	session := func(file, start, end string, total int) {
+		lines := `{"timestamp":"` + start + `","type":"session_meta","payload":{"id":"` + file + `"}}` + "\n"
+		if total > 0 {
+			lines += fmt.Sprintf(`{"timestamp":"%s","type":"event_msg","payload":{"type":"token_count","info":{"total_token_usage":{"input_tokens":%d,"output_tokens":1,"total_tokens":%d}}}}`+"\n", end, total-1, total)
+		}
+		lines += `{"timestamp":"` + end + `","type":"response_item","payload":{}}` + "\n"
+		os.WriteFile(filepath.Join(day, "rollout-"+file+".jsonl"), []byte(lines), 0600)
+	}
+	session("a", "2026-03-01T08:00:00Z", "2026-03-01T08:10:00Z", 0)
+	session("b", "2026-03-01T10:00:00Z", "2026-03-01T11:00:00Z", 100)
+	session("c", "2026-03-01T12:00:00Z", "2026-03-01T12:30:00Z", 50)
+	session("d", "2026-03-02T09:00:00Z", "2026-03-02T09:01:00Z", 10)
+	session("e", "2026-03-02T10:30:00Z", "2026-03-02T10:31:00Z", 0) // personal deleted
+	session("f", "2026-03-02T11:30:00Z", "2026-03-02T11:31:00Z", 0) // and restored
+	session("g", "2026-03-02T13:30:00Z", "2026-03-02T13:31:00Z", 0) // switch to work undone
+
+	report, err := Usage(paths, time.Time{}, "")
+	if err != nil || len(report.Sessions) != 7 {
+		t.Fatalf("expected 7 sessions, got %+v (%v)", report.Sessions, err)
+	}
+	want := []ProfileUsage{
+		{Profile: UnknownProfile, Sessions: 2, Seconds: 660},
+		{Profile: "personal", Sessions: 3, Seconds: 180, Tokens: TokenUsage{Input: 9, Output: 1, Total: 10}},
+		{Profile: "work", Sessions: 2, Seconds: 5400, Tokens: TokenUsage{Input: 148, Output: 2, Total: 150}},
+	}
+	if fmt.Sprint(report.Profiles) != fmt.Sprint(want) {
+		t.Fatalf("expected %+v, got %+v", want, report.Profiles)
+	}
+	// Session a started before the journal's oldest event, of any target.
+	if start, _ := time.Parse(time.RFC3339, "2026-03-01T09:00:00Z"); report.BeforeJournal != 1 || !report.JournalStart.Equal(start) {
+		t.Fatalf("expected one session before the journal start, got %d before %v", report.BeforeJournal, report.JournalStart)
+	}
+
+	since, _ := time.Parse(time.RFC3339, "2026-03-01T11:00:00Z")
+	report, err = Usage(paths, since, "w*")
+	if err != nil || len(report.Profiles) != 1 || report.Profiles[0].Sessions != 1 || report.Profiles[0].Tokens.Total != 50 || report.BeforeJournal != 0 {
+		t.Fatalf("expected one work session after since, got %+v (%v)", report, err)
+	}
+}
+
+func TestScheduleSelectsFirstMatchingRule(t *testing.T) {
+	paths, cleanup := setupTest(t)
+	defer cleanup()
+	paths.ConfigFile = filepath.Join(paths.CodexDir, "config.json")
+	cfg := `{"schedule":[
+		{"profile":"acme","days":["mon-fri"],"from":"09:00","to":"17:30"},
+		{"profile":"late","days":["fri"],"from":"22:00","to":"02:00"},
+		{"profile":"batch","cron":"*/15 3 * * sun"},
+		{"profile":"personal"}
+	]}`
+	os.WriteFile(paths.ConfigFile, []byte(cfg), 0600)
+	if err := ValidateSchedule(paths); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+
+	for at, want := range map[string]string{
+		"2026-03-06T09:00:00Z": "acme",     // Friday
+		"2026-03-06T17:30:00Z": "personal", // window end is exclusive
+		"2026-03-06T23:00:00Z": "late",
+		"2026-03-07T01:59:00Z": "late", // Saturday, but the window opened on Friday
+		"2026-03-08T01:00:00Z": "personal",
+		"2026-03-08T03:45:00Z": "batch",
+		"2026-03-08T03:46:00Z": "personal",
+	} {
+		tm, _ := time.Parse(time.RFC3339, at)
+		if got, _, err := Scheduled(paths, tm.In(time.UTC)); err != nil || got != want {
+			t.Fatalf("%s: expected %s, got %s (%v)", at, want, got, err)
+		}
+	}
+
+	os.WriteFile(paths.ConfigFile, []byte(`{"schedule":[{"profile":"x","cron":"* 25 * * *"}]}`), 0600)
+	if err := ValidateSchedule(paths); err == nil {
+		t.Fatalf("expected an out-of-range cron hour to be rejected")
+	}
+}
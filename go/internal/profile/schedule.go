@@ -0,0 +1,211 @@
+package profile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+)
+
+var dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// Scheduled returns the profile the schedule in the config file selects at t, and the
+// 1-based number of the rule that matched, or "" and 0 if none does.
+func Scheduled(paths config.Paths, t time.Time) (string, int, error) {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return "", 0, err
+	}
+	for i, rule := range cfg.Schedule {
+		ok, err := scheduleMatches(rule, t)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid schedule rule %d: %w", i+1, err)
+		}
+		if ok {
+			return rule.Profile, i + 1, nil
+		}
+	}
+	return "", 0, nil
+}
+
+// ValidateSchedule checks every rule in the config file, so mistakes surface before
+// the time they would apply.
+func ValidateSchedule(paths config.Paths) error {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return err
+	}
+	for i, rule := range cfg.Schedule {
+		if err := ValidateName(rule.Profile); err != nil {
+			return fmt.Errorf("invalid schedule rule %d: %w", i+1, err)
+		}
+		if _, err := scheduleMatches(rule, time.Time{}); err != nil {
+			return fmt.Errorf("invalid schedule rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func scheduleMatches(rule config.ScheduleRule, t time.Time) (bool, error) {
+	if rule.Profile == "" {
+		return false, fmt.Errorf("missing profile")
+	}
+	if rule.Cron != "" {
+		if len(rule.Days) > 0 || rule.From != "" || rule.To != "" {
+			return false, fmt.Errorf("cron can't be combined with days, from or to")
+		}
+		return cronMatches(rule.Cron, t)
+	}
+
+	onDay := func(time.Time) bool { return true }
+	if len(rule.Days) > 0 {
+		set := map[int]bool{}
+		for _, d := range rule.Days {
+			if err := addDays(set, d); err != nil {
+				return false, err
+			}
+		}
+		onDay = func(d time.Time) bool { return set[int(d.Weekday())] }
+	}
+	if rule.From == "" && rule.To == "" {
+		return onDay(t), nil
+	}
+
+	from, err := clockMinutes(rule.From, 0)
+	if err != nil {
+		return false, err
+	}
+	to, err := clockMinutes(rule.To, 24*60)
+	if err != nil {
+		return false, err
+	}
+	now := t.Hour()*60 + t.Minute()
+	switch {
+	case from <= to:
+		return onDay(t) && now >= from && now < to, nil
+	case now >= from:
+		return onDay(t), nil
+	case now < to:
+		// Past midnight in an overnight window, which belongs to the day it started.
+		return onDay(t.AddDate(0, 0, -1)), nil
+	}
+	return false, nil
+}
+
+// addDays adds a day name ("mon") or range ("mon-fri", "fri-mon") to set.
+func addDays(set map[int]bool, spec string) error {
+	first, last, isRange := strings.Cut(strings.ToLower(spec), "-")
+	a, ok := dayNames[first]
+	if !ok {
+		return fmt.Errorf("unknown day: %s (use mon, tue, ... or a range like mon-fri)", spec)
+	}
+	b := a
+	if isRange {
+		if b, ok = dayNames[last]; !ok {
+			return fmt.Errorf("unknown day: %s (use mon, tue, ... or a range like mon-fri)", spec)
+		}
+	}
+	for d := a; ; d = (d + 1) % 7 {
+		set[d] = true
+		if d == b {
+			return nil
+		}
+	}
+}
+
+// clockMinutes parses "HH:MM" into minutes after midnight; empty yields def.
+func clockMinutes(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		if s == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, fmt.Errorf("invalid time: %s (use HH:MM)", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// cronMatches reports whether the minute of t matches a five-field cron expression:
+// minute, hour, day of month, month and day of week. As in cron, when both day
+// fields are restricted either may match.
+func cronMatches(expr string, t time.Time) (bool, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return false, fmt.Errorf("invalid cron expression %q: want 5 fields", expr)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	values := [5]int{t.Minute(), t.Hour(), t.Day(), int(t.Month()), int(t.Weekday())}
+	var match [5]bool
+	for i, field := range fields {
+		set, err := cronField(field, bounds[i][0], bounds[i][1], i == 4)
+		if err != nil {
+			return false, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		match[i] = set[values[i]] || (i == 4 && values[i] == 0 && set[7])
+	}
+
+	days := match[2] && match[4]
+	if fields[2] != "*" && fields[4] != "*" {
+		days = match[2] || match[4]
+	}
+	return match[0] && match[1] && match[3] && days, nil
+}
+
+// cronField parses one cron field: *, a value, a range a-b, each optionally with a
+// /step, separated by commas. Day-of-week fields also take day names.
+func cronField(field string, lowest, highest int, weekday bool) (map[int]bool, error) {
+	value := func(s string) (int, error) {
+		if weekday {
+			if d, ok := dayNames[strings.ToLower(s)]; ok {
+				return d, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lowest || n > highest {
+			return 0, fmt.Errorf("bad value %q (allowed %d-%d)", s, lowest, highest)
+		}
+		return n, nil
+	}
+
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("bad step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := lowest, highest
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = value(first); err != nil {
+				return nil, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = value(last); err != nil {
+					return nil, err
+				}
+			} else if hasStep {
+				hi = highest
+			}
+			if hi < lo {
+				return nil, fmt.Errorf("bad range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
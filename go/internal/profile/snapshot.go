@@ -0,0 +1,150 @@
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+)
+
+// snapshot is a private copy of everything a mutation can change: the profiles, auth.json,
+// the markers, the cache, the metadata and the config file. Its Paths point at the copies,
+// so operations can also run against it as a sandbox.
+type snapshot struct {
+	config.Paths
+	dir string
+}
+
+// takeSnapshot copies the store into a temporary directory next to it.
+// Callers must hold the lock and call discard when done.
+func takeSnapshot(paths config.Paths) (*snapshot, error) {
+	dir, err := os.MkdirTemp(paths.DataDir, ".codex-mp-snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	snap := &snapshot{Paths: paths, dir: dir}
+	snap.CodexDir = dir
+	snap.AuthFile = filepath.Join(dir, "auth.json")
+	snap.DataDir = dir
+	snap.StateDir = dir
+	snap.ProfilesDir = filepath.Join(dir, "profiles")
+	snap.ActiveFile = filepath.Join(dir, "active")
+	snap.PreviousFile = filepath.Join(dir, "previous")
+	snap.CacheFile = filepath.Join(dir, "cache.json")
+	snap.MetaFile = filepath.Join(dir, "meta.json")
+	snap.ConfigFile = filepath.Join(dir, "config.json")
+	snap.UndoDir = ""
+	snap.EventsFile = ""
+	snap.SyncDir = ""
+
+	if err := os.MkdirAll(snap.ProfilesDir, 0700); err != nil {
+		snap.discard()
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if err := mirrorStore(paths, snap.Paths, fs.WriteOptions{}); err != nil {
+		snap.discard()
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	return snap, nil
+}
+
+// restore puts the live store back to the snapshotted state. Files that did not change
+// are left alone, so symlinked profiles survive a rollback that didn't touch them.
+func (s *snapshot) restore(paths config.Paths) error {
+	opts, err := writeOptions(s.Paths)
+	if err != nil {
+		return err
+	}
+	if err := mirrorStore(s.Paths, paths, opts); err != nil {
+		return fmt.Errorf("failed to roll back: %w", err)
+	}
+	return nil
+}
+
+// discard shreds the snapshot, which holds copies of auth.json and every profile,
+// so a batch that purges a profile leaves no copy of it behind.
+func (s *snapshot) discard() {
+	if err := fs.ShredTree(s.dir); err != nil {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// mirrorStore makes the store at dst match src: changed files are copied, and files
+// missing from src are removed from dst. opts applies to auth.json and profiles in dst.
+func mirrorStore(src, dst config.Paths, opts fs.WriteOptions) error {
+	files := [][2]string{
+		{src.AuthFile, dst.AuthFile},
+		{src.ActiveFile, dst.ActiveFile},
+		{src.PreviousFile, dst.PreviousFile},
+		{src.CacheFile, dst.CacheFile},
+		{src.MetaFile, dst.MetaFile},
+		{src.ConfigFile, dst.ConfigFile},
+	}
+	for i, pair := range files {
+		if pair[0] == "" || pair[1] == "" {
+			continue
+		}
+		fileOpts := fs.WriteOptions{}
+		if i == 0 {
+			fileOpts = opts
+		}
+		if err := mirrorFile(pair[0], pair[1], fileOpts); err != nil {
+			return err
+		}
+	}
+
+	srcNames, err := profileNames(src.ProfilesDir)
+	if err != nil {
+		return err
+	}
+	dstNames, err := profileNames(dst.ProfilesDir)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{}
+	for _, name := range srcNames {
+		keep[name] = true
+		if err := mirrorFile(profilePath(src, name), profilePath(dst, name), opts); err != nil {
+			return err
+		}
+	}
+	for _, name := range dstNames {
+		if keep[name] {
+			continue
+		}
+		if err := os.Remove(profilePath(dst, name)); err != nil {
+			return fmt.Errorf("failed to remove profile %s: %w", name, err)
+		}
+		if err := pruneGroups(dst, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mirrorFile copies src over dst unless they already hold the same bytes, and removes
+// dst when src does not exist.
+func mirrorFile(src, dst string, opts fs.WriteOptions) error {
+	want, err := os.ReadFile(src)
+	if os.IsNotExist(err) {
+		if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", dst, err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+
+	if have, err := os.ReadFile(dst); err == nil && bytes.Equal(have, want) {
+		return nil
+	}
+	if err := fs.AtomicWriteFile(dst, want, 0600, opts); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,604 @@
+package profile
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+	"github.com/BigCactusLabs/codex-multipass/internal/model"
+)
+
+// The sync store is a git repository holding one encrypted record per profile. Only
+// the manifest is plaintext, and it carries no secrets; record files are named by a
+// keyed hash, so not even profile names are readable without the key.
+const (
+	syncBranch     = "main"
+	syncManifest   = "codex-mp-sync.json"
+	syncRecordsDir = "profiles"
+	syncMagic      = "CMPS1"
+	syncKeySize    = 32
+)
+
+// syncManifestFile identifies a store and the key it is encrypted with.
+type syncManifestFile struct {
+	Version int    `json:"version"`
+	KeyID   string `json:"key_id"`
+}
+
+// syncRecord is one profile in the store. Stamp orders versions of a profile: the
+// last_refresh of its auth document, or when it was last written if it has none.
+// A deleted profile leaves a tombstone, so the deletion reaches other machines.
+type syncRecord struct {
+	Name    string    `json:"name"`
+	Auth    []byte    `json:"auth,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Stamp   time.Time `json:"stamp"`
+	Deleted bool      `json:"deleted,omitempty"`
+}
+
+// syncState remembers the stamp of every profile in the store as of the last push or
+// pull, to tell a profile deleted here from one that was never pulled.
+type syncState struct {
+	Remote string               `json:"remote"`
+	Synced map[string]time.Time `json:"synced"`
+}
+
+// SyncReport lists the profiles a push or pull changed.
+type SyncReport struct {
+	Remote  string   `json:"remote"`
+	Pushed  []string `json:"pushed,omitempty"`
+	Pulled  []string `json:"pulled,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+}
+
+// SyncKeyFile returns where the key of the sync store is kept. Copy it to another
+// machine to sync that machine with the same store.
+func SyncKeyFile(paths config.Paths) string {
+	return filepath.Join(paths.SyncDir, "key")
+}
+
+func syncRepoDir(paths config.Paths) string   { return filepath.Join(paths.SyncDir, "repo") }
+func syncStateFile(paths config.Paths) string { return filepath.Join(paths.SyncDir, "state.json") }
+
+// git runs a git command in dir. Commits are made as codex-mp, without signing, so
+// sync works without a git identity.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=codex-mp", "-c", "user.email=codex-mp@localhost", "-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func syncKeyID(key []byte) string {
+	sum := sha256.Sum256(append([]byte("codex-mp sync key\n"), key...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ReadSyncKey decodes a key file written by `sync init`.
+func ReadSyncKey(file string) ([]byte, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(key) != syncKeySize {
+		return nil, fmt.Errorf("invalid sync key in %s", file)
+	}
+	return key, nil
+}
+
+// recordFile names the record of a profile by a keyed hash of its name.
+func recordFile(key []byte, name string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	return hex.EncodeToString(mac.Sum(nil)[:16]) + ".bin"
+}
+
+// sealRecord encrypts rec with AES-256-GCM, binding it to its file name so records
+// can't be swapped between profiles.
+func sealRecord(key []byte, file string, rec syncRecord) ([]byte, error) {
+	plain, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sync record: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out := append([]byte(syncMagic), nonce...)
+	return gcm.Seal(out, nonce, plain, []byte(file)), nil
+}
+
+func openRecord(key []byte, file string, data []byte) (syncRecord, error) {
+	var rec syncRecord
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return rec, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return rec, err
+	}
+	if !bytes.HasPrefix(data, []byte(syncMagic)) || len(data) < len(syncMagic)+gcm.NonceSize() {
+		return rec, fmt.Errorf("invalid sync record %s", file)
+	}
+	data = data[len(syncMagic):]
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(file))
+	if err != nil {
+		return rec, fmt.Errorf("failed to decrypt sync record %s (wrong key?)", file)
+	}
+	if err := json.Unmarshal(plain, &rec); err != nil {
+		return rec, fmt.Errorf("invalid sync record %s: %w", file, err)
+	}
+	if err := ValidateName(rec.Name); err != nil || recordFile(key, rec.Name) != file {
+		return rec, fmt.Errorf("invalid sync record %s", file)
+	}
+	return rec, nil
+}
+
+// SyncInit clones the git repository at remote as the sync store. A new store is
+// encrypted with keyFile if given, or a freshly generated key; joining an existing
+// store requires keyFile, copied from a machine that already syncs with it.
+func SyncInit(remote, keyFile string, paths config.Paths) error {
+	if paths.SyncDir == "" {
+		return fmt.Errorf("sync is not available for this storage layout")
+	}
+	if _, err := os.Stat(syncRepoDir(paths)); err == nil {
+		return fmt.Errorf("sync is already set up in %s (remove it to start over)", paths.SyncDir)
+	}
+	if abs, err := filepath.Abs(remote); err == nil {
+		if _, err := os.Stat(abs); err == nil {
+			remote = abs
+		}
+	}
+
+	var key []byte
+	if keyFile != "" {
+		var err error
+		if key, err = ReadSyncKey(keyFile); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(paths.SyncDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", paths.SyncDir, err)
+	}
+	if err := os.Chmod(paths.SyncDir, 0700); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", paths.SyncDir, err)
+	}
+	repo := syncRepoDir(paths)
+	err := func() error {
+		if _, err := git(paths.SyncDir, "clone", "--quiet", remote, repo); err != nil {
+			return err
+		}
+		if err := fetchStore(repo); err != nil {
+			return err
+		}
+		raw, err := os.ReadFile(filepath.Join(repo, syncManifest))
+		switch {
+		case err == nil:
+			var manifest syncManifestFile
+			if err := json.Unmarshal(raw, &manifest); err != nil {
+				return fmt.Errorf("invalid sync manifest: %w", err)
+			}
+			if key == nil {
+				return fmt.Errorf("%s already holds a sync store; pass the key file from a machine that uses it (--key-file)", remote)
+			}
+			if manifest.KeyID != syncKeyID(key) {
+				return fmt.Errorf("the key does not match the sync store at %s", remote)
+			}
+		case errors.Is(err, os.ErrNotExist):
+			if key == nil {
+				key = make([]byte, syncKeySize)
+				if _, err := rand.Read(key); err != nil {
+					return fmt.Errorf("failed to generate sync key: %w", err)
+				}
+			}
+			if err := fs.AtomicWriteJSON(filepath.Join(repo, syncManifest), syncManifestFile{Version: 1, KeyID: syncKeyID(key)}, 0644); err != nil {
+				return fmt.Errorf("failed to write sync manifest: %w", err)
+			}
+			if _, err := git(repo, "add", "-A"); err != nil {
+				return err
+			}
+			if _, err := git(repo, "commit", "--quiet", "-m", "codex-mp sync store"); err != nil {
+				return err
+			}
+			if _, err := git(repo, "push", "--quiet", "origin", "HEAD:"+syncBranch); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("failed to read sync manifest: %w", err)
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(key) + "\n"
+		if err := fs.AtomicWriteFile(SyncKeyFile(paths), []byte(encoded), 0600); err != nil {
+			return fmt.Errorf("failed to write sync key: %w", err)
+		}
+		return fs.AtomicWriteJSON(syncStateFile(paths), syncState{Remote: remote, Synced: map[string]time.Time{}}, 0600)
+	}()
+	if err != nil {
+		os.RemoveAll(paths.SyncDir)
+	}
+	return err
+}
+
+// fetchStore makes the clone match the remote branch, dropping anything left over
+// from an interrupted push. Conflicts are resolved per record, never by git.
+func fetchStore(repo string) error {
+	if _, err := git(repo, "fetch", "--quiet", "origin"); err != nil {
+		return err
+	}
+	if _, err := git(repo, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+syncBranch); err != nil {
+		// An empty store; start the branch locally.
+		_, err := git(repo, "symbolic-ref", "HEAD", "refs/heads/"+syncBranch)
+		return err
+	}
+	if _, err := git(repo, "checkout", "--quiet", "--force", "-B", syncBranch, "origin/"+syncBranch); err != nil {
+		return err
+	}
+	_, err := git(repo, "clean", "--quiet", "-fdx")
+	return err
+}
+
+// openStore loads the key and sync state and brings the clone up to date.
+// Callers must hold the lock.
+func openStore(paths config.Paths) ([]byte, syncState, map[string]syncRecord, error) {
+	var state syncState
+	if paths.SyncDir == "" {
+		return nil, state, nil, fmt.Errorf("sync is not set up (run codex-mp sync init <repo>)")
+	}
+	if _, err := os.Stat(syncRepoDir(paths)); os.IsNotExist(err) {
+		return nil, state, nil, fmt.Errorf("sync is not set up (run codex-mp sync init <repo>)")
+	}
+	key, err := ReadSyncKey(SyncKeyFile(paths))
+	if err != nil {
+		return nil, state, nil, err
+	}
+	raw, err := os.ReadFile(syncStateFile(paths))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, state, nil, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &state); err != nil {
+			return nil, state, nil, fmt.Errorf("invalid sync state: %w", err)
+		}
+	}
+	if state.Synced == nil {
+		state.Synced = map[string]time.Time{}
+	}
+
+	repo := syncRepoDir(paths)
+	if err := fetchStore(repo); err != nil {
+		return nil, state, nil, err
+	}
+	var manifest syncManifestFile
+	if raw, err := os.ReadFile(filepath.Join(repo, syncManifest)); err != nil {
+		return nil, state, nil, fmt.Errorf("failed to read sync manifest: %w", err)
+	} else if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, state, nil, fmt.Errorf("invalid sync manifest: %w", err)
+	}
+	if manifest.KeyID != syncKeyID(key) {
+		return nil, state, nil, fmt.Errorf("the sync key does not match the store at %s", state.Remote)
+	}
+
+	records := map[string]syncRecord{}
+	entries, err := os.ReadDir(filepath.Join(repo, syncRecordsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, state, nil, fmt.Errorf("failed to read sync store: %w", err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(repo, syncRecordsDir, e.Name()))
+		if err != nil {
+			return nil, state, nil, fmt.Errorf("failed to read sync record: %w", err)
+		}
+		rec, err := openRecord(key, e.Name(), data)
+		if err != nil {
+			return nil, state, nil, err
+		}
+		records[rec.Name] = rec
+	}
+	return key, state, records, nil
+}
+
+// localRecords reads every saved profile as a sync record. The active profile is
+// taken from auth.json while it still belongs to the same account, so tokens Codex
+// refreshed in place are what gets synced.
+func localRecords(paths config.Paths) (map[string]syncRecord, error) {
+	names, err := profileNames(paths.ProfilesDir)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := loadMeta(paths)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := currentProfile(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	records := map[string]syncRecord{}
+	for _, name := range names {
+		file := profilePath(paths, name)
+		if name == cur.Name && cur.LoggedIn && !cur.Drift {
+			file = paths.AuthFile
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read profile %s: %w", name, err)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read profile %s: %w", name, err)
+		}
+		rec := syncRecord{Name: name, Auth: raw, Tags: meta[name].Tags, Stamp: info.ModTime().UTC()}
+		if auth, err := model.ParseAuth(raw); err == nil {
+			if t := auth.Identity().LastRefresh; t != nil {
+				rec.Stamp = t.UTC()
+			}
+		}
+		records[name] = rec
+	}
+	return records, nil
+}
+
+// sameRecord reports whether two records hold the same profile contents and tags.
+func sameRecord(a, b syncRecord) bool {
+	return a.Deleted == b.Deleted && bytes.Equal(a.Auth, b.Auth) && slices.Equal(a.Tags, b.Tags)
+}
+
+// saveState records the stamps of the live records now in the store.
+func saveState(paths config.Paths, state syncState, records map[string]syncRecord) error {
+	state.Synced = map[string]time.Time{}
+	for name, rec := range records {
+		if !rec.Deleted {
+			state.Synced[name] = rec.Stamp
+		}
+	}
+	if err := fs.AtomicWriteJSON(syncStateFile(paths), state, 0600); err != nil {
+		return fmt.Errorf("failed to write sync state: %w", err)
+	}
+	return nil
+}
+
+// SyncPush encrypts the local profiles into the store and pushes it. A profile is
+// uploaded when the store lacks it or holds an older version of it, and a profile
+// deleted here since the last sync is deleted from the store. Nothing is ever
+// committed in plaintext.
+func SyncPush(paths config.Paths) (SyncReport, error) {
+	if err := EnsureInitialized(paths); err != nil {
+		return SyncReport{}, err
+	}
+	var report SyncReport
+	err := withLock(paths, func() error {
+		// Someone else may push between our fetch and push; start over from their
+		// state a few times before giving up.
+		var err error
+		for attempt := 0; attempt < 3; attempt++ {
+			report = SyncReport{}
+			var retry bool
+			if retry, err = syncPush(paths, &report); !retry {
+				return err
+			}
+		}
+		return err
+	})
+	return report, err
+}
+
+func syncPush(paths config.Paths, report *SyncReport) (bool, error) {
+	key, state, remote, err := openStore(paths)
+	if err != nil {
+		return false, err
+	}
+	report.Remote = state.Remote
+	local, err := localRecords(paths)
+	if err != nil {
+		return false, err
+	}
+
+	repo := syncRepoDir(paths)
+	write := func(rec syncRecord) error {
+		file := recordFile(key, rec.Name)
+		data, err := sealRecord(key, file, rec)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(repo, syncRecordsDir), 0700); err != nil {
+			return fmt.Errorf("failed to create %s: %w", syncRecordsDir, err)
+		}
+		if err := fs.AtomicWriteFile(filepath.Join(repo, syncRecordsDir, file), data, 0600); err != nil {
+			return fmt.Errorf("failed to write sync record: %w", err)
+		}
+		remote[rec.Name] = rec
+		return nil
+	}
+
+	for _, name := range sortedNames(local) {
+		rec, theirs := local[name], remote[name]
+		if _, ok := remote[name]; ok && (sameRecord(rec, theirs) || theirs.Stamp.After(rec.Stamp)) {
+			continue
+		}
+		if err := write(rec); err != nil {
+			return false, err
+		}
+		report.Pushed = append(report.Pushed, name)
+	}
+	for _, name := range sortedNames(remote) {
+		theirs := remote[name]
+		synced, known := state.Synced[name]
+		if _, ok := local[name]; ok || theirs.Deleted || !known || theirs.Stamp.After(synced) {
+			continue
+		}
+		if err := write(syncRecord{Name: name, Stamp: time.Now().UTC(), Deleted: true}); err != nil {
+			return false, err
+		}
+		report.Deleted = append(report.Deleted, name)
+	}
+
+	if len(report.Pushed)+len(report.Deleted) > 0 {
+		if _, err := git(repo, "add", "-A"); err != nil {
+			return false, err
+		}
+		msg := fmt.Sprintf("codex-mp sync: %d updated, %d deleted", len(report.Pushed), len(report.Deleted))
+		if _, err := git(repo, "commit", "--quiet", "-m", msg); err != nil {
+			return false, err
+		}
+		if _, err := git(repo, "push", "--quiet", "origin", "HEAD:"+syncBranch); err != nil {
+			return true, err
+		}
+	}
+	return false, saveState(paths, state, remote)
+}
+
+// SyncPull fetches the store and installs every profile it holds a newer version of,
+// including into auth.json if that profile is active. Profiles deleted elsewhere
+// since this machine last synced them are moved to the trash. The pull can be undone.
+func SyncPull(paths config.Paths) (SyncReport, error) {
+	if err := EnsureInitialized(paths); err != nil {
+		return SyncReport{}, err
+	}
+	var report SyncReport
+	err := withLock(paths, func() error {
+		_, state, remote, err := openStore(paths)
+		if err != nil {
+			return err
+		}
+		report.Remote = state.Remote
+		local, err := localRecords(paths)
+		if err != nil {
+			return err
+		}
+		active, err := readActiveProfile(paths)
+		if err != nil {
+			return err
+		}
+		cur, err := currentProfile(paths)
+		if err != nil {
+			return err
+		}
+		opts, err := writeOptions(paths)
+		if err != nil {
+			return err
+		}
+
+		plan := &Plan{Op: "sync pull"}
+		for _, name := range sortedNames(remote) {
+			if IsManaged(name, paths) {
+				continue
+			}
+			theirs := remote[name]
+			mine, have := local[name]
+			synced, known := state.Synced[name]
+			switch {
+			case theirs.Deleted:
+				if !have || mine.Stamp.After(theirs.Stamp) {
+					continue
+				}
+				if err := planDelete(plan, name, false, paths); err != nil {
+					return err
+				}
+				report.Deleted = append(report.Deleted, name)
+			case !have:
+				// Deleted here, and not changed elsewhere since; push will delete it.
+				if known && !theirs.Stamp.After(synced) {
+					continue
+				}
+				planPulled(plan, theirs, false, paths, opts)
+				report.Pulled = append(report.Pulled, name)
+			case sameRecord(mine, theirs) || mine.Stamp.After(theirs.Stamp):
+				continue
+			default:
+				planPulled(plan, theirs, name == active && cur.LoggedIn && !cur.Drift, paths, opts)
+				report.Pulled = append(report.Pulled, name)
+			}
+		}
+
+		if len(plan.Steps) > 0 {
+			if err := recordUndo(paths, Operation{Op: "sync", Name: "pull"}, plan.Steps); err != nil {
+				return err
+			}
+			if err := plan.execute(0); err != nil {
+				return err
+			}
+			journalEvents(paths, plan.events)
+		}
+		return saveState(paths, state, remote)
+	})
+	return report, err
+}
+
+// planPulled plans installing a record from the store as a profile, and into
+// auth.json too if install is set. The profile keeps the record's stamp as its
+// modification time, so an unchanged profile is not pushed back as newer.
+func planPulled(plan *Plan, rec syncRecord, install bool, paths config.Paths, opts fs.WriteOptions) {
+	file := profilePath(paths, rec.Name)
+	plan.add(Step{Action: StepWrite, Path: file, Mode: "0600", Detail: "pull " + rec.Name}, func() error {
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return fmt.Errorf("failed to create profile group: %w", err)
+		}
+		if err := fs.AtomicWriteFile(file, rec.Auth, 0600, opts); err != nil {
+			return fmt.Errorf("failed to write profile %s: %w", rec.Name, err)
+		}
+		return os.Chtimes(file, rec.Stamp, rec.Stamp)
+	})
+	if install {
+		plan.add(Step{Action: StepWrite, Path: paths.AuthFile, Mode: "0600", Detail: "install pulled " + rec.Name}, func() error {
+			if err := fs.AtomicWriteFile(paths.AuthFile, rec.Auth, 0600, opts); err != nil {
+				return fmt.Errorf("failed to write auth file: %w", err)
+			}
+			if err := os.Chtimes(paths.AuthFile, rec.Stamp, rec.Stamp); err != nil {
+				return err
+			}
+			return recordInstalled(paths, rec.Name)
+		})
+	}
+	tags := rec.Tags
+	planMeta(plan, paths, "tags of "+rec.Name, func(meta map[string]Meta) {
+		m := meta[rec.Name]
+		m.Tags = tags
+		if m.Tags == nil && m.LastUsed == nil {
+			delete(meta, rec.Name)
+			return
+		}
+		meta[rec.Name] = m
+	})
+	plan.emit(Event{Type: EventSynced, Profile: rec.Name, Detail: "pulled"})
+}
+
+func sortedNames(records map[string]syncRecord) []string {
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
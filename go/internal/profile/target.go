@@ -0,0 +1,39 @@
+package profile
+
+import (
+	"fmt"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+)
+
+// AddTarget adds or updates the target name, a Codex directory sharing the profile store.
+func AddTarget(name, dir string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpTargetAdd, Name: name, Dir: dir}, paths, false)
+	return err
+}
+
+func planAddTarget(plan *Plan, name, dir string, paths config.Paths) error {
+	return plan.updateConfig(paths, "target "+name+" → "+dir, func(cfg *config.Config) error {
+		if cfg.Targets == nil {
+			cfg.Targets = map[string]string{}
+		}
+		cfg.Targets[name] = dir
+		return nil
+	})
+}
+
+// RemoveTarget removes the target name. Its Codex directory is left alone.
+func RemoveTarget(name string, paths config.Paths) error {
+	_, err := Apply(Operation{Op: OpTargetRemove, Name: name}, paths, false)
+	return err
+}
+
+func planRemoveTarget(plan *Plan, name string, paths config.Paths) error {
+	return plan.updateConfig(paths, "remove target "+name, func(cfg *config.Config) error {
+		if _, ok := cfg.Targets[name]; !ok {
+			return fmt.Errorf("unknown target: %s", name)
+		}
+		delete(cfg.Targets, name)
+		return nil
+	})
+}
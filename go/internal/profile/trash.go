@@ -0,0 +1,363 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+)
+
+// DefaultTrashRetention is how long deleted profiles are kept when trash_retention is unset.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+const (
+	trashProfileFile = "profile.json"
+	trashItemFile    = "item.json"
+)
+
+// TrashItem is a deleted profile waiting in the trash. ExpiresAt is nil when the
+// trash is kept forever.
+type TrashItem struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+}
+
+// ParseRetention parses a trash retention period: a Go duration ("72h"), a number of
+// days ("30d"), or "0" to keep deleted profiles forever. Empty selects the default.
+func ParseRetention(s string) (time.Duration, error) {
+	if s == "" {
+		return DefaultTrashRetention, nil
+	}
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid trash retention: %s (e.g. 30d, 72h, or 0 to keep forever)", s)
+	}
+	return d, nil
+}
+
+func trashRetention(paths config.Paths) (time.Duration, error) {
+	cfg, err := config.Load(paths.ConfigFile)
+	if err != nil {
+		return 0, err
+	}
+	return ParseRetention(cfg.TrashRetention)
+}
+
+// trashItems reads the trash, oldest first. Directories without an item file are
+// moves that never completed and are skipped.
+func trashItems(paths config.Paths) ([]TrashItem, error) {
+	if paths.TrashDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(paths.TrashDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read trash: %w", err)
+	}
+
+	retention, err := trashRetention(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []TrashItem
+	for _, e := range entries {
+		id, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(paths.TrashDir, e.Name(), trashItemFile))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read trash item %d: %w", id, err)
+		}
+		var item TrashItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, fmt.Errorf("failed to parse trash item %d: %w", id, err)
+		}
+		item.ID = id
+		if retention > 0 {
+			expires := item.DeletedAt.Add(retention)
+			item.ExpiresAt = &expires
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+func trashItemDir(paths config.Paths, id int) string {
+	return filepath.Join(paths.TrashDir, strconv.Itoa(id))
+}
+
+// ListTrash returns the deleted profiles, newest first.
+func ListTrash(paths config.Paths) ([]TrashItem, error) {
+	var items []TrashItem
+	err := withSharedLock(paths, func() error {
+		var err error
+		items, err = trashItems(paths)
+		return err
+	})
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, err
+}
+
+// findTrashItem selects an item by id, or the most recently deleted one by name.
+func findTrashItem(paths config.Paths, selector string) (TrashItem, error) {
+	items, err := trashItems(paths)
+	if err != nil {
+		return TrashItem{}, err
+	}
+	id, idErr := strconv.Atoi(selector)
+	for i := len(items) - 1; i >= 0; i-- {
+		if (idErr == nil && items[i].ID == id) || items[i].Name == selector {
+			return items[i], nil
+		}
+	}
+	return TrashItem{}, fmt.Errorf("not in trash: %s", selector)
+}
+
+// planTrash plans moving a profile into a new trash item, keeping its tags with it.
+func planTrash(plan *Plan, name string, paths config.Paths) error {
+	items, err := trashItems(paths)
+	if err != nil {
+		return err
+	}
+	id := 1
+	if len(items) > 0 {
+		id = items[len(items)-1].ID + 1
+	}
+	// Skip ids of interrupted moves so a leftover directory is never reused.
+	for {
+		if _, err := os.Lstat(trashItemDir(paths, id)); os.IsNotExist(err) {
+			break
+		}
+		id++
+	}
+
+	meta, err := loadMeta(paths)
+	if err != nil {
+		return err
+	}
+	item := TrashItem{Name: name, Tags: meta[name].Tags}
+	src := profilePath(paths, name)
+	dir := trashItemDir(paths, id)
+
+	plan.add(Step{Action: StepRename, Path: dir, Source: src, Mode: "0600", Detail: "move " + name + " to trash"}, func() error {
+		if err := os.MkdirAll(paths.TrashDir, 0700); err != nil {
+			return fmt.Errorf("failed to create trash: %w", err)
+		}
+		if err := os.Chmod(paths.TrashDir, 0700); err != nil {
+			return fmt.Errorf("failed to set permissions on trash: %w", err)
+		}
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create trash item: %w", err)
+		}
+		if err := os.Rename(src, filepath.Join(dir, trashProfileFile)); err != nil {
+			return fmt.Errorf("failed to move profile to trash: %w", err)
+		}
+		item.DeletedAt = time.Now().UTC().Truncate(time.Second)
+		if err := fs.AtomicWriteJSON(filepath.Join(dir, trashItemFile), item, 0600); err != nil {
+			return fmt.Errorf("failed to write trash item: %w", err)
+		}
+		return pruneGroups(paths, name)
+	})
+	return nil
+}
+
+// planExpireTrash plans shredding trash items older than the retention period.
+func planExpireTrash(plan *Plan, paths config.Paths) error {
+	items, err := trashItems(paths)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, item := range items {
+		if item.ExpiresAt != nil && now.After(*item.ExpiresAt) {
+			planShred(plan, trashItemDir(paths, item.ID), fmt.Sprintf("expire trash item %d (%s)", item.ID, item.Name))
+		}
+	}
+	return nil
+}
+
+// planShred plans overwriting and removing a file or directory. Shredding can't be
+// undone, so the step is never captured for Undo.
+func planShred(plan *Plan, path, detail string) {
+	plan.add(Step{Action: StepRemove, Path: path, Detail: detail, irreversible: true}, func() error {
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if info.IsDir() {
+			return fs.ShredTree(path)
+		}
+		return fs.Shred(path)
+	})
+}
+
+// planPurge plans shredding a profile and every undo entry that holds a copy of it,
+// either as an earlier version of the profile or as a byte-equal auth.json, so
+// nothing of it is left on disk.
+func planPurge(plan *Plan, name string, paths config.Paths) error {
+	file := profilePath(paths, name)
+	current, _ := os.ReadFile(file)
+	plan.add(Step{Action: StepRemove, Path: file, Detail: "purge " + name + " (overwrite and remove)", irreversible: true}, func() error {
+		if err := fs.Shred(file); err != nil {
+			return fmt.Errorf("failed to purge profile: %w", err)
+		}
+		return pruneGroups(paths, name)
+	})
+
+	ids, err := undoIDs(paths)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		entry, err := loadUndo(paths, id)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join(paths.UndoDir, strconv.Itoa(id))
+		for _, img := range entry.Files {
+			if img.Blob == "" {
+				continue
+			}
+			if img.Path == file || blobEquals(filepath.Join(dir, img.Blob), current) {
+				planShred(plan, dir, fmt.Sprintf("drop undo entry %d, which holds a copy of %s", id, name))
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func blobEquals(file string, want []byte) bool {
+	if len(want) == 0 {
+		return false
+	}
+	have, err := os.ReadFile(file)
+	return err == nil && bytes.Equal(have, want)
+}
+
+// planRestore plans moving a trash item back into the profiles, under its own
+// name unless to is set.
+func planRestore(plan *Plan, selector, to string, paths config.Paths) error {
+	item, err := findTrashItem(paths, selector)
+	if err != nil {
+		return err
+	}
+	name := item.Name
+	if to != "" {
+		name = to
+	}
+	if err := checkWritable(paths, name); err != nil {
+		return err
+	}
+	dst := profilePath(paths, name)
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%w: %s (restore it under another name)", ErrExists, name)
+	}
+
+	dir := trashItemDir(paths, item.ID)
+	src := filepath.Join(dir, trashProfileFile)
+	plan.add(Step{Action: StepRename, Path: dst, Source: src, Mode: "0600", Detail: fmt.Sprintf("restore trash item %d as %s", item.ID, name)}, func() error {
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return fmt.Errorf("failed to create profile group: %w", err)
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("failed to restore profile: %w", err)
+		}
+		if err := os.Chmod(dst, 0600); err != nil {
+			return fmt.Errorf("failed to set permissions on restored profile: %w", err)
+		}
+		return fs.SyncDir(filepath.Dir(dst))
+	})
+	plan.add(Step{Action: StepRemove, Path: dir, Detail: fmt.Sprintf("drop trash item %d", item.ID)}, func() error {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove trash item: %w", err)
+		}
+		return nil
+	})
+	ev := Event{Type: EventRestored, Profile: name, Detail: fmt.Sprintf("trash item %d", item.ID)}
+	if name != item.Name {
+		ev.From = item.Name
+	}
+	plan.emit(ev)
+	if len(item.Tags) > 0 {
+		planMeta(plan, paths, "restore tags of "+name, func(meta map[string]Meta) {
+			m := meta[name]
+			m.Tags = item.Tags
+			meta[name] = m
+		})
+	}
+	return planExpireTrash(plan, paths)
+}
+
+// EmptyTrash shreds trash items: the ones selected by id or name, only the expired
+// ones, or all of them. With dryRun it only returns the plan.
+func EmptyTrash(selectors []string, expiredOnly bool, paths config.Paths, dryRun bool) (*Plan, error) {
+	plan := &Plan{Op: "empty-trash", DryRun: dryRun}
+	build := func() error {
+		if expiredOnly {
+			return planExpireTrash(plan, paths)
+		}
+		if len(selectors) == 0 {
+			items, err := trashItems(paths)
+			if err != nil {
+				return err
+			}
+			for _, item := range items {
+				planShred(plan, trashItemDir(paths, item.ID), fmt.Sprintf("shred trash item %d (%s)", item.ID, item.Name))
+			}
+			return nil
+		}
+		seen := map[int]bool{}
+		for _, selector := range selectors {
+			item, err := findTrashItem(paths, selector)
+			if err != nil {
+				return err
+			}
+			if !seen[item.ID] {
+				seen[item.ID] = true
+				planShred(plan, trashItemDir(paths, item.ID), fmt.Sprintf("shred trash item %d (%s)", item.ID, item.Name))
+			}
+		}
+		return nil
+	}
+
+	if dryRun {
+		return plan, withSharedLock(paths, build)
+	}
+	return plan, withLock(paths, func() error {
+		if err := build(); err != nil {
+			return err
+		}
+		return plan.execute(0)
+	})
+}
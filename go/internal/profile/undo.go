@@ -0,0 +1,382 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+)
+
+// UndoDepth is how many mutations can be undone; older entries are dropped.
+const UndoDepth = 10
+
+const undoEntryFile = "entry.json"
+
+// PreImage is the state of one file before a mutation touched it. The contents of a
+// regular file are kept next to the entry, never in it.
+type PreImage struct {
+	Path    string `json:"path"`
+	Existed bool   `json:"existed"`
+	Mode    string `json:"mode,omitempty"`
+	Link    string `json:"link,omitempty"` // Symlink target, if the file was a symlink
+	Blob    string `json:"blob,omitempty"`
+}
+
+// UndoEntry is one undoable mutation: the operations it ran and the pre-images of
+// every file they changed.
+type UndoEntry struct {
+	ID    int        `json:"id"`
+	Time  time.Time  `json:"time"`
+	Ops   []string   `json:"ops"`
+	Files []PreImage `json:"files"`
+}
+
+// undoRecorder collects pre-images for a new undo entry. Callers must hold the lock.
+type undoRecorder struct {
+	paths config.Paths
+	entry UndoEntry
+	dir   string
+	seen  map[string]bool
+}
+
+// beginUndo starts a new undo entry with the next free id.
+func beginUndo(paths config.Paths) (*undoRecorder, error) {
+	ids, err := undoIDs(paths)
+	if err != nil {
+		return nil, err
+	}
+	id := 1
+	if len(ids) > 0 {
+		id = ids[len(ids)-1] + 1
+	}
+
+	dir := filepath.Join(paths.UndoDir, strconv.Itoa(id))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create undo entry: %w", err)
+	}
+	if err := os.Chmod(paths.UndoDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", paths.UndoDir, err)
+	}
+	return &undoRecorder{
+		paths: paths,
+		entry: UndoEntry{ID: id, Time: time.Now().UTC().Truncate(time.Second)},
+		dir:   dir,
+		seen:  map[string]bool{},
+	}, nil
+}
+
+// capture records the pre-images of the files the steps of op are about to change.
+// A file touched twice keeps its first pre-image.
+func (r *undoRecorder) capture(op Operation, steps []Step) error {
+	r.entry.Ops = append(r.entry.Ops, op.String())
+	for _, step := range steps {
+		if step.Action == StepMkdir || step.Action == StepChmod || step.irreversible {
+			continue
+		}
+		files := []string{step.Path}
+		if step.Source != "" && step.Action == StepRename {
+			files = append(files, step.Source)
+		}
+		for _, file := range files {
+			if err := r.captureFile(file); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// captureFile records the pre-image of file, or of every file in it if it is a directory.
+func (r *undoRecorder) captureFile(file string) error {
+	if r.seen[file] {
+		return nil
+	}
+	r.seen[file] = true
+
+	if info, err := os.Lstat(file); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		for _, e := range entries {
+			if err := r.captureFile(filepath.Join(file, e.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	img, err := r.preImage(file)
+	if err != nil {
+		return err
+	}
+	r.entry.Files = append(r.entry.Files, img)
+	return nil
+}
+
+func (r *undoRecorder) preImage(file string) (PreImage, error) {
+	img := PreImage{Path: file}
+	info, err := os.Lstat(file)
+	if os.IsNotExist(err) {
+		return img, nil
+	} else if err != nil {
+		return img, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	img.Existed = true
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if img.Link, err = os.Readlink(file); err != nil {
+			return img, fmt.Errorf("failed to read symlink %s: %w", file, err)
+		}
+		return img, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return img, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	img.Mode = fmt.Sprintf("%04o", info.Mode().Perm())
+	img.Blob = strconv.Itoa(len(r.entry.Files))
+	if err := fs.AtomicWriteFile(filepath.Join(r.dir, img.Blob), data, 0600); err != nil {
+		return img, fmt.Errorf("failed to save pre-image of %s: %w", file, err)
+	}
+	return img, nil
+}
+
+// commit writes the entry, making it undoable, and drops entries beyond UndoDepth.
+func (r *undoRecorder) commit() error {
+	data, err := json.MarshalIndent(r.entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode undo entry: %w", err)
+	}
+	if err := fs.AtomicWriteFile(filepath.Join(r.dir, undoEntryFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write undo entry: %w", err)
+	}
+
+	ids, err := undoIDs(r.paths)
+	if err != nil {
+		return err
+	}
+	// Entries hold pre-images of auth.json and profiles, so they are shredded like a purge.
+	for len(ids) > UndoDepth {
+		if err := fs.ShredTree(filepath.Join(r.paths.UndoDir, strconv.Itoa(ids[0]))); err != nil {
+			return fmt.Errorf("failed to drop old undo entry: %w", err)
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// abandon shreds an entry that was never committed.
+func (r *undoRecorder) abandon() {
+	if err := fs.ShredTree(r.dir); err != nil {
+		os.RemoveAll(r.dir)
+	}
+}
+
+// undoIDs returns the ids of the undo entries, oldest first.
+func undoIDs(paths config.Paths) ([]int, error) {
+	if paths.UndoDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(paths.UndoDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read undo history: %w", err)
+	}
+
+	var ids []int
+	for _, e := range entries {
+		if id, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// loadUndo reads a committed entry. Entries without an entry file were interrupted
+// before anything changed and are reported as missing.
+func loadUndo(paths config.Paths, id int) (UndoEntry, error) {
+	var entry UndoEntry
+	data, err := os.ReadFile(filepath.Join(paths.UndoDir, strconv.Itoa(id), undoEntryFile))
+	if err != nil {
+		return entry, err
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return entry, fmt.Errorf("failed to parse undo entry %d: %w", id, err)
+	}
+	return entry, nil
+}
+
+// UndoHistory returns the undoable mutations, newest first.
+func UndoHistory(paths config.Paths) ([]UndoEntry, error) {
+	var history []UndoEntry
+	err := withSharedLock(paths, func() error {
+		ids, err := undoIDs(paths)
+		if err != nil {
+			return err
+		}
+		for i := len(ids) - 1; i >= 0; i-- {
+			entry, err := loadUndo(paths, ids[i])
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			history = append(history, entry)
+		}
+		return nil
+	})
+	return history, err
+}
+
+// Undo reverts the most recent mutation by restoring the pre-images it recorded,
+// then drops its entry. With dryRun it only returns the plan.
+func Undo(paths config.Paths, dryRun bool) (UndoEntry, *Plan, error) {
+	var entry UndoEntry
+	plan := &Plan{Op: "undo", DryRun: dryRun}
+	err := withLock(paths, func() error {
+		ids, err := undoIDs(paths)
+		if err != nil {
+			return err
+		}
+		for i := len(ids) - 1; i >= 0 && entry.ID == 0; i-- {
+			entry, err = loadUndo(paths, ids[i])
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		if entry.ID == 0 {
+			return fmt.Errorf("nothing to undo")
+		}
+
+		if err := planUndo(plan, entry, paths); err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+		if err := plan.execute(0); err != nil {
+			return err
+		}
+		active, _ := readActiveProfile(paths)
+		plan.emit(Event{Type: EventUndone, Profile: active, Detail: strings.Join(entry.Ops, "; ")})
+		journalEvents(paths, plan.events)
+		return nil
+	})
+	return entry, plan, err
+}
+
+// planUndo plans restoring every pre-image of entry and then dropping the entry.
+func planUndo(plan *Plan, entry UndoEntry, paths config.Paths) error {
+	opts, err := writeOptions(paths)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(paths.UndoDir, strconv.Itoa(entry.ID))
+
+	// Restoring auth.json would lose tokens Codex refreshed since the entry was
+	// recorded, so sync them back first, as use does, unless the restore puts the
+	// active profile back too.
+	restoresAuth, restoresActive := false, false
+	activeName, err := readActiveProfile(paths)
+	if err != nil {
+		return err
+	}
+	restoredName := activeName
+	for _, img := range entry.Files {
+		restoresAuth = restoresAuth || img.Path == paths.AuthFile
+		restoresActive = restoresActive || (activeName != "" && img.Path == profilePath(paths, activeName))
+		if img.Path == paths.ActiveFile {
+			restoredName = ""
+			if img.Existed && img.Blob != "" {
+				restoredName, _ = readMarker(filepath.Join(dir, img.Blob))
+			}
+		}
+	}
+	// Putting an earlier auth.json back is a switch, so the policy applies as for use.
+	if restoresAuth && restoredName != "" {
+		if err := planPolicy(plan, restoredName, paths); err != nil {
+			return err
+		}
+	}
+	if restoresAuth && !restoresActive {
+		if err := planSyncBack(plan, paths, "", opts); err != nil {
+			return err
+		}
+	}
+
+	for _, img := range entry.Files {
+		img := img
+		switch {
+		case !img.Existed:
+			if _, err := os.Lstat(img.Path); os.IsNotExist(err) {
+				continue
+			}
+			plan.add(Step{Action: StepRemove, Path: img.Path, Detail: "did not exist before"}, func() error {
+				if err := os.RemoveAll(img.Path); err != nil {
+					return fmt.Errorf("failed to remove %s: %w", img.Path, err)
+				}
+				return pruneProfileGroups(paths, img.Path)
+			})
+		case img.Link != "":
+			plan.add(Step{Action: StepWrite, Path: img.Path, Detail: "restore symlink to " + img.Link}, func() error {
+				if err := os.MkdirAll(filepath.Dir(img.Path), 0700); err != nil {
+					return fmt.Errorf("failed to create %s: %w", filepath.Dir(img.Path), err)
+				}
+				if err := os.Remove(img.Path); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to remove %s: %w", img.Path, err)
+				}
+				if err := os.Symlink(img.Link, img.Path); err != nil {
+					return fmt.Errorf("failed to restore symlink %s: %w", img.Path, err)
+				}
+				return nil
+			})
+		default:
+			mode, err := strconv.ParseUint(img.Mode, 8, 32)
+			if err != nil {
+				return fmt.Errorf("invalid mode in undo entry %d: %s", entry.ID, img.Mode)
+			}
+			blob := filepath.Join(dir, img.Blob)
+			plan.add(Step{Action: StepWrite, Path: img.Path, Mode: img.Mode, Detail: "restore previous contents"}, func() error {
+				data, err := os.ReadFile(blob)
+				if err != nil {
+					return fmt.Errorf("failed to read pre-image of %s: %w", img.Path, err)
+				}
+				if err := os.MkdirAll(filepath.Dir(img.Path), 0700); err != nil {
+					return fmt.Errorf("failed to create %s: %w", filepath.Dir(img.Path), err)
+				}
+				return fs.AtomicWriteFile(img.Path, data, os.FileMode(mode), opts)
+			})
+		}
+	}
+
+	plan.add(Step{Action: StepRemove, Path: dir, Detail: "drop undo entry " + strconv.Itoa(entry.ID)}, func() error {
+		if err := fs.ShredTree(dir); err != nil {
+			return fmt.Errorf("failed to drop undo entry: %w", err)
+		}
+		return nil
+	})
+	return nil
+}
+
+// pruneProfileGroups removes group directories left empty when file was a grouped profile.
+func pruneProfileGroups(paths config.Paths, file string) error {
+	rel, err := filepath.Rel(paths.ProfilesDir, file)
+	if err != nil || strings.HasPrefix(rel, "..") || !strings.HasSuffix(rel, ".json") {
+		return nil
+	}
+	return pruneGroups(paths, strings.TrimSuffix(filepath.ToSlash(rel), ".json"))
+}
@@ -0,0 +1,308 @@
+package profile
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+)
+
+// UnknownProfile attributes sessions that started while the event journal did not
+// know the active profile, including sessions from before the journal's oldest event.
+const UnknownProfile = "(unknown)"
+
+// TokenUsage is the token count Codex reports for a session.
+type TokenUsage struct {
+	Input           int64 `json:"input_tokens"`
+	CachedInput     int64 `json:"cached_input_tokens"`
+	Output          int64 `json:"output_tokens"`
+	ReasoningOutput int64 `json:"reasoning_output_tokens"`
+	Total           int64 `json:"total_tokens"`
+}
+
+func (t *TokenUsage) add(o TokenUsage) {
+	t.Input += o.Input
+	t.CachedInput += o.CachedInput
+	t.Output += o.Output
+	t.ReasoningOutput += o.ReasoningOutput
+	t.Total += o.Total
+}
+
+// SessionUsage is one Codex session log. HasTokens is false for logs written by
+// Codex versions that don't record token counts.
+type SessionUsage struct {
+	ID        string     `json:"id"`
+	File      string     `json:"file"`
+	Profile   string     `json:"profile"`
+	Start     time.Time  `json:"start"`
+	End       time.Time  `json:"end"`
+	Seconds   int64      `json:"duration_seconds"`
+	HasTokens bool       `json:"has_tokens"`
+	Tokens    TokenUsage `json:"tokens"`
+}
+
+// ProfileUsage totals the sessions attributed to one profile.
+type ProfileUsage struct {
+	Profile  string     `json:"profile"`
+	Sessions int        `json:"sessions"`
+	Seconds  int64      `json:"duration_seconds"`
+	Tokens   TokenUsage `json:"tokens"`
+}
+
+// UsageReport is the result of Usage. The journal keeps only recent history, so
+// BeforeJournal counts the sessions that started before its oldest event, whose
+// profile is unknown; JournalStart is zero if the journal is empty.
+type UsageReport struct {
+	Profiles      []ProfileUsage `json:"profiles"`
+	Sessions      []SessionUsage `json:"sessions"`
+	JournalStart  time.Time      `json:"journal_start"`
+	BeforeJournal int            `json:"sessions_before_journal"`
+}
+
+// Usage scans the session logs Codex writes under the target's Codex directory and
+// attributes each session to the profile that was active when it started, as
+// recorded by the event journal. Sessions that started before since, or whose
+// profile doesn't match the name or glob pattern profile (if set), are left out.
+// Totals are sorted by profile, sessions by start time.
+func Usage(paths config.Paths, since time.Time, profile string) (UsageReport, error) {
+	var report UsageReport
+	if _, err := path.Match(profile, ""); err != nil {
+		return report, fmt.Errorf("invalid pattern: %s", profile)
+	}
+	var timeline []Event
+	err := withSharedLock(paths, func() error {
+		timeline, report.JournalStart = activeTimeline(paths)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	var sessions []SessionUsage
+	for _, dir := range []string{"sessions", "archived_sessions"} {
+		root := filepath.Join(paths.CodexDir, dir)
+		err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || !strings.HasPrefix(d.Name(), "rollout-") || !strings.HasSuffix(d.Name(), ".jsonl") {
+				return nil
+			}
+			// A log last written before since can't hold a session that started after it.
+			if info, err := d.Info(); err == nil && info.ModTime().Before(since) {
+				return nil
+			}
+			s, err := readSession(file)
+			if err != nil {
+				return err
+			}
+			if s.Start.Before(since) {
+				return nil
+			}
+			s.Profile = activeAt(timeline, s.Start)
+			if profile != "" {
+				if ok, _ := path.Match(profile, s.Profile); !ok {
+					return nil
+				}
+			}
+			if report.JournalStart.IsZero() || s.Start.Before(report.JournalStart) {
+				report.BeforeJournal++
+			}
+			sessions = append(sessions, s)
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to scan session logs: %w", err)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Start.Before(sessions[j].Start) })
+
+	byProfile := map[string]*ProfileUsage{}
+	var totals []ProfileUsage
+	for _, s := range sessions {
+		u, ok := byProfile[s.Profile]
+		if !ok {
+			u = &ProfileUsage{Profile: s.Profile}
+			byProfile[s.Profile] = u
+		}
+		u.Sessions++
+		u.Seconds += s.Seconds
+		u.Tokens.add(s.Tokens)
+	}
+	for _, u := range byProfile {
+		totals = append(totals, *u)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Profile < totals[j].Profile })
+	report.Profiles, report.Sessions = totals, sessions
+	return report, nil
+}
+
+// activeTimeline returns the target's journaled events that change which profile is
+// active, oldest first, including the rotated journal, and the time of the oldest
+// event of any kind, before which the journal knows nothing. Callers must hold the lock.
+func activeTimeline(paths config.Paths) ([]Event, time.Time) {
+	if paths.EventsFile == "" {
+		return nil, time.Time{}
+	}
+	var timeline []Event
+	var start time.Time
+	for _, file := range []string{paths.EventsFile + ".1", paths.EventsFile} {
+		tail := openTail(file, true)
+		for _, ev := range tail.drain() {
+			if start.IsZero() {
+				start = ev.Time
+			}
+			if ev.Target != paths.Target {
+				continue
+			}
+			switch ev.Type {
+			case EventSwitched, EventSaved, EventRenamed, EventDeleted, EventRestored, EventUndone:
+				timeline = append(timeline, ev)
+			}
+		}
+		tail.close()
+	}
+	return timeline, start
+}
+
+// activeAt replays the timeline up to t and returns the profile active then.
+// Saving a profile activates it; renaming the active one carries over. Deleting it
+// leaves the active profile unknown until it is restored, and an undo names the
+// profile active after it. Pulls only refresh the active profile in place.
+func activeAt(timeline []Event, t time.Time) string {
+	active, deleted := UnknownProfile, ""
+	for _, ev := range timeline {
+		if ev.Time.After(t) {
+			break
+		}
+		switch ev.Type {
+		case EventSwitched, EventSaved:
+			active = ev.Profile
+		case EventRenamed:
+			if ev.From == active {
+				active = ev.Profile
+			}
+		case EventDeleted:
+			if ev.Profile == active {
+				active, deleted = UnknownProfile, ev.Profile
+			}
+		case EventRestored:
+			if active == UnknownProfile && deleted != "" && (ev.From == deleted || (ev.From == "" && ev.Profile == deleted)) {
+				active = ev.Profile
+			}
+		case EventUndone:
+			active = ev.Profile
+			if active == "" {
+				active = UnknownProfile
+			}
+		}
+	}
+	return active
+}
+
+// rolloutLine is the part of a session log line codex-mp reads. Current Codex
+// versions wrap items as {"timestamp","type","payload"}; older ones start with a
+// bare {"id","timestamp"} header.
+type rolloutLine struct {
+	Timestamp string          `json:"timestamp"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+type rolloutPayload struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Info *struct {
+		Total *TokenUsage `json:"total_token_usage"`
+	} `json:"info"`
+}
+
+// readSession reads the start and end times, id and final token count of a session
+// log. Times missing from the log fall back to the file name and modification time.
+func readSession(file string) (SessionUsage, error) {
+	s := SessionUsage{File: file}
+	f, err := os.Open(file)
+	if err != nil {
+		return s, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			s.readLine(line)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return s, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+	}
+
+	// rollout-2025-01-02T03-04-05-<uuid>.jsonl, in local time.
+	base := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "rollout-"), ".jsonl")
+	if s.Start.IsZero() && len(base) >= 19 {
+		if t, err := time.ParseInLocation("2006-01-02T15-04-05", base[:19], time.Local); err == nil {
+			s.Start = t
+		}
+	}
+	if s.ID == "" && len(base) > 20 {
+		s.ID = base[20:]
+	}
+	if info, err := f.Stat(); err == nil {
+		if s.End.IsZero() {
+			s.End = info.ModTime()
+		}
+		if s.Start.IsZero() {
+			s.Start = info.ModTime()
+		}
+	}
+	if s.End.After(s.Start) {
+		s.Seconds = int64(s.End.Sub(s.Start).Seconds())
+	}
+	return s, nil
+}
+
+func (s *SessionUsage) readLine(line []byte) {
+	var l rolloutLine
+	if json.Unmarshal(line, &l) != nil {
+		return
+	}
+	if t, err := time.Parse(time.RFC3339Nano, l.Timestamp); err == nil {
+		if s.Start.IsZero() {
+			s.Start = t
+		}
+		s.End = t
+	}
+	if s.ID == "" {
+		s.ID = l.ID
+	}
+
+	var p rolloutPayload
+	if len(l.Payload) == 0 || json.Unmarshal(l.Payload, &p) != nil {
+		return
+	}
+	switch {
+	case l.Type == "session_meta" && s.ID == "":
+		s.ID = p.ID
+	case p.Type == "token_count" && p.Info != nil && p.Info.Total != nil:
+		// Counts are cumulative, so the last one is the session's total.
+		s.Tokens = *p.Info.Total
+		s.HasTokens = true
+	}
+}
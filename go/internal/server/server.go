@@ -0,0 +1,218 @@
+// Package server exposes the profile store as a small JSON API over a Unix socket,
+// for editor extensions and menu bar tools. Every request goes through the profile
+// package, so the API takes the same locks as the CLI.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/fs"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+)
+
+// Server serves the API for one target.
+type Server struct {
+	paths config.Paths
+}
+
+// New returns a server for the target in paths.
+func New(paths config.Paths) *Server {
+	return &Server{paths: paths}
+}
+
+// Handler returns the API routes.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/profiles", s.handleProfiles)
+	mux.HandleFunc("GET /v1/current", s.handleCurrent)
+	mux.HandleFunc("POST /v1/use", s.handleMutation(profile.OpUse))
+	mux.HandleFunc("POST /v1/save", s.handleMutation(profile.OpSave))
+	mux.HandleFunc("GET /v1/events", s.handleEvents)
+	return mux
+}
+
+// Serve answers requests on ln until ctx is done, then shuts down gracefully.
+// Requests inherit ctx, so event streams end when it is done.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stop()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return fmt.Errorf("failed to shut down: %w", err)
+		}
+		return nil
+	}
+}
+
+// Listen creates a Unix socket at path that only the current user can connect to.
+// A stale socket left by a crashed server is replaced; a live one is an error.
+func Listen(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("refusing to replace %s: not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("already serving on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	// The umask keeps the socket private from the moment it exists.
+	old := syscall.Umask(0177)
+	ln, err := net.Listen("unix", path)
+	syscall.Umask(old)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	return ln, nil
+}
+
+// NewClient returns an HTTP client that talks to the server on socket. Any host
+// works in request URLs, e.g. http://codex-mp/v1/current.
+func NewClient(socket string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	details, err := profile.ListDetails(s.paths)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if details == nil {
+		details = []profile.Details{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "profiles": details})
+}
+
+func (s *Server) handleCurrent(w http.ResponseWriter, r *http.Request) {
+	cur, err := profile.CurrentProfile(s.paths)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "current": cur})
+}
+
+// mutationRequest is the body of POST /v1/use and /v1/save.
+type mutationRequest struct {
+	Name   string `json:"name"`
+	DryRun bool   `json:"dry_run"`
+}
+
+func (s *Server) handleMutation(op string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req mutationRequest
+		dec := json.NewDecoder(io.LimitReader(r.Body, 1<<16))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "invalid request: " + err.Error()})
+			return
+		}
+		if req.Name == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"ok": false, "error": "missing profile name"})
+			return
+		}
+
+		plan, err := profile.Apply(profile.Operation{Op: op, Name: req.Name}, s.paths, req.DryRun)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "action": op, "profile": req.Name, "dry_run": req.DryRun, "plan": plan})
+	}
+}
+
+// handleEvents streams profile events as server-sent events until the client goes
+// away or the server shuts down.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"ok": false, "error": "streaming not supported"})
+		return
+	}
+
+	watcher, err := profile.WatchEvents(r.Context(), s.paths, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	watcher.Run(func(ev profile.Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps profile errors to HTTP statuses.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var locked *fs.LockedError
+	switch {
+	case errors.Is(err, profile.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, profile.ErrInvalidName):
+		status = http.StatusBadRequest
+	case errors.Is(err, profile.ErrExists):
+		status = http.StatusConflict
+	case errors.Is(err, profile.ErrManaged), errors.Is(err, profile.ErrPolicyBlocked):
+		status = http.StatusForbidden
+	case errors.As(err, &locked):
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]any{"ok": false, "error": err.Error()})
+}
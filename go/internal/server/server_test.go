@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+)
+
+// startServer serves a fresh store with profiles work and home on a socket and
+// returns the store paths and a client for it.
+func startServer(t *testing.T) (config.Paths, *http.Client, string) {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, so keep this one short.
+	dir, err := os.MkdirTemp("", "mp")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	paths := config.Paths{
+		Target:       config.DefaultTarget,
+		CodexDir:     dir,
+		AuthFile:     filepath.Join(dir, "auth.json"),
+		Storage:      config.StorageCodex,
+		DataDir:      dir,
+		StateDir:     dir,
+		ProfilesDir:  filepath.Join(dir, "profiles"),
+		MetaFile:     filepath.Join(dir, ".codex-mp-meta.json"),
+		ActiveFile:   filepath.Join(dir, ".codex-mp-active"),
+		PreviousFile: filepath.Join(dir, ".codex-mp-previous"),
+		CacheFile:    filepath.Join(dir, ".codex-mp-cache.json"),
+		LockFile:     filepath.Join(dir, ".codex-mp.lock"),
+		EventsFile:   filepath.Join(dir, ".codex-mp-events.jsonl"),
+		PolicyFile:   filepath.Join(dir, "policy.json"),
+	}
+	os.MkdirAll(paths.ProfilesDir, 0700)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "work.json"), []byte(`{"OPENAI_API_KEY":"sk-work"}`), 0600)
+	os.WriteFile(filepath.Join(paths.ProfilesDir, "home.json"), []byte(`{"OPENAI_API_KEY":"sk-home"}`), 0600)
+
+	socket := filepath.Join(dir, "s")
+	ln, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	srv := New(paths)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, ln) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("serve failed: %v", err)
+		}
+	})
+	return paths, NewClient(socket), socket
+}
+
+func call(t *testing.T, client *http.Client, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(method, "http://codex-mp"+path, strings.NewReader(body))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	var out map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("%s %s returned invalid JSON: %v", method, path, err)
+	}
+	return resp.StatusCode, out
+}
+
+func TestAPIListsAndSwitchesProfiles(t *testing.T) {
+	paths, client, socket := startServer(t)
+
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected socket with mode 0600, got %v (%v)", info, err)
+	}
+	if _, err := Listen(socket); err == nil {
+		t.Fatalf("expected a second server on the same socket to fail")
+	}
+
+	status, out := call(t, client, "GET", "/v1/profiles", "")
+	if status != http.StatusOK || len(out["profiles"].([]any)) != 2 {
+		t.Fatalf("unexpected profiles response %d: %v", status, out)
+	}
+
+	status, out = call(t, client, "POST", "/v1/use", `{"name":"work","dry_run":true}`)
+	if status != http.StatusOK || out["plan"] == nil {
+		t.Fatalf("unexpected dry run response %d: %v", status, out)
+	}
+	if _, err := os.Stat(paths.AuthFile); !os.IsNotExist(err) {
+		t.Fatalf("expected dry run to leave auth.json alone")
+	}
+
+	status, _ = call(t, client, "POST", "/v1/use", `{"name":"work"}`)
+	if status != http.StatusOK {
+		t.Fatalf("use failed with %d", status)
+	}
+	status, out = call(t, client, "GET", "/v1/current", "")
+	if cur := out["current"].(map[string]any); status != http.StatusOK || cur["name"] != "work" {
+		t.Fatalf("unexpected current response %d: %v", status, out)
+	}
+
+	for body, want := range map[string]int{
+		`{"name":"missing"}`: http.StatusNotFound,
+		`{"name":"../x"}`:    http.StatusBadRequest,
+		`{"nmae":"work"}`:    http.StatusBadRequest,
+	} {
+		if status, _ := call(t, client, "POST", "/v1/use", body); status != want {
+			t.Fatalf("POST /v1/use %s: expected %d, got %d", body, want, status)
+		}
+	}
+}
+
+func TestAPIEnforcesPolicy(t *testing.T) {
+	paths, client, _ := startServer(t)
+	os.WriteFile(paths.PolicyFile, []byte(`{"rules":[{"host":"*","tags":["approved"]}]}`), 0600)
+	if err := profile.SetTags("home", []string{"approved"}, paths); err != nil {
+		t.Fatalf("set tags failed: %v", err)
+	}
+
+	if status, out := call(t, client, "POST", "/v1/use", `{"name":"work"}`); status != http.StatusForbidden {
+		t.Fatalf("expected a blocked switch to fail with 403, got %d: %v", status, out)
+	}
+	if _, err := os.Stat(paths.AuthFile); !os.IsNotExist(err) {
+		t.Fatalf("expected a blocked switch to leave auth.json alone")
+	}
+	status, out := call(t, client, "POST", "/v1/use", `{"name":"home"}`)
+	if plan := out["plan"].(map[string]any); status != http.StatusOK || plan["policy"] == nil {
+		t.Fatalf("expected the allowed switch with its decision, got %d: %v", status, out)
+	}
+
+	raw, _ := os.ReadFile(paths.EventsFile)
+	journal := string(raw)
+	if !strings.Contains(journal, `"detail":"block use: work`) || !strings.Contains(journal, `"detail":"allow use: home`) {
+		t.Fatalf("expected both decisions in the journal, got:\n%s", journal)
+	}
+}
+
+func TestEventsStreamReportsSwitches(t *testing.T) {
+	paths, client, _ := startServer(t)
+
+	resp, err := client.Get("http://codex-mp/v1/events")
+	if err != nil {
+		t.Fatalf("events failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %s", ct)
+	}
+
+	events := make(chan profile.Event, 8)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var ev profile.Event
+				json.Unmarshal([]byte(data), &ev)
+				events <- ev
+			}
+		}
+	}()
+	next := func() profile.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for an event")
+			return profile.Event{}
+		}
+	}
+
+	call(t, client, "POST", "/v1/use", `{"name":"home","dry_run":true}`)
+	call(t, client, "POST", "/v1/use", `{"name":"home"}`)
+	if ev := next(); ev.Type != profile.EventSwitched || ev.Profile != "home" {
+		t.Fatalf("expected switched event, got %+v", ev)
+	}
+
+	// A switch made by the CLI is reported the same way, after the sync-back.
+	if err := profile.Use("work", paths); err != nil {
+		t.Fatalf("use failed: %v", err)
+	}
+	if ev := next(); ev.Type != profile.EventSynced || ev.Profile != "home" {
+		t.Fatalf("expected synced event, got %+v", ev)
+	}
+	if ev := next(); ev.Type != profile.EventSwitched || ev.Profile != "work" || ev.From != "home" {
+		t.Fatalf("expected switched event, got %+v", ev)
+	}
+
+	// A login outside codex-mp replaces auth.json behind its back.
+	if err := os.WriteFile(paths.AuthFile, []byte(`{"OPENAI_API_KEY":"sk-other"}`), 0600); err != nil {
+		t.Fatalf("failed to write auth.json: %v", err)
+	}
+	if ev := next(); ev.Type != profile.EventExternalChange || ev.Profile != "work" || !ev.Drift {
+		t.Fatalf("expected external change with drift, got %+v", ev)
+	}
+}
@@ -0,0 +1,61 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fuzzyScore reports whether every rune of query appears in text in order,
+// scoring consecutive matches and matches at word starts higher.
+// Matching is case-insensitive; an empty query matches everything with score 0.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+	if len(q) == 0 {
+		return 0, true
+	}
+
+	score, qi, prev := 0, 0, -2
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		if ti == prev+1 {
+			score += 3
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 2
+		}
+		prev = ti
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+
+	// Prefer tighter matches in shorter candidates.
+	return score*100 - len(t), true
+}
+
+// fuzzyFilter returns the indexes of candidates matching query, best match first.
+// Ties keep the original candidate order.
+func fuzzyFilter(query string, candidates []string) []int {
+	type hit struct{ index, score int }
+	var hits []hit
+	for i, c := range candidates {
+		if score, ok := fuzzyScore(query, c); ok {
+			hits = append(hits, hit{i, score})
+		}
+	}
+	sort.SliceStable(hits, func(a, b int) bool {
+		return hits[a].score > hits[b].score
+	})
+
+	out := make([]int, len(hits))
+	for i, h := range hits {
+		out[i] = h.index
+	}
+	return out
+}
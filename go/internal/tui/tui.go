@@ -0,0 +1,503 @@
+// Package tui implements the interactive profile manager behind `pick` and `ui`.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/BigCactusLabs/codex-multipass/internal/profile"
+	"github.com/BigCactusLabs/codex-multipass/internal/ui"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Result reports what happened in the picker once it exits.
+type Result struct {
+	Selected string // Profile chosen with enter, empty if the user quit
+	Switched bool   // Whether Selected was switched to (false in print mode)
+
+	Policy *profile.PolicyDecision // The policy decision on the switch, if a rule applied
+}
+
+// Options configures a picker session.
+type Options struct {
+	// Print makes enter report the chosen profile instead of switching to it.
+	Print bool
+	// Input and Output override the terminal used for the UI, e.g. /dev/tty
+	// when stdout is captured by a script. Nil means stdin/stdout.
+	Input  io.Reader
+	Output io.Writer
+}
+
+// Run starts the interactive profile manager and blocks until it exits.
+func Run(paths config.Paths, opts Options) (Result, error) {
+	var progOpts []tea.ProgramOption
+	progOpts = append(progOpts, tea.WithAltScreen())
+	if opts.Input != nil {
+		progOpts = append(progOpts, tea.WithInput(opts.Input))
+	}
+	if opts.Output != nil {
+		progOpts = append(progOpts, tea.WithOutput(opts.Output))
+		// Styles are bound to the default renderer; detect colors on the UI terminal, not stdout.
+		lipgloss.SetColorProfile(lipgloss.NewRenderer(opts.Output).ColorProfile())
+	}
+
+	m := newModel(paths)
+	m.print = opts.Print
+
+	final, err := tea.NewProgram(m, progOpts...).Run()
+	if err != nil {
+		return Result{}, err
+	}
+	return final.(model).result, nil
+}
+
+type mode int
+
+const (
+	modeBrowse mode = iota
+	modeFilter
+	modeRename
+	modeSave
+	modeConfirmDelete
+)
+
+// loadedMsg carries a fresh profile listing.
+type loadedMsg struct {
+	profiles []profile.Details
+	err      error
+}
+
+// doneMsg reports the outcome of a management action.
+type doneMsg struct {
+	status   string
+	err      error
+	switched string
+	policy   *profile.PolicyDecision
+}
+
+type model struct {
+	paths    config.Paths
+	profiles []profile.Details
+	visible  []int // Indexes into profiles matching the filter, best first
+	cursor   int
+	mode     mode
+	filter   textinput.Model
+	input    textinput.Model
+	status   string
+	isErr    bool
+	print    bool
+	height   int // Terminal rows, 0 until the first WindowSizeMsg
+	result   Result
+}
+
+var (
+	styleTitle    = lipgloss.NewStyle().Foreground(ui.ColorPrimary).Bold(true)
+	styleSelected = lipgloss.NewStyle().Foreground(ui.ColorSuccess).Bold(true)
+	styleItem     = lipgloss.NewStyle().Foreground(ui.ColorText)
+	styleLabel    = lipgloss.NewStyle().Foreground(ui.ColorSubtext).Width(12)
+	styleValue    = lipgloss.NewStyle().Foreground(ui.ColorSecondary)
+	styleHelp     = lipgloss.NewStyle().Foreground(ui.ColorSubtext)
+	stylePane     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(ui.ColorSubtext).Padding(0, 1)
+)
+
+func newModel(paths config.Paths) model {
+	filter := textinput.New()
+	filter.Prompt = "/ "
+	filter.Placeholder = "fuzzy filter"
+
+	input := textinput.New()
+	input.Prompt = "> "
+
+	return model{paths: paths, filter: filter, input: input}
+}
+
+func (m model) Init() tea.Cmd {
+	return m.load()
+}
+
+func (m model) load() tea.Cmd {
+	paths := m.paths
+	return func() tea.Msg {
+		profiles, err := profile.ListDetails(paths)
+		return loadedMsg{profiles: profiles, err: err}
+	}
+}
+
+// action runs a profile mutation off the UI loop and reports it as a doneMsg.
+func action(status string, fn func() error) tea.Cmd {
+	return func() tea.Msg {
+		if err := fn(); err != nil {
+			return doneMsg{err: err}
+		}
+		return doneMsg{status: status}
+	}
+}
+
+func (m model) selected() (profile.Details, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.visible) {
+		return profile.Details{}, false
+	}
+	return m.profiles[m.visible[m.cursor]], true
+}
+
+// applyFilter recomputes the visible profiles, keeping the selection when it still matches.
+func (m *model) applyFilter() {
+	current, hadSelection := m.selected()
+
+	candidates := make([]string, len(m.profiles))
+	for i, p := range m.profiles {
+		candidates[i] = strings.Join(append([]string{p.Name, p.Identity.Email}, p.Tags...), " ")
+	}
+	m.visible = fuzzyFilter(m.filter.Value(), candidates)
+
+	m.cursor = 0
+	if hadSelection {
+		for i, idx := range m.visible {
+			if m.profiles[idx].Name == current.Name {
+				m.cursor = i
+			}
+		}
+	}
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case loadedMsg:
+		if msg.err != nil {
+			m.status, m.isErr = msg.err.Error(), true
+			return m, nil
+		}
+		m.profiles = msg.profiles
+		m.applyFilter()
+		return m, nil
+
+	case doneMsg:
+		if msg.err != nil {
+			m.status, m.isErr = msg.err.Error(), true
+			return m, nil
+		}
+		if msg.switched != "" {
+			m.result = Result{Selected: msg.switched, Switched: true, Policy: msg.policy}
+			return m, tea.Quit
+		}
+		m.status, m.isErr = msg.status, false
+		return m, m.load()
+
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		switch m.mode {
+		case modeFilter:
+			return m.updateFilter(msg)
+		case modeRename, modeSave:
+			return m.updateInput(msg)
+		case modeConfirmDelete:
+			return m.updateConfirm(msg)
+		default:
+			return m.updateBrowse(msg)
+		}
+	}
+	return m, nil
+}
+
+func (m model) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	current, ok := m.selected()
+
+	switch msg.String() {
+	case "q", "esc":
+		return m, tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.visible)-1 {
+			m.cursor++
+		}
+	case "/":
+		m.mode = modeFilter
+		return m, m.filter.Focus()
+	case "R", "ctrl+r":
+		m.status, m.isErr = "Refreshed", false
+		return m, m.load()
+	case "s":
+		m.mode = modeSave
+		m.input.SetValue("")
+		m.input.Placeholder = "name for current auth"
+		return m, m.input.Focus()
+	case "enter":
+		if ok && m.print {
+			m.result = Result{Selected: current.Name}
+			return m, tea.Quit
+		}
+		if ok {
+			name, paths := current.Name, m.paths
+			return m, func() tea.Msg {
+				plan, err := profile.Apply(profile.Operation{Op: profile.OpUse, Name: name}, paths, false)
+				if err != nil {
+					return doneMsg{err: err}
+				}
+				return doneMsg{switched: name, policy: plan.Policy}
+			}
+		}
+	case "r":
+		if ok {
+			m.mode = modeRename
+			m.input.SetValue(current.Name)
+			m.input.Placeholder = "new name"
+			m.input.CursorEnd()
+			return m, m.input.Focus()
+		}
+	case "d":
+		if ok {
+			m.mode = modeConfirmDelete
+		}
+	}
+	return m, nil
+}
+
+func (m model) updateFilter(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.filter.SetValue("")
+		fallthrough
+	case "enter":
+		m.mode = modeBrowse
+		m.filter.Blur()
+		m.applyFilter()
+		return m, nil
+	case "up", "down":
+		return m.updateBrowse(msg)
+	}
+
+	var cmd tea.Cmd
+	m.filter, cmd = m.filter.Update(msg)
+	m.applyFilter()
+	return m, cmd
+}
+
+func (m model) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.mode = modeBrowse
+		m.input.Blur()
+		return m, nil
+	case "enter":
+		value := strings.TrimSpace(m.input.Value())
+		editing := m.mode
+		m.mode = modeBrowse
+		m.input.Blur()
+		if value == "" {
+			return m, nil
+		}
+
+		paths := m.paths
+		if editing == modeSave {
+			return m, action("Saved profile: "+value, func() error {
+				_, err := profile.Save(value, paths)
+				return err
+			})
+		}
+		current, ok := m.selected()
+		if !ok || value == current.Name {
+			return m, nil
+		}
+		return m, action(fmt.Sprintf("Renamed: %s → %s", current.Name, value), func() error {
+			return profile.Rename(current.Name, value, paths)
+		})
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m model) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.mode = modeBrowse
+	current, ok := m.selected()
+	if !ok || msg.String() != "y" {
+		m.status, m.isErr = "Delete cancelled", false
+		return m, nil
+	}
+
+	paths := m.paths
+	return m, action("Deleted profile: "+current.Name, func() error {
+		return profile.Delete(current.Name, paths)
+	})
+}
+
+func (m model) View() string {
+	var b strings.Builder
+	b.WriteString(styleTitle.Render("Codex profiles") + "\n\n")
+
+	if m.mode == modeFilter || m.filter.Value() != "" {
+		b.WriteString(m.filter.View() + "\n\n")
+	}
+
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, m.viewList(), " ", m.viewDetails()) + "\n")
+
+	switch m.mode {
+	case modeRename:
+		b.WriteString("\nRename to:\n" + m.input.View() + "\n")
+	case modeSave:
+		b.WriteString("\nSave current auth as:\n" + m.input.View() + "\n")
+	case modeConfirmDelete:
+		if current, ok := m.selected(); ok {
+			b.WriteString(ui.StyleWarning.Render(fmt.Sprintf("\nDelete %s? (y/N)", current.Name)) + "\n")
+		}
+	}
+
+	if m.status != "" {
+		style := ui.StyleInfo
+		if m.isErr {
+			style = ui.StyleError
+		}
+		b.WriteString("\n" + style.Render(m.status) + "\n")
+	}
+
+	enterHelp := "enter switch"
+	if m.print {
+		enterHelp = "enter choose"
+	}
+	b.WriteString("\n" + styleHelp.Render("↑/↓ move • "+enterHelp+" • / filter • r rename • d delete • s save current • R refresh • q quit") + "\n")
+	return b.String()
+}
+
+func (m model) viewList() string {
+	if len(m.profiles) == 0 {
+		return stylePane.Render("No profiles found.")
+	}
+	if len(m.visible) == 0 {
+		return stylePane.Render("No matches.")
+	}
+
+	// Show only the rows that fit, in a window that keeps the cursor in view.
+	first, last := 0, len(m.visible)
+	if rows := m.listRows(); rows > 0 && rows < len(m.visible) {
+		first = min(max(m.cursor-rows/2, 0), len(m.visible)-rows)
+		last = first + rows
+	}
+
+	var lines []string
+	for i := first; i < last; i++ {
+		p := m.profiles[m.visible[i]]
+		label := p.Name
+		if p.Active {
+			label += " ●"
+		}
+		if i == m.cursor {
+			lines = append(lines, styleSelected.Render("▸ "+label))
+		} else {
+			lines = append(lines, styleItem.Render("  "+label))
+		}
+	}
+	return stylePane.Render(strings.Join(lines, "\n"))
+}
+
+// listRows is how many profiles fit in the list pane below the title and above the
+// prompts, status and help, or 0 while the terminal size is unknown.
+func (m model) listRows() int {
+	if m.height == 0 {
+		return 0
+	}
+	chrome := 2 + 2 + 1 + 2 // Title, pane border, line after the panes, help
+	if m.mode == modeFilter || m.filter.Value() != "" {
+		chrome += 2
+	}
+	switch m.mode {
+	case modeRename, modeSave:
+		chrome += 3
+	case modeConfirmDelete:
+		chrome += 2
+	}
+	if m.status != "" {
+		chrome += 2
+	}
+	return max(m.height-chrome, 1)
+}
+
+func (m model) viewDetails() string {
+	p, ok := m.selected()
+	if !ok {
+		return ""
+	}
+
+	row := func(label, value string) string {
+		if value == "" {
+			value = "—"
+		}
+		return styleLabel.Render(label) + styleValue.Render(value)
+	}
+
+	id := p.Identity
+	token := ""
+	if id.ExpiresAt != nil {
+		token = "expires " + relative(*id.ExpiresAt)
+	}
+	if id.LastRefresh != nil {
+		if token != "" {
+			token += ", "
+		}
+		token += "refreshed " + relative(*id.LastRefresh)
+	}
+	lastUsed := ""
+	if p.LastUsed != nil {
+		lastUsed = relative(*p.LastUsed)
+	}
+	fingerprint := p.Fingerprint
+	if len(fingerprint) > 12 {
+		fingerprint = fingerprint[:12]
+	}
+
+	lines := []string{
+		styleTitle.Render(p.Name),
+		row("Mode", id.Mode),
+		row("Email", id.Email),
+		row("Account", id.AccountID),
+		row("Plan", id.Plan),
+		row("Token", token),
+		row("Last used", lastUsed),
+		row("Tags", strings.Join(p.Tags, ", ")),
+		row("Fingerprint", fingerprint),
+	}
+	if p.Active {
+		lines = append(lines, row("Status", "active"))
+	}
+	return stylePane.Render(strings.Join(lines, "\n"))
+}
+
+// relative renders t as a coarse offset from now, e.g. "in 3d" or "2h ago".
+func relative(t time.Time) string {
+	d := time.Until(t)
+	future := d > 0
+	if !future {
+		d = -d
+	}
+
+	var s string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		s = fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		s = fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		s = fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+
+	if future {
+		return "in " + s
+	}
+	return s + " ago"
+}
@@ -0,0 +1,178 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BigCactusLabs/codex-multipass/internal/config"
+	"github.com/charmbracelet/bubbles/cursor"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func setupTest(t *testing.T) config.Paths {
+	t.Helper()
+	dir := t.TempDir()
+	paths := config.Paths{
+		Target:      config.DefaultTarget,
+		CodexDir:    dir,
+		AuthFile:    filepath.Join(dir, "auth.json"),
+		Storage:     config.StorageCodex,
+		DataDir:     dir,
+		StateDir:    dir,
+		ProfilesDir: filepath.Join(dir, "profiles"),
+		MetaFile:    filepath.Join(dir, ".codex-mp-meta.json"),
+		ActiveFile:  filepath.Join(dir, ".codex-mp-active"),
+		CacheFile:   filepath.Join(dir, ".codex-mp-cache.json"),
+		LockFile:    filepath.Join(dir, ".codex-mp.lock"),
+	}
+	if err := os.MkdirAll(paths.ProfilesDir, 0700); err != nil {
+		t.Fatalf("failed to create profiles dir: %v", err)
+	}
+	for _, name := range []string{"work", "personal", "acme-dev"} {
+		if err := os.WriteFile(filepath.Join(paths.ProfilesDir, name+".json"), []byte(`{"name":"`+name+`"}`), 0600); err != nil {
+			t.Fatalf("failed to write profile: %v", err)
+		}
+	}
+	return paths
+}
+
+// newTestModel returns a loaded model whose inputs do not blink, so commands return immediately.
+func newTestModel(paths config.Paths) model {
+	m := newModel(paths)
+	m.filter.Cursor.SetMode(cursor.CursorStatic)
+	m.input.Cursor.SetMode(cursor.CursorStatic)
+	return send(m, m.Init()())
+}
+
+// send feeds msg to the model and runs any resulting command to completion.
+func send(m model, msg tea.Msg) model {
+	next, cmd := m.Update(msg)
+	m = next.(model)
+	for cmd != nil {
+		out := cmd()
+		if out == nil {
+			break
+		}
+		if _, ok := out.(tea.QuitMsg); ok {
+			break
+		}
+		next, cmd = m.Update(out)
+		m = next.(model)
+	}
+	return m
+}
+
+func keys(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	if _, ok := fuzzyScore("wk", "work"); !ok {
+		t.Fatalf("expected wk to match work")
+	}
+	if _, ok := fuzzyScore("kw", "work"); ok {
+		t.Fatalf("expected kw not to match work")
+	}
+
+	got := fuzzyFilter("ad", []string{"personal-admin", "acme-dev", "ad"})
+	if len(got) != 3 || got[0] != 2 {
+		t.Fatalf("expected exact match ranked first, got %v", got)
+	}
+}
+
+func TestFilterAndDelete(t *testing.T) {
+	paths := setupTest(t)
+
+	m := newTestModel(paths)
+	if len(m.visible) != 3 {
+		t.Fatalf("expected 3 visible profiles, got %d", len(m.visible))
+	}
+
+	m = send(m, keys("/"))
+	m = send(m, keys("acd"))
+	if len(m.visible) != 1 {
+		t.Fatalf("expected 1 match for filter, got %d", len(m.visible))
+	}
+	m = send(m, tea.KeyMsg{Type: tea.KeyEnter})
+
+	if p, ok := m.selected(); !ok || p.Name != "acme-dev" {
+		t.Fatalf("expected acme-dev selected, got %+v", p)
+	}
+
+	m = send(m, keys("d"))
+	if m.mode != modeConfirmDelete {
+		t.Fatalf("expected delete confirmation")
+	}
+	m = send(m, keys("y"))
+	if m.isErr {
+		t.Fatalf("delete failed: %s", m.status)
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfilesDir, "acme-dev.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected acme-dev to be deleted")
+	}
+	if len(m.profiles) != 2 {
+		t.Fatalf("expected list to reload with 2 profiles, got %d", len(m.profiles))
+	}
+}
+
+func TestEnterSwitchesProfile(t *testing.T) {
+	paths := setupTest(t)
+
+	m := newTestModel(paths)
+	m = send(m, keys("/"))
+	m = send(m, keys("pers"))
+	m = send(m, tea.KeyMsg{Type: tea.KeyEnter})
+	m = send(m, tea.KeyMsg{Type: tea.KeyEnter})
+
+	if m.result.Selected != "personal" || !m.result.Switched {
+		t.Fatalf("expected switch to personal, got %+v", m.result)
+	}
+	raw, err := os.ReadFile(paths.AuthFile)
+	if err != nil || string(raw) != `{"name":"personal"}` {
+		t.Fatalf("expected personal auth installed, got %q (%v)", raw, err)
+	}
+}
+
+func TestPrintModeDoesNotSwitch(t *testing.T) {
+	paths := setupTest(t)
+
+	m := newTestModel(paths)
+	m.print = true
+	m = send(m, tea.KeyMsg{Type: tea.KeyEnter})
+
+	if m.result.Selected == "" || m.result.Switched {
+		t.Fatalf("expected a selection without switching, got %+v", m.result)
+	}
+	if _, err := os.Stat(paths.AuthFile); !os.IsNotExist(err) {
+		t.Fatalf("expected auth.json to be untouched in print mode")
+	}
+}
+
+func TestListScrollsToKeepCursorVisible(t *testing.T) {
+	paths := setupTest(t)
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("p%02d", i)
+		os.WriteFile(filepath.Join(paths.ProfilesDir, name+".json"), []byte(`{"name":"`+name+`"}`), 0600)
+	}
+
+	m := newTestModel(paths)
+	m = send(m, tea.WindowSizeMsg{Width: 100, Height: 20})
+	for i := 0; i < len(m.visible); i++ {
+		m = send(m, keys("j"))
+	}
+	last := m.profiles[m.visible[len(m.visible)-1]].Name
+
+	view := m.View()
+	if lines := strings.Count(view, "\n"); lines > 20 {
+		t.Fatalf("expected the view to fit 20 rows, got %d:\n%s", lines, view)
+	}
+	if !strings.Contains(view, "Codex profiles") || !strings.Contains(view, "▸ "+last) {
+		t.Fatalf("expected the header and the cursor on %s in view, got:\n%s", last, view)
+	}
+	if first := m.profiles[m.visible[0]].Name; strings.Contains(view, first) {
+		t.Fatalf("expected %s scrolled out of view, got:\n%s", first, view)
+	}
+}
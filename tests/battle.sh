@@ -54,12 +54,30 @@ echo '{"token": "new-token"}' > "$CODEX_HOME/profiles/new.json"
 "$CODEX_MP" use new
 grep "new-token" "$CODEX_HOME/auth.json" > /dev/null || exit 1
 
-if [[ -L "$CODEX_HOME/auth.json" ]]; then
-    echo "Note: auth.json is still a symlink (cp -f behavior on this system)"
-    grep "new-token" "$SYM_DIR/real_storage/auth.json" > /dev/null || exit 1
-else
-    echo "Note: auth.json is no longer a symlink (cp -f replaced it)"
-fi
+# Default policy (replace): the link is replaced and its target left alone
+[[ ! -L "$CODEX_HOME/auth.json" ]] || exit 1
+grep "link-token" "$SYM_DIR/real_storage/auth.json" > /dev/null || exit 1
+
+# write-through keeps the link and updates its target
+export CODEX_HOME="$SYM_DIR/policy_home"
+export CODEX_MP_CONFIG="$SYM_DIR/config.json"
+mkdir -p "$CODEX_HOME"
+ln -s "$SYM_DIR/real_storage/auth.json" "$CODEX_HOME/auth.json"
+"$CODEX_MP" init
+echo '{"token": "through-token"}' > "$CODEX_HOME/profiles/through.json"
+echo '{"symlink_policy": "write-through"}' > "$CODEX_MP_CONFIG"
+"$CODEX_MP" use through
+[[ -L "$CODEX_HOME/auth.json" ]] || exit 1
+grep "through-token" "$SYM_DIR/real_storage/auth.json" > /dev/null || exit 1
+
+# refuse leaves the link alone and fails
+echo '{"token": "refused-token"}' > "$CODEX_HOME/profiles/refused.json"
+echo '{"symlink_policy": "refuse"}' > "$CODEX_MP_CONFIG"
+if "$CODEX_MP" use refused 2>/dev/null; then exit 1; fi
+[[ -L "$CODEX_HOME/auth.json" ]] || exit 1
+grep "through-token" "$SYM_DIR/real_storage/auth.json" > /dev/null || exit 1
+if "$CODEX_MP" doctor > /dev/null; then exit 1; fi
+unset CODEX_MP_CONFIG
 echo "✓ Symlink test passed"
 
 # 3. Invalid Secret contents (Large file)